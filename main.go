@@ -3,8 +3,12 @@ package main
 import (
 	"log"
 	"os"
+	"time"
 
+	"instacloneapp/server/controller"
 	"instacloneapp/server/pkg/db"
+	"instacloneapp/server/pkg/mailer"
+	"instacloneapp/server/pkg/webpush"
 	"instacloneapp/server/routes"
 	cloudinary "instacloneapp/server/utils"
 
@@ -23,8 +27,6 @@ func main() {
 	var database db.Database
 	var err error
 
-	router.GET("/ws", socket.HandleConnection)
-
 	// Middleware
 	router.Use(gin.Logger())
 	router.Use(gin.Recovery())
@@ -35,6 +37,12 @@ func main() {
 		AllowCredentials: true,
 	}))
 
+	// Registered after CORS so the upgrade goes through the same origin policy
+	router.GET("/ws", socket.HandleConnection)
+
+	// Server-Sent Events fallback for networks that block websocket upgrades
+	router.GET("/api/v1/events", socket.HandleEvents)
+
 	// Load environment variables
 	env := os.Getenv("ENV")
 	if env == "" {
@@ -115,6 +123,51 @@ func main() {
 	routes.SetupRoutes(router, database, cloudinaryClient)
 	routes.SetupMessageRoutes(router, database, cloudinaryClient)
 	routes.SetupPostRoutes(router, database, cloudinaryClient)
+	routes.SetupNotificationRoutes(router, database, cloudinaryClient)
+	routes.SetupWebhookRoutes(router, database, cloudinaryClient)
+
+	// Fan realtime events out through the configured broker
+	broker, err := socket.NewBrokerFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to set up realtime broker: %v", err)
+	}
+	defer broker.Close()
+	socket.Init(database, broker)
+
+	// Push notifications to browsers when VAPID keys are configured
+	pushSender, err := webpush.NewSenderFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to set up web push: %v", err)
+	}
+	if pushSender == nil {
+		log.Println("Web push disabled: VAPID_PRIVATE_KEY is not set")
+	}
+	controller.InitPush(pushSender)
+
+	// Email digests go out through the configured mailer
+	mailClient, err := mailer.NewMailerFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to set up mailer: %v", err)
+	}
+	if mailClient == nil {
+		log.Println("Email disabled: MAILER is not set")
+	}
+	controller.InitMailer(mailClient)
+
+	// Publish scheduled posts in the background
+	controller.StartPostScheduler(30 * time.Second)
+
+	// Purge deleted posts once their recovery window has passed
+	controller.StartPostPurgeJob(time.Hour)
+
+	// Send notifications held back by quiet hours once those end
+	controller.StartHeldDeliveryJob(time.Minute)
+
+	// Email digests to users who have been away
+	controller.StartDigestJob(15 * time.Minute)
+
+	// Retry webhook deliveries that failed once their backoff has passed
+	controller.StartWebhookDeliveryJob(15 * time.Second)
 
 	// Catch-all route to serve index.html for SPA
 	// router.NoRoute(func(c *gin.Context) {
@@ -0,0 +1,176 @@
+package controller
+
+import (
+	"instacloneapp/server/pkg/db"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ArchivePost hides a post from the author's profile and from feeds while
+// keeping its likes and comments
+func ArchivePost() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		postID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid Post ID"})
+			return
+		}
+
+		userID, err := primitive.ObjectIDFromHex(getUserIDFromContext(c))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid User ID"})
+			return
+		}
+
+		post, err := dbInstance.GetPostByID(postID)
+		if err != nil || post.IsDeleted() {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Post not found"})
+			return
+		}
+
+		if post.Author != userID {
+			c.JSON(http.StatusForbidden, gin.H{"message": "Unauthorized"})
+			return
+		}
+
+		if !post.IsPublished() {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Only published posts can be archived"})
+			return
+		}
+
+		if post.Archived {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Post is already archived"})
+			return
+		}
+
+		err = dbInstance.UpdatePost(postID, bson.M{"$set": bson.M{"archived": true, "archivedAt": time.Now()}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error archiving post"})
+			return
+		}
+
+		err = dbInstance.RemovePostFromUser(userID, postID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error updating user posts"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Post archived",
+			"success": true,
+		})
+	}
+}
+
+// RestorePost brings back an archived post, or a deleted post that is still
+// inside its recovery window
+func RestorePost() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		postID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid Post ID"})
+			return
+		}
+
+		userID, err := primitive.ObjectIDFromHex(getUserIDFromContext(c))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid User ID"})
+			return
+		}
+
+		post, err := dbInstance.GetPostByID(postID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Post not found"})
+			return
+		}
+
+		if post.Author != userID {
+			c.JSON(http.StatusForbidden, gin.H{"message": "Unauthorized"})
+			return
+		}
+
+		var unset bson.M
+		switch {
+		case post.IsDeleted():
+			if time.Since(post.DeletedAt) > db.DeletedPostRetention {
+				c.JSON(http.StatusGone, gin.H{"message": "Post can no longer be restored"})
+				return
+			}
+			unset = bson.M{"deletedAt": ""}
+		case post.Archived:
+			unset = bson.M{"archived": "", "archivedAt": ""}
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Post is not archived or deleted"})
+			return
+		}
+
+		err = dbInstance.UpdatePost(postID, bson.M{"$unset": unset})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error restoring post"})
+			return
+		}
+
+		// A deleted post that was archived goes back to the archive rather than the profile
+		stillArchived := post.IsDeleted() && post.Archived
+		if post.IsPublished() && !stillArchived {
+			err = dbInstance.AddPostToUser(userID, postID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"message": "Error updating user posts"})
+				return
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Post restored",
+			"success": true,
+		})
+	}
+}
+
+// GetArchivedPosts lists the authenticated user's archived posts
+func GetArchivedPosts() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := primitive.ObjectIDFromHex(getUserIDFromContext(c))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid User ID"})
+			return
+		}
+
+		posts, err := dbInstance.GetArchivedPostsByUserID(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving archived posts"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"posts":   posts,
+			"success": true,
+		})
+	}
+}
+
+// GetDeletedPosts lists the authenticated user's deleted posts that can still be restored
+func GetDeletedPosts() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := primitive.ObjectIDFromHex(getUserIDFromContext(c))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid User ID"})
+			return
+		}
+
+		posts, err := dbInstance.GetDeletedPostsByUserID(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving deleted posts"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"posts":   posts,
+			"success": true,
+		})
+	}
+}
@@ -0,0 +1,293 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"instacloneapp/server/pkg/db"
+	"instacloneapp/server/utils"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// attachmentLimit describes which files an attachment type accepts. Each
+// limit can be overridden through the environment, e.g. MESSAGE_IMAGE_MAX_BYTES
+// and MESSAGE_IMAGE_TYPES for images.
+type attachmentLimit struct {
+	envPrefix    string
+	maxBytes     int64
+	mimeTypes    []string
+	resourceType string
+}
+
+var attachmentLimits = map[string]attachmentLimit{
+	db.AttachmentImage: {
+		envPrefix:    "MESSAGE_IMAGE",
+		maxBytes:     10 << 20,
+		mimeTypes:    []string{"image/jpeg", "image/png", "image/gif", "image/webp"},
+		resourceType: "image",
+	},
+	db.AttachmentVideo: {
+		envPrefix:    "MESSAGE_VIDEO",
+		maxBytes:     50 << 20,
+		mimeTypes:    []string{"video/mp4", "video/quicktime", "video/webm"},
+		resourceType: "video",
+	},
+	db.AttachmentVoice: {
+		envPrefix:    "MESSAGE_VOICE",
+		maxBytes:     5 << 20,
+		mimeTypes:    []string{"audio/mpeg", "audio/mp4", "audio/aac", "audio/ogg", "audio/webm", "audio/wav"},
+		resourceType: "video",
+	},
+}
+
+// attachmentFormOverhead is what a multipart message may carry besides the
+// file itself: the message text, the type and the multipart framing
+const attachmentFormOverhead = 1 << 20
+
+// sniffAliases lists the accepted types that share a file format with a
+// sniffed type. Only the declared type tells them apart.
+var sniffAliases = map[string][]string{
+	"video/mp4":       {"audio/mp4"},
+	"video/webm":      {"audio/webm"},
+	"application/ogg": {"audio/ogg"},
+	"audio/wave":      {"audio/wav"},
+}
+
+// messageInput is the content of a message being sent
+type messageInput struct {
+	Text       string
+	Attachment *db.Attachment
+}
+
+// parseMessageInput reads the text and optional attachment of a message being
+// sent by userID. Media is sent as multipart form data with the file in
+// "attachment"; a shared post is sent as JSON with "sharedPostId". Media is
+// uploaded right away, so callers check the sender may message first and call
+// discardUpload if the message isn't created after all. It writes the error
+// response itself and returns false when the request should stop.
+func parseMessageInput(c *gin.Context, userID primitive.ObjectID) (*messageInput, bool) {
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		return parseMediaMessage(c)
+	}
+
+	var req struct {
+		TextMessage  string `json:"textMessage"`
+		SharedPostID string `json:"sharedPostId"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid input"})
+		return nil, false
+	}
+
+	input := &messageInput{Text: req.TextMessage}
+	if req.SharedPostID != "" {
+		postID, err := primitive.ObjectIDFromHex(req.SharedPostID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid post ID"})
+			return nil, false
+		}
+
+		// Only posts the sender can see may be shared
+		post, err := dbInstance.GetPostByID(postID)
+		if err != nil || post == nil || !canViewPost(post, userID) {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Post not found"})
+			return nil, false
+		}
+		input.Attachment = &db.Attachment{Type: db.AttachmentPost, PostID: post.ID}
+	}
+
+	if strings.TrimSpace(input.Text) == "" && input.Attachment == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Message text or attachment is required"})
+		return nil, false
+	}
+	return input, true
+}
+
+// parseMediaMessage handles a multipart message carrying an uploaded image,
+// video or voice note. The request body is capped at the largest attachment
+// allowed before any of it is read, and the file's type is worked out from its
+// content rather than taken from the client.
+func parseMediaMessage(c *gin.Context) (*messageInput, bool) {
+	var maxRequestBytes int64
+	for _, limit := range attachmentLimits {
+		if maxBytes := utils.GetEnvInt64(limit.envPrefix+"_MAX_BYTES", limit.maxBytes); maxBytes > maxRequestBytes {
+			maxRequestBytes = maxBytes
+		}
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxRequestBytes+attachmentFormOverhead)
+
+	file, header, err := c.Request.FormFile("attachment")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"message": fmt.Sprintf("Attachment exceeds the %d byte limit", maxRequestBytes)})
+			return nil, false
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Attachment required"})
+		return nil, false
+	}
+	defer file.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Unreadable attachment"})
+		return nil, false
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error reading attachment"})
+		return nil, false
+	}
+	declared, _, _ := mime.ParseMediaType(header.Header.Get("Content-Type"))
+	mimeType := sniffMediaType(head[:n], declared)
+
+	attachmentType := c.PostForm("type")
+	if attachmentType == "" {
+		attachmentType = attachmentTypeFor(mimeType)
+	}
+
+	limit, ok := attachmentLimits[attachmentType]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Unsupported attachment type"})
+		return nil, false
+	}
+	if !containsString(utils.GetEnvList(limit.envPrefix+"_TYPES", limit.mimeTypes), mimeType) {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"message": fmt.Sprintf("%s is not an accepted %s format", mimeType, attachmentType)})
+		return nil, false
+	}
+	maxBytes := utils.GetEnvInt64(limit.envPrefix+"_MAX_BYTES", limit.maxBytes)
+	if header.Size > maxBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"message": fmt.Sprintf("Attachment exceeds the %d byte limit", maxBytes)})
+		return nil, false
+	}
+
+	url, err := utils.UploadMediaToCloudinary(cloudinaryClient, file, "messages", limit.resourceType)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error uploading attachment"})
+		return nil, false
+	}
+
+	return &messageInput{
+		Text: c.PostForm("textMessage"),
+		Attachment: &db.Attachment{
+			Type:     attachmentType,
+			URL:      url,
+			MimeType: mimeType,
+			Size:     header.Size,
+		},
+	}, true
+}
+
+// discardUpload deletes the file uploaded for a message that couldn't be
+// created, so failed sends don't leave orphaned media behind
+func discardUpload(input *messageInput) {
+	if input.Attachment == nil || input.Attachment.URL == "" {
+		return
+	}
+	limit, ok := attachmentLimits[input.Attachment.Type]
+	if !ok {
+		return
+	}
+	if err := utils.DeleteMediaFromCloudinary(cloudinaryClient, input.Attachment.URL, limit.resourceType); err != nil {
+		log.Printf("Error deleting attachment %s: %v", input.Attachment.URL, err)
+	}
+}
+
+// sniffMediaType works out the type of an uploaded file from its first bytes.
+// The type the client declared is only used to tell apart types that share a
+// file format, such as audio and video in an MP4 container.
+func sniffMediaType(head []byte, declared string) string {
+	var sniffed string
+	switch {
+	// QuickTime, MP4 files without an mp4 brand, and MP3 or AAC without an
+	// ID3 tag, which http.DetectContentType doesn't recognize
+	case len(head) >= 12 && string(head[4:8]) == "ftyp" && string(head[8:12]) == "qt  ":
+		sniffed = "video/quicktime"
+	case len(head) >= 12 && string(head[4:8]) == "ftyp":
+		sniffed = "video/mp4"
+	case len(head) >= 2 && head[0] == 0xFF && head[1]&0xF6 == 0xF0:
+		sniffed = "audio/aac"
+	case len(head) >= 2 && head[0] == 0xFF && head[1]&0xE0 == 0xE0:
+		sniffed = "audio/mpeg"
+	default:
+		sniffed, _, _ = mime.ParseMediaType(http.DetectContentType(head))
+	}
+
+	if containsString(sniffAliases[sniffed], declared) {
+		return declared
+	}
+	return sniffed
+}
+
+// attachmentTypeFor infers the attachment type from a MIME type
+func attachmentTypeFor(mimeType string) string {
+	switch {
+	case strings.HasPrefix(mimeType, "image/"):
+		return db.AttachmentImage
+	case strings.HasPrefix(mimeType, "video/"):
+		return db.AttachmentVideo
+	case strings.HasPrefix(mimeType, "audio/"):
+		return db.AttachmentVoice
+	}
+	return ""
+}
+
+// resolveSharedPosts fills in the preview of every shared post for the viewer.
+// Posts that were removed or that the viewer can't see are marked unavailable.
+func resolveSharedPosts(messages []db.Message, viewerID primitive.ObjectID) {
+	posts := make(map[primitive.ObjectID]*db.Post)
+	for i := range messages {
+		attachment := messages[i].Attachment
+		if attachment == nil || attachment.Type != db.AttachmentPost {
+			continue
+		}
+
+		post, seen := posts[attachment.PostID]
+		if !seen {
+			post, _ = dbInstance.GetPostByID(attachment.PostID)
+			posts[attachment.PostID] = post
+		}
+		attachment.Post = sharedPostPreview(post, attachment.PostID, viewerID)
+	}
+}
+
+// messageForViewer returns a copy of the message with any shared post resolved for the viewer
+func messageForViewer(message *db.Message, viewerID primitive.ObjectID) db.Message {
+	copied := *message
+	if copied.Attachment != nil {
+		attachment := *copied.Attachment
+		copied.Attachment = &attachment
+	}
+	messages := []db.Message{copied}
+	resolveSharedPosts(messages, viewerID)
+	return messages[0]
+}
+
+// sharedPostPreview builds the embedded preview of a shared post
+func sharedPostPreview(post *db.Post, postID, viewerID primitive.ObjectID) *db.SharedPost {
+	if post == nil || !canViewPost(post, viewerID) {
+		return &db.SharedPost{ID: postID, Unavailable: true}
+	}
+	return &db.SharedPost{
+		ID:      post.ID,
+		Image:   post.Image,
+		Caption: post.Caption,
+		Author:  post.Author,
+	}
+}
+
+// containsString checks if a string is present in a list
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
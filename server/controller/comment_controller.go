@@ -0,0 +1,534 @@
+package controller
+
+import (
+	"fmt"
+	"instacloneapp/server/pkg/db"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// GetCommentReplies retrieves a page of replies to a top-level comment
+func GetCommentReplies() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		commentID, err := primitive.ObjectIDFromHex(c.Param("comment_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid Comment ID"})
+			return
+		}
+
+		viewerID, _ := primitive.ObjectIDFromHex(getUserIDFromContext(c))
+
+		comment, ok := loadVisibleComment(commentID, viewerID)
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Comment not found"})
+			return
+		}
+
+		page, limit, skip := getPagination(c)
+		replies, err := dbInstance.GetCommentReplies(comment.ID, skip, limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving replies"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"replies": replies,
+			"page":    page,
+			"limit":   limit,
+			"total":   comment.ReplyCount,
+		})
+	}
+}
+
+// LikeComment handles liking a comment
+func LikeComment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		commentID, err := primitive.ObjectIDFromHex(c.Param("comment_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid Comment ID"})
+			return
+		}
+
+		userID, err := primitive.ObjectIDFromHex(getUserIDFromContext(c))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid User ID"})
+			return
+		}
+
+		if _, ok := loadVisibleComment(commentID, userID); !ok {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Comment not found"})
+			return
+		}
+
+		if err := dbInstance.AddLikeToComment(commentID, userID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error liking comment"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Comment liked",
+			"success": true,
+		})
+	}
+}
+
+// DislikeComment handles removing a like from a comment
+func DislikeComment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		commentID, err := primitive.ObjectIDFromHex(c.Param("comment_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid Comment ID"})
+			return
+		}
+
+		userID, err := primitive.ObjectIDFromHex(getUserIDFromContext(c))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid User ID"})
+			return
+		}
+
+		if _, ok := loadVisibleComment(commentID, userID); !ok {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Comment not found"})
+			return
+		}
+
+		if err := dbInstance.RemoveLikeFromComment(commentID, userID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error disliking comment"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Comment disliked",
+			"success": true,
+		})
+	}
+}
+
+// EditComment lets the author change the text of their comment
+func EditComment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		commentID, err := primitive.ObjectIDFromHex(c.Param("comment_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid Comment ID"})
+			return
+		}
+
+		userID, err := primitive.ObjectIDFromHex(getUserIDFromContext(c))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid User ID"})
+			return
+		}
+
+		var req struct {
+			Text string `json:"text"`
+		}
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request payload"})
+			return
+		}
+		if req.Text == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Text is required"})
+			return
+		}
+
+		comment, err := dbInstance.GetCommentByID(commentID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Comment not found"})
+			return
+		}
+
+		if comment.Author != userID {
+			c.JSON(http.StatusForbidden, gin.H{"message": "Unauthorized"})
+			return
+		}
+
+		mentions, err := resolveMentions(req.Text, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error resolving mentions"})
+			return
+		}
+
+		// Only users who weren't already mentioned get a new notification
+		var newMentions []db.Mention
+		for _, mention := range mentions {
+			alreadyMentioned := false
+			for _, previous := range comment.Mentions {
+				if previous.UserID == mention.UserID {
+					alreadyMentioned = true
+					break
+				}
+			}
+			if !alreadyMentioned {
+				newMentions = append(newMentions, mention)
+			}
+		}
+
+		comment.Text = req.Text
+		comment.Mentions = mentions
+		comment.UpdatedAt = time.Now()
+		err = dbInstance.UpdateComment(commentID, bson.M{"$set": bson.M{
+			"text":      comment.Text,
+			"mentions":  comment.Mentions,
+			"updatedAt": comment.UpdatedAt,
+		}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error updating comment"})
+			return
+		}
+
+		notifyMentions(newMentions, userID, comment.Post, comment.ID)
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Comment updated",
+			"comment": comment,
+			"success": true,
+		})
+	}
+}
+
+// DeleteComment deletes a comment and its replies. Both the comment author
+// and the owner of the post may delete it.
+func DeleteComment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		commentID, err := primitive.ObjectIDFromHex(c.Param("comment_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid Comment ID"})
+			return
+		}
+
+		userID, err := primitive.ObjectIDFromHex(getUserIDFromContext(c))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid User ID"})
+			return
+		}
+
+		comment, err := dbInstance.GetCommentByID(commentID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Comment not found"})
+			return
+		}
+
+		post, err := dbInstance.GetPostByID(comment.Post)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Post not found"})
+			return
+		}
+
+		if comment.Author != userID && post.Author != userID {
+			c.JSON(http.StatusForbidden, gin.H{"message": "Unauthorized"})
+			return
+		}
+
+		removed, err := dbInstance.DeleteCommentThread(commentID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error deleting comment"})
+			return
+		}
+		removedIDs := make([]primitive.ObjectID, 0, len(removed))
+		for _, removedComment := range removed {
+			removedIDs = append(removedIDs, removedComment.ID)
+		}
+
+		err = dbInstance.RemoveCommentsFromPost(post.ID, removedIDs)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error updating post comments"})
+			return
+		}
+
+		if containsAny(post.PinnedComments, removedIDs) {
+			err = dbInstance.UpdatePost(post.ID, bson.M{"$pullAll": bson.M{"pinnedComments": removedIDs}})
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"message": "Error updating pinned comments"})
+				return
+			}
+		}
+
+		if !comment.ParentID.IsZero() {
+			err = dbInstance.UpdateComment(comment.ParentID, bson.M{"$inc": bson.M{"replyCount": -1}})
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"message": "Error updating parent comment"})
+				return
+			}
+		}
+
+		withdrawCommentNotifications(post, comment, removed)
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Comment deleted",
+			"success": true,
+		})
+	}
+}
+
+// commentWithdrawal tells a connected user to drop a notification about a
+// comment that was deleted
+type commentWithdrawal struct {
+	Type      string             `json:"type"`
+	UserID    primitive.ObjectID `json:"userId"`
+	PostID    primitive.ObjectID `json:"postId"`
+	CommentID primitive.ObjectID `json:"commentId"`
+}
+
+// withdrawCommentNotifications takes back the comment, reply and mention
+// notifications of every comment removed along with thread, the comment that
+// was deleted
+func withdrawCommentNotifications(post *db.Post, thread *db.Comment, removed []db.Comment) {
+	for _, comment := range removed {
+		// Replies from before ReplyTo was recorded answered the thread
+		replyTo := comment.ReplyTo
+		if replyTo.IsZero() && !comment.ParentID.IsZero() {
+			if comment.ParentID == thread.ID {
+				replyTo = thread.Author
+			} else if parent, err := dbInstance.GetCommentByID(comment.ParentID); err == nil {
+				replyTo = parent.Author
+			}
+		}
+
+		notifications := []db.Notification{{RecipientID: post.Author, Type: db.NotificationComment}}
+		if !replyTo.IsZero() && replyTo != post.Author {
+			notifications = append(notifications, db.Notification{RecipientID: replyTo, Type: db.NotificationReply})
+		}
+		for _, mention := range comment.Mentions {
+			notifications = append(notifications, db.Notification{RecipientID: mention.UserID, Type: db.NotificationMention})
+		}
+
+		for _, notification := range notifications {
+			if notification.RecipientID == comment.Author {
+				continue
+			}
+			notification.ActorID = comment.Author
+			notification.PostID = post.ID
+			notification.CommentID = comment.ID
+			withdrawNotification(notification)
+			broadcastNotificationEvent(notification, commentWithdrawal{
+				Type:      "commentDeleted",
+				UserID:    comment.Author,
+				PostID:    post.ID,
+				CommentID: comment.ID,
+			})
+		}
+	}
+}
+
+// UpdateCommentSettings lets the post author turn comments off or limit who can comment
+func UpdateCommentSettings() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		postID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid Post ID"})
+			return
+		}
+
+		userID, err := primitive.ObjectIDFromHex(getUserIDFromContext(c))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid User ID"})
+			return
+		}
+
+		var req struct {
+			CommentsDisabled *bool  `json:"commentsDisabled"`
+			CommentAudience  string `json:"commentAudience"`
+		}
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request payload"})
+			return
+		}
+
+		post, err := dbInstance.GetPostByID(postID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Post not found"})
+			return
+		}
+
+		if post.Author != userID {
+			c.JSON(http.StatusForbidden, gin.H{"message": "Unauthorized"})
+			return
+		}
+
+		updateFields := bson.M{}
+		if req.CommentsDisabled != nil {
+			post.CommentsDisabled = *req.CommentsDisabled
+			updateFields["commentsDisabled"] = post.CommentsDisabled
+		}
+		switch req.CommentAudience {
+		case "":
+		case db.CommentAudienceEveryone, db.CommentAudienceFollowers, db.CommentAudienceFollowing:
+			post.CommentAudience = req.CommentAudience
+			updateFields["commentAudience"] = post.CommentAudience
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid comment audience"})
+			return
+		}
+
+		if len(updateFields) > 0 {
+			updateFields["updatedAt"] = time.Now()
+			if err := dbInstance.UpdatePost(postID, bson.M{"$set": updateFields}); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"message": "Error updating comment settings"})
+				return
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message":          "Comment settings updated",
+			"commentsDisabled": post.CommentsDisabled,
+			"commentAudience":  post.CommentAudience,
+			"success":          true,
+		})
+	}
+}
+
+// PinComment pins or unpins a top-level comment on the author's post
+func PinComment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		commentID, err := primitive.ObjectIDFromHex(c.Param("comment_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid Comment ID"})
+			return
+		}
+
+		userID, err := primitive.ObjectIDFromHex(getUserIDFromContext(c))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid User ID"})
+			return
+		}
+
+		comment, err := dbInstance.GetCommentByID(commentID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Comment not found"})
+			return
+		}
+
+		post, err := dbInstance.GetPostByID(comment.Post)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Post not found"})
+			return
+		}
+
+		if post.Author != userID {
+			c.JSON(http.StatusForbidden, gin.H{"message": "Unauthorized"})
+			return
+		}
+
+		if !comment.ParentID.IsZero() {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Only top-level comments can be pinned"})
+			return
+		}
+
+		// Unpin the comment if it's already pinned
+		if contains(post.PinnedComments, commentID) {
+			if err := dbInstance.UpdatePost(post.ID, bson.M{"$pull": bson.M{"pinnedComments": commentID}}); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"message": "Error unpinning comment"})
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{
+				"type":    "unpinned",
+				"message": "Comment unpinned",
+				"success": true,
+			})
+			return
+		}
+
+		pinned, err := dbInstance.PinComment(post.ID, commentID, db.MaxPinnedComments)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error pinning comment"})
+			return
+		}
+		if !pinned {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": fmt.Sprintf("You can pin up to %d comments", db.MaxPinnedComments),
+				"success": false,
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"type":    "pinned",
+			"message": "Comment pinned",
+			"success": true,
+		})
+	}
+}
+
+// checkCommentPermission reports whether a user may comment on a post. When
+// they may not, it returns a machine-readable reason and a message for the client.
+func checkCommentPermission(post *db.Post, userID primitive.ObjectID) (reason, message string, err error) {
+	if post.CommentsDisabled {
+		return "comments_disabled", "Comments are turned off for this post", nil
+	}
+
+	// Authors can always comment on their own posts
+	if post.Author == userID {
+		return "", "", nil
+	}
+
+	switch post.CommentAudience {
+	case db.CommentAudienceFollowers:
+		commenter, err := dbInstance.GetUserByID(userID)
+		if err != nil {
+			return "", "", err
+		}
+		if !contains(commenter.Following, post.Author) {
+			return "followers_only", "Only followers of the author can comment on this post", nil
+		}
+	case db.CommentAudienceFollowing:
+		author, err := dbInstance.GetUserByID(post.Author)
+		if err != nil {
+			return "", "", err
+		}
+		if !contains(author.Following, userID) {
+			return "following_only", "Only people the author follows can comment on this post", nil
+		}
+	}
+	return "", "", nil
+}
+
+// loadVisibleComment loads a comment, provided the viewer can see its post
+func loadVisibleComment(commentID, viewerID primitive.ObjectID) (*db.Comment, bool) {
+	comment, err := dbInstance.GetCommentByID(commentID)
+	if err != nil {
+		return nil, false
+	}
+	post, err := dbInstance.GetPostByID(comment.Post)
+	if err != nil || !canViewPost(post, viewerID) {
+		return nil, false
+	}
+	return comment, true
+}
+
+// pinnedCommentsFirst orders comments so pinned ones come first, in the order they were pinned
+func pinnedCommentsFirst(comments []db.Comment, pinned []primitive.ObjectID) []db.Comment {
+	if len(pinned) == 0 {
+		return comments
+	}
+
+	ordered := make([]db.Comment, 0, len(comments))
+	for _, pinnedID := range pinned {
+		for _, comment := range comments {
+			if comment.ID == pinnedID {
+				ordered = append(ordered, comment)
+				break
+			}
+		}
+	}
+	for _, comment := range comments {
+		if !contains(pinned, comment.ID) {
+			ordered = append(ordered, comment)
+		}
+	}
+	return ordered
+}
+
+// containsAny reports whether any of the IDs is present in the list
+func containsAny(list []primitive.ObjectID, ids []primitive.ObjectID) bool {
+	for _, id := range ids {
+		if contains(list, id) {
+			return true
+		}
+	}
+	return false
+}
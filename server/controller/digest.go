@@ -0,0 +1,314 @@
+package controller
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	htmltemplate "html/template"
+	"instacloneapp/server/pkg/db"
+	"instacloneapp/server/pkg/mailer"
+	"instacloneapp/server/pkg/webhook"
+	"instacloneapp/server/utils"
+	"log"
+	"net/url"
+	"os"
+	texttemplate "text/template"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// mailClient sends email. It's nil when no mailer is configured.
+var mailClient mailer.Mailer
+
+// InitMailer sets the mailer email digests are sent with
+func InitMailer(m mailer.Mailer) {
+	mailClient = m
+}
+
+const (
+	// digestInactiveAfter is how long a user has to be away before they get
+	// digests, unless DIGEST_INACTIVE_AFTER overrides it
+	digestInactiveAfter = 72 * time.Hour
+
+	// How much of each section a digest shows
+	digestMaxActivity  = 10
+	digestMaxFollowers = 5
+	digestMaxTopPosts  = 3
+
+	// A digest that fails to send is retried after digestRetryBase, doubling
+	// with each failure up to digestRetryMax
+	digestRetryBase = 15 * time.Minute
+	digestRetryMax  = 24 * time.Hour
+)
+
+var (
+	//go:embed templates/digest.html
+	digestHTML string
+	//go:embed templates/digest.txt
+	digestText string
+
+	digestHTMLTemplate = htmltemplate.Must(htmltemplate.New("digest").Parse(digestHTML))
+	digestTextTemplate = texttemplate.Must(texttemplate.New("digest").Parse(digestText))
+)
+
+// digestData is what the digest templates render
+type digestData struct {
+	Username       string
+	Frequency      string
+	Activity       []digestActivity
+	MoreActivity   int
+	NewFollowers   []digestFollower
+	MoreFollowers  int
+	TopPosts       []digestPost
+	AppURL         string
+	SettingsURL    string
+	UnsubscribeURL string
+}
+
+type digestActivity struct {
+	Summary string
+}
+
+type digestFollower struct {
+	Username string
+	URL      string
+}
+
+type digestPost struct {
+	Author  string
+	Caption string
+	Image   string
+	Likes   int
+	URL     string
+}
+
+// StartDigestJob emails digests to users who are due one. Each digest is
+// claimed atomically by the database, so the job can run on every instance.
+func StartDigestJob(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			sendDueDigests()
+		}
+	}()
+}
+
+// sendDueDigests claims and sends digests until nobody is due one
+func sendDueDigests() {
+	if mailClient == nil {
+		return
+	}
+
+	inactiveAfter := utils.GetEnvDuration("DIGEST_INACTIVE_AFTER", digestInactiveAfter)
+	for {
+		now := time.Now()
+		user, err := dbInstance.ClaimDigestRecipient(now, now.Add(-inactiveAfter))
+		if err != nil {
+			log.Printf("Error claiming digest recipient: %v", err)
+			return
+		}
+		if user == nil {
+			return
+		}
+
+		// Someone who's connected right now sees it all in the app
+		if isOnline(user.ID) {
+			continue
+		}
+		if err := sendDigest(user, now); err != nil {
+			log.Printf("Error sending digest to %s: %v", user.ID.Hex(), err)
+			// Retry it later rather than skipping a whole period, and move on
+			// to the next user in the meantime
+			failures := user.DigestFailures + 1
+			retryAt := now.Add(webhook.Backoff(failures, digestRetryBase, digestRetryMax))
+			if err := dbInstance.DeferDigestRecipient(user.ID, now, user.LastDigestAt, failures, retryAt); err != nil {
+				log.Printf("Error deferring digest of %s: %v", user.ID.Hex(), err)
+			}
+		}
+	}
+}
+
+// sendDigest emails the user what happened since their previous digest. It
+// sends nothing when there's nothing to tell.
+func sendDigest(user *db.User, now time.Time) error {
+	preferences := &user.NotificationPreferences
+	since := user.LastDigestAt
+	if since.IsZero() {
+		since = now.Add(-db.DigestIntervals[preferences.Digest()])
+	}
+
+	data, err := buildDigest(user, since)
+	if err != nil {
+		return err
+	}
+	if len(data.Activity) == 0 && len(data.NewFollowers) == 0 && len(data.TopPosts) == 0 {
+		return nil
+	}
+
+	msg, err := digestMessage(user, data)
+	if err != nil {
+		return err
+	}
+	return mailClient.Send(msg)
+}
+
+// digestMessage renders a digest as an email to the user
+func digestMessage(user *db.User, data *digestData) (mailer.Message, error) {
+	var text, html bytes.Buffer
+	if err := digestTextTemplate.Execute(&text, data); err != nil {
+		return mailer.Message{}, err
+	}
+	if err := digestHTMLTemplate.Execute(&html, data); err != nil {
+		return mailer.Message{}, err
+	}
+
+	return mailer.Message{
+		To:      user.Email,
+		Subject: digestSubject(data),
+		Text:    text.String(),
+		HTML:    html.String(),
+		Headers: map[string]string{
+			// Lets mail clients offer one-click unsubscribe (RFC 8058)
+			"List-Unsubscribe":      "<" + data.UnsubscribeURL + ">",
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+		},
+	}, nil
+}
+
+// buildDigest gathers the sections of a user's digest: their unread
+// notifications of the types they get by email, new followers among them, and
+// the most liked posts of accounts they follow
+func buildDigest(user *db.User, since time.Time) (*digestData, error) {
+	preferences := &user.NotificationPreferences
+	appURL := os.Getenv("URL")
+
+	unsubscribe, err := unsubscribeURL(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	data := &digestData{
+		Username:       user.Username,
+		Frequency:      preferences.Digest(),
+		AppURL:         appURL,
+		SettingsURL:    appURL + "/account/edit",
+		UnsubscribeURL: unsubscribe,
+	}
+
+	notifications, err := dbInstance.GetUnreadNotificationsSince(user.ID, since, 50)
+	if err != nil {
+		return nil, err
+	}
+	var activity []db.Notification
+	var followerIDs []primitive.ObjectID
+	for _, notification := range notifications {
+		if !preferences.Allows(notification.Type, db.ChannelEmail) || preferences.Mutes(notification) {
+			continue
+		}
+		if notification.Type == db.NotificationFollow {
+			for _, actorID := range notification.ActorIDs {
+				if !contains(notification.Withdrawn, actorID) {
+					followerIDs = appendUnique(followerIDs, actorID)
+				}
+			}
+			continue
+		}
+		activity = append(activity, notification)
+	}
+
+	if len(activity) > digestMaxActivity {
+		data.MoreActivity = len(activity) - digestMaxActivity
+		activity = activity[:digestMaxActivity]
+	}
+	entries, err := notificationEntries(activity)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		data.Activity = append(data.Activity, digestActivity{Summary: entry.Summary})
+	}
+
+	if len(followerIDs) > digestMaxFollowers {
+		data.MoreFollowers = len(followerIDs) - digestMaxFollowers
+		followerIDs = followerIDs[:digestMaxFollowers]
+	}
+	followers, err := getUserSummaries(followerIDs)
+	if err != nil {
+		return nil, err
+	}
+	for _, followerID := range followerIDs {
+		if follower, ok := followers[followerID]; ok {
+			data.NewFollowers = append(data.NewFollowers, digestFollower{
+				Username: follower.Username,
+				URL:      appURL + "/profile/" + follower.ID.Hex(),
+			})
+		}
+	}
+
+	posts, err := dbInstance.GetTopPostsByAuthors(user.Following, since, digestMaxTopPosts)
+	if err != nil {
+		return nil, err
+	}
+	var authorIDs []primitive.ObjectID
+	for _, post := range posts {
+		authorIDs = appendUnique(authorIDs, post.Author)
+	}
+	authors, err := getUserSummaries(authorIDs)
+	if err != nil {
+		return nil, err
+	}
+	for _, post := range posts {
+		data.TopPosts = append(data.TopPosts, digestPost{
+			Author:  authors[post.Author].Username,
+			Caption: post.Caption,
+			Image:   post.Image,
+			Likes:   len(post.Likes),
+			URL:     appURL + "/profile/" + post.Author.Hex(),
+		})
+	}
+	return data, nil
+}
+
+// digestSubject sums a digest up in its subject line
+func digestSubject(data *digestData) string {
+	activity := len(data.Activity) + data.MoreActivity
+	followers := len(data.NewFollowers) + data.MoreFollowers
+	switch {
+	case activity > 0 && followers > 0:
+		return fmt.Sprintf("%s and %s on Instaclone", countOf(activity, "new notification"), countOf(followers, "new follower"))
+	case activity > 0:
+		return fmt.Sprintf("You have %s on Instaclone", countOf(activity, "new notification"))
+	case followers > 0:
+		return fmt.Sprintf("You have %s on Instaclone", countOf(followers, "new follower"))
+	default:
+		return "Top posts from people you follow on Instaclone"
+	}
+}
+
+// countOf spells out a count of things, e.g. "1 new follower" or "2 new followers"
+func countOf(count int, thing string) string {
+	if count == 1 {
+		return "1 " + thing
+	}
+	return fmt.Sprintf("%d %ss", count, thing)
+}
+
+// unsubscribeURL is the link that turns off the user's email digest
+func unsubscribeURL(userID primitive.ObjectID) (string, error) {
+	token, err := utils.GenerateUnsubscribeToken(userID.Hex())
+	if err != nil {
+		return "", err
+	}
+	return apiURL() + "/api/v1/notifications/unsubscribe?token=" + url.QueryEscape(token), nil
+}
+
+// apiURL is where this server is reached from outside, for links in emails.
+// It comes from API_URL and defaults to the local port.
+func apiURL() string {
+	if value := os.Getenv("API_URL"); value != "" {
+		return value
+	}
+	return "http://localhost:" + os.Getenv("PORT")
+}
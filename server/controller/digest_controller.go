@@ -0,0 +1,80 @@
+package controller
+
+import (
+	"bytes"
+	htmltemplate "html/template"
+	"instacloneapp/server/middleware"
+	"instacloneapp/server/pkg/db"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// unsubscribePage is shown by unsubscribe links. Unsubscribing takes a POST,
+// so mail scanners following links don't unsubscribe anyone by accident.
+var unsubscribePage = htmltemplate.Must(htmltemplate.New("unsubscribe").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><title>Email digest</title></head>
+<body style="font-family:-apple-system,BlinkMacSystemFont,'Segoe UI',Roboto,Helvetica,Arial,sans-serif;color:#262626;max-width:480px;margin:48px auto;padding:0 16px;">
+{{if .Done}}
+<h1 style="font-size:20px;">You're unsubscribed</h1>
+<p>You won't get email digests anymore. You can turn them back on in your notification settings.</p>
+{{else}}
+<h1 style="font-size:20px;">Unsubscribe from email digests?</h1>
+<p>You'll stop getting emails about what you missed while you were away.</p>
+<form method="post" action="{{.Action}}">
+<button type="submit" style="padding:8px 16px;background:#0095f6;color:#ffffff;border:0;border-radius:6px;font-weight:600;cursor:pointer;">Unsubscribe</button>
+</form>
+{{end}}
+</body>
+</html>
+`))
+
+// ShowUnsubscribe asks the recipient of an email digest to confirm they want
+// to unsubscribe
+func ShowUnsubscribe() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, err := middleware.AuthenticateUnsubscribe(c); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid unsubscribe link"})
+			return
+		}
+
+		renderUnsubscribePage(c, gin.H{"Action": c.Request.URL.RequestURI()})
+	}
+}
+
+// Unsubscribe turns off the email digest of the user an unsubscribe link was
+// made for. Mail clients call it directly for one-click unsubscribe.
+func Unsubscribe() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := middleware.AuthenticateUnsubscribe(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid unsubscribe link"})
+			return
+		}
+		userID, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid unsubscribe link"})
+			return
+		}
+
+		update := bson.M{"$set": bson.M{"notificationPreferences.digestFrequency": db.DigestOff}}
+		if err := dbInstance.UpdateUser(userID, update); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error unsubscribing"})
+			return
+		}
+
+		renderUnsubscribePage(c, gin.H{"Done": true})
+	}
+}
+
+func renderUnsubscribePage(c *gin.Context, data gin.H) {
+	var page bytes.Buffer
+	if err := unsubscribePage.Execute(&page, data); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error rendering page"})
+		return
+	}
+	c.Data(http.StatusOK, "text/html; charset=utf-8", page.Bytes())
+}
@@ -0,0 +1,184 @@
+package controller
+
+import (
+	"bytes"
+	"instacloneapp/server/middleware"
+	"instacloneapp/server/pkg/db"
+	"instacloneapp/server/pkg/mailer"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// sendTestDigest renders a digest for the user and sends it through a
+// FileMailer, returning the email as it was written
+func sendTestDigest(t *testing.T, user *db.User, data *digestData) *mail.Message {
+	t.Helper()
+	msg, err := digestMessage(user, data)
+	if err != nil {
+		t.Fatalf("rendering digest: %v", err)
+	}
+
+	dir := t.TempDir()
+	fileMailer, err := mailer.NewFileMailer(dir, "Instaclone <no-reply@example.com>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fileMailer.Send(msg); err != nil {
+		t.Fatalf("sending digest: %v", err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("found %d emails (%v), want 1", len(files), err)
+	}
+	raw, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	email, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("parsing email: %v", err)
+	}
+	return email
+}
+
+// emailParts returns the decoded body of each part of a multipart email by
+// media type
+func emailParts(t *testing.T, email *mail.Message) map[string]string {
+	t.Helper()
+	mediaType, params, err := mime.ParseMediaType(email.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q (%v), want multipart/alternative", email.Header.Get("Content-Type"), err)
+	}
+
+	parts := make(map[string]string)
+	reader := multipart.NewReader(email.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return parts
+		}
+		if err != nil {
+			t.Fatalf("reading part: %v", err)
+		}
+		partType, _, err := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		if err != nil {
+			t.Fatalf("part Content-Type: %v", err)
+		}
+		// The reader undoes the quoted-printable encoding
+		body, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts[partType] = string(body)
+	}
+}
+
+func TestDigestEmail(t *testing.T) {
+	t.Setenv("SECRET_KEY", "digest-test-secret")
+	t.Setenv("API_URL", "https://api.example.com")
+
+	user := &db.User{ID: primitive.NewObjectID(), Username: "alice", Email: "alice@example.com"}
+	unsubscribe, err := unsubscribeURL(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	email := sendTestDigest(t, user, &digestData{
+		Username:       user.Username,
+		Frequency:      db.DigestWeekly,
+		Activity:       []digestActivity{{Summary: "bob and 2 others liked your post"}},
+		NewFollowers:   []digestFollower{{Username: "carol", URL: "https://app.example.com/profile/carol"}},
+		MoreFollowers:  2,
+		AppURL:         "https://app.example.com",
+		SettingsURL:    "https://app.example.com/account/edit",
+		UnsubscribeURL: unsubscribe,
+	})
+
+	if to := email.Header.Get("To"); to != user.Email {
+		t.Errorf("To = %q, want %q", to, user.Email)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(email.Header.Get("Subject"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "1 new notification and 3 new followers on Instaclone"; subject != want {
+		t.Errorf("Subject = %q, want %q", subject, want)
+	}
+	if got, want := email.Header.Get("List-Unsubscribe"), "<"+unsubscribe+">"; got != want {
+		t.Errorf("List-Unsubscribe = %q, want %q", got, want)
+	}
+	if got := email.Header.Get("List-Unsubscribe-Post"); got != "List-Unsubscribe=One-Click" {
+		t.Errorf("List-Unsubscribe-Post = %q, want List-Unsubscribe=One-Click", got)
+	}
+
+	parts := emailParts(t, email)
+	if len(parts) != 2 {
+		t.Errorf("email has parts %v, want text/plain and text/html", parts)
+	}
+	wants := map[string][]string{
+		"text/plain": {"Hi alice,", "bob and 2 others liked your post", "carol: https://app.example.com/profile/carol", "and 2 more", "Unsubscribe: " + unsubscribe},
+		"text/html":  {"bob and 2 others liked your post", "carol", `href="` + unsubscribe + `"`},
+	}
+	for partType, snippets := range wants {
+		body, ok := parts[partType]
+		if !ok {
+			t.Errorf("email has no %s part", partType)
+			continue
+		}
+		for _, snippet := range snippets {
+			if !strings.Contains(body, snippet) {
+				t.Errorf("%s part doesn't contain %q:\n%s", partType, snippet, body)
+			}
+		}
+	}
+}
+
+func TestDigestUnsubscribeLinkIdentifiesUser(t *testing.T) {
+	t.Setenv("SECRET_KEY", "digest-test-secret")
+	t.Setenv("API_URL", "https://api.example.com")
+	gin.SetMode(gin.TestMode)
+
+	user := &db.User{ID: primitive.NewObjectID(), Username: "alice", Email: "alice@example.com"}
+	unsubscribe, err := unsubscribeURL(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	email := sendTestDigest(t, user, &digestData{
+		Username:       user.Username,
+		Activity:       []digestActivity{{Summary: "bob liked your post"}},
+		UnsubscribeURL: unsubscribe,
+	})
+
+	// Mail clients POST to the List-Unsubscribe URL for one-click unsubscribe
+	link := strings.Trim(email.Header.Get("List-Unsubscribe"), "<>")
+	authenticate := func(link string) (string, error) {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, link, strings.NewReader("List-Unsubscribe=One-Click"))
+		return middleware.AuthenticateUnsubscribe(c)
+	}
+
+	id, err := authenticate(link)
+	if err != nil {
+		t.Fatalf("unsubscribe link rejected: %v", err)
+	}
+	if id != user.ID.Hex() {
+		t.Errorf("unsubscribe link identifies %s, want %s", id, user.ID.Hex())
+	}
+
+	// A link signed with another key is rejected
+	t.Setenv("SECRET_KEY", "another-secret")
+	if _, err := authenticate(link); err == nil {
+		t.Error("unsubscribe link signed with another key was accepted")
+	}
+}
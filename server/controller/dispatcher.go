@@ -0,0 +1,184 @@
+package controller
+
+import (
+	"instacloneapp/server/pkg/db"
+	"instacloneapp/server/socket"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Every realtime event and notification bound for a user leaves through this
+// file, so the recipient's notification preferences are applied in one place.
+
+// channelSenders deliver notifications on the channels that reach users right
+// away. The inbox is written by notifyUser itself and email only goes out in
+// digests, so neither is listed here.
+var channelSenders = map[string]func(recipientID primitive.ObjectID, entry notificationEntry){
+	db.ChannelRealtime: func(recipientID primitive.ObjectID, entry notificationEntry) {
+		broadcastToUser(recipientID, "notification", entry)
+	},
+	db.ChannelPush: sendPush,
+}
+
+// urgentNotificationTypes are delivered even during the recipient's quiet hours
+var urgentNotificationTypes = map[string]bool{
+	db.NotificationMessage: true,
+}
+
+// broadcastToUser pushes a realtime event to a single user
+func broadcastToUser(userID primitive.ObjectID, event string, payload interface{}) {
+	socket.BroadcastMessageToUser(userID.Hex(), event, payload)
+}
+
+// notifyUser delivers a notification as its recipient's preferences allow. It
+// is stored in the inbox, which is the source of truth for a recipient who is
+// offline, and sent on every other channel they haven't turned off for its
+// type, unless it's about something they muted. During quiet hours non-urgent
+// notifications are held back until the quiet hours end.
+//
+// Users aren't notified of their own actions, and events that don't tell the
+// recipient anything new, such as a like toggled off and on, only update the
+// inbox. A recipient who turned the inbox off for the type still gets a hidden
+// entry, so those events are recognized and not sent again either.
+func notifyUser(notification db.Notification) {
+	if notification.RecipientID.IsZero() || notification.RecipientID == notification.ActorID {
+		return
+	}
+
+	recipient, err := dbInstance.GetUserByID(notification.RecipientID)
+	if err != nil {
+		log.Printf("Error loading recipient of %s notification %s: %v", notification.Type, notification.RecipientID.Hex(), err)
+		return
+	}
+	preferences := &recipient.NotificationPreferences
+	if preferences.Mutes(notification) {
+		return
+	}
+
+	notification.GroupKey = groupKeyFor(notification)
+	notification.Hidden = !preferences.Allows(notification.Type, db.ChannelInApp)
+	stored, fresh, err := dbInstance.RecordNotification(notification, aggregationRuleFor(notification.Type))
+	if err != nil {
+		log.Printf("Error storing %s notification for %s: %v", notification.Type, notification.RecipientID.Hex(), err)
+		return
+	}
+	if !fresh {
+		return
+	}
+
+	channels := allowedChannels(preferences, notification.Type)
+	if len(channels) == 0 {
+		return
+	}
+
+	if !urgentNotificationTypes[notification.Type] {
+		if endsAt := preferences.QuietHours.EndsAt(time.Now()); !endsAt.IsZero() {
+			err := dbInstance.HoldDelivery(db.HeldDelivery{
+				RecipientID:    stored.RecipientID,
+				NotificationID: stored.ID,
+				Notification:   *stored,
+				Channels:       channels,
+				DeliverAt:      endsAt,
+			})
+			if err != nil {
+				log.Printf("Error holding %s notification for %s: %v", stored.Type, stored.RecipientID.Hex(), err)
+			}
+			return
+		}
+	}
+
+	deliverNotification(stored, channels)
+}
+
+// broadcastNotificationEvent pushes a realtime event that goes with a
+// notification but isn't one, such as a like being taken back, if the
+// recipient would get the notification itself in realtime
+func broadcastNotificationEvent(notification db.Notification, payload interface{}) {
+	recipient, err := dbInstance.GetUserByID(notification.RecipientID)
+	if err != nil {
+		log.Printf("Error loading recipient of %s event %s: %v", notification.Type, notification.RecipientID.Hex(), err)
+		return
+	}
+	preferences := &recipient.NotificationPreferences
+	if preferences.Mutes(notification) || !preferences.Allows(notification.Type, db.ChannelRealtime) {
+		return
+	}
+	broadcastToUser(notification.RecipientID, "notification", payload)
+}
+
+// allowedChannels lists the immediate channels a notification type may be
+// delivered on under the user's preferences
+func allowedChannels(preferences *db.NotificationPreferences, notificationType string) []string {
+	var channels []string
+	for channel := range channelSenders {
+		if preferences.Allows(notificationType, channel) {
+			channels = append(channels, channel)
+		}
+	}
+	return channels
+}
+
+// deliverNotification sends a notification on the given channels
+func deliverNotification(notification *db.Notification, channels []string) {
+	entries, err := notificationEntries([]db.Notification{*notification})
+	if err != nil {
+		log.Printf("Error loading actors of %s notification for %s: %v", notification.Type, notification.RecipientID.Hex(), err)
+		return
+	}
+
+	for _, channel := range channels {
+		if send, ok := channelSenders[channel]; ok {
+			send(notification.RecipientID, entries[0])
+		}
+	}
+}
+
+// StartHeldDeliveryJob sends notifications held back by quiet hours once those
+// end. Like the post scheduler it's safe to run on every server instance, as
+// each held delivery is claimed by exactly one of them.
+func StartHeldDeliveryJob(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			releaseHeldDeliveries()
+		}
+	}()
+}
+
+// releaseHeldDeliveries claims and sends held deliveries until none are due.
+// Preferences are checked again, as the recipient may have changed them while
+// the delivery was held.
+func releaseHeldDeliveries() {
+	for {
+		delivery, err := dbInstance.ClaimDueDelivery(time.Now())
+		if err != nil {
+			log.Printf("Error claiming held delivery: %v", err)
+			return
+		}
+		if delivery == nil {
+			return
+		}
+
+		recipient, err := dbInstance.GetUserByID(delivery.RecipientID)
+		if err != nil {
+			log.Printf("Error loading recipient of held delivery %s: %v", delivery.ID.Hex(), err)
+			continue
+		}
+		preferences := &recipient.NotificationPreferences
+		if preferences.Mutes(delivery.Notification) {
+			continue
+		}
+
+		var channels []string
+		for _, channel := range delivery.Channels {
+			if preferences.Allows(delivery.Notification.Type, channel) {
+				channels = append(channels, channel)
+			}
+		}
+		deliverNotification(&delivery.Notification, channels)
+	}
+}
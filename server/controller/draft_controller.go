@@ -0,0 +1,204 @@
+package controller
+
+import (
+	"errors"
+	"instacloneapp/server/pkg/db"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// GetDrafts lists the authenticated user's drafts and scheduled posts
+func GetDrafts() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := primitive.ObjectIDFromHex(getUserIDFromContext(c))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid User ID"})
+			return
+		}
+
+		drafts, err := dbInstance.GetDraftsByUserID(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving drafts"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"drafts":  drafts,
+			"success": true,
+		})
+	}
+}
+
+// EditDraft updates the caption or schedule of an unpublished post
+func EditDraft() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		postID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid Post ID"})
+			return
+		}
+
+		userID, err := primitive.ObjectIDFromHex(getUserIDFromContext(c))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid User ID"})
+			return
+		}
+
+		var req struct {
+			Caption     *string `json:"caption"`
+			Status      string  `json:"status"`
+			ScheduledAt string  `json:"scheduledAt"`
+		}
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid input"})
+			return
+		}
+
+		post, err := dbInstance.GetPostByID(postID)
+		if err != nil || post.Author != userID {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Draft not found"})
+			return
+		}
+
+		if post.IsPublished() || post.Status == db.PostStatusPublishing {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Post is already published"})
+			return
+		}
+
+		updateFields := bson.M{"updatedAt": time.Now()}
+		unsetFields := bson.M{}
+
+		if req.Caption != nil {
+			mentions, err := resolveMentions(*req.Caption, userID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"message": "Error resolving mentions"})
+				return
+			}
+			updateFields["caption"] = *req.Caption
+			updateFields["mentions"] = mentions
+		}
+
+		if req.Status != "" || req.ScheduledAt != "" {
+			status := req.Status
+			if status == "" {
+				status = post.Status
+			}
+			status, scheduledAt, err := parsePublishOptions(status, req.ScheduledAt)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+				return
+			}
+			if status == db.PostStatusPublished {
+				c.JSON(http.StatusBadRequest, gin.H{"message": "Use the publish endpoint to publish a draft"})
+				return
+			}
+
+			updateFields["status"] = status
+			if status == db.PostStatusScheduled {
+				updateFields["scheduledAt"] = scheduledAt
+			} else {
+				unsetFields["scheduledAt"] = ""
+			}
+		}
+
+		update := bson.M{"$set": updateFields}
+		if len(unsetFields) > 0 {
+			update["$unset"] = unsetFields
+		}
+		if err := dbInstance.UpdatePost(postID, update); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error updating draft"})
+			return
+		}
+
+		post, err = dbInstance.GetPostByID(postID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving draft"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Draft updated",
+			"post":    post,
+			"success": true,
+		})
+	}
+}
+
+// PublishDraft publishes a draft or scheduled post immediately
+func PublishDraft() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		postID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid Post ID"})
+			return
+		}
+
+		userID, err := primitive.ObjectIDFromHex(getUserIDFromContext(c))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid User ID"})
+			return
+		}
+
+		post, err := dbInstance.GetPostByID(postID)
+		if err != nil || post.Author != userID {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Draft not found"})
+			return
+		}
+
+		// The scheduler may publish the post at the same moment, so the claim decides who wins
+		published, err := dbInstance.PublishPost(postID, postPublishLease)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error publishing post"})
+			return
+		}
+		if published == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Post is already published"})
+			return
+		}
+
+		if err := finishPublishing(published); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error updating user with post"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Post published",
+			"post":    published,
+			"success": true,
+		})
+	}
+}
+
+// parsePublishOptions validates the requested post status and schedule time.
+// An empty status publishes immediately unless a schedule time is given.
+func parsePublishOptions(status, scheduledAt string) (string, time.Time, error) {
+	if status == "" {
+		status = db.PostStatusPublished
+		if scheduledAt != "" {
+			status = db.PostStatusScheduled
+		}
+	}
+
+	switch status {
+	case db.PostStatusPublished, db.PostStatusDraft:
+		return status, time.Time{}, nil
+	case db.PostStatusScheduled:
+		if scheduledAt == "" {
+			return "", time.Time{}, errors.New("scheduledAt is required for scheduled posts")
+		}
+		at, err := time.Parse(time.RFC3339, scheduledAt)
+		if err != nil {
+			return "", time.Time{}, errors.New("scheduledAt must be an RFC 3339 timestamp")
+		}
+		if !at.After(time.Now()) {
+			return "", time.Time{}, errors.New("scheduledAt must be in the future")
+		}
+		return status, at, nil
+	default:
+		return "", time.Time{}, errors.New("Invalid post status")
+	}
+}
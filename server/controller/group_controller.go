@@ -0,0 +1,559 @@
+package controller
+
+import (
+	"fmt"
+	"instacloneapp/server/pkg/db"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CreateGroup creates a named group conversation. The creator becomes its first admin.
+func CreateGroup() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := primitive.ObjectIDFromHex(getUserIDFromContext(c))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid User ID"})
+			return
+		}
+
+		var req struct {
+			Name    string   `json:"name"`
+			Members []string `json:"members"`
+		}
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid input"})
+			return
+		}
+
+		name := strings.TrimSpace(req.Name)
+		if name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Group name is required"})
+			return
+		}
+
+		members, err := parseMemberIDs(req.Members)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+			return
+		}
+		participants := appendUnique([]primitive.ObjectID{userID}, members...)
+
+		if len(participants) < db.MinGroupMembers || len(participants) > db.MaxGroupMembers {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": fmt.Sprintf("Groups must have between %d and %d members", db.MinGroupMembers, db.MaxGroupMembers),
+			})
+			return
+		}
+
+		if !checkNewGroupMembers(c, userID, removeID(participants, userID)) {
+			return
+		}
+
+		conversation, err := dbInstance.CreateGroupConversation(name, userID, participants)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error creating group"})
+			return
+		}
+
+		broadcastToConversation(conversation, "groupCreated", conversation, userID)
+
+		c.JSON(http.StatusCreated, gin.H{
+			"message":      "Group created",
+			"conversation": conversation,
+			"success":      true,
+		})
+	}
+}
+
+// GetGroup retrieves a group conversation the caller is a member of
+func GetGroup() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		conversation, _, ok := loadGroupForMember(c)
+		if !ok {
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"conversation": conversation,
+			"success":      true,
+		})
+	}
+}
+
+// AddGroupMembers lets a group admin add members
+func AddGroupMembers() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		conversation, userID, ok := loadGroupForMember(c)
+		if !ok {
+			return
+		}
+
+		if !contains(conversation.Admins, userID) {
+			c.JSON(http.StatusForbidden, gin.H{"message": "Only group admins can add members"})
+			return
+		}
+
+		var req struct {
+			Members []string `json:"members"`
+		}
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid input"})
+			return
+		}
+
+		members, err := parseMemberIDs(req.Members)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+			return
+		}
+
+		var added []primitive.ObjectID
+		for _, member := range members {
+			if !contains(conversation.Participants, member) && !contains(added, member) {
+				added = append(added, member)
+			}
+		}
+		if len(added) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "No new members to add"})
+			return
+		}
+
+		if len(conversation.Participants)+len(added) > db.MaxGroupMembers {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": fmt.Sprintf("Groups can have at most %d members", db.MaxGroupMembers),
+			})
+			return
+		}
+
+		if !checkNewGroupMembers(c, userID, added) {
+			return
+		}
+
+		err = dbInstance.UpdateConversation(conversation.ID, bson.M{
+			"$addToSet": bson.M{"participants": bson.M{"$each": added}},
+			"$set":      bson.M{"updatedAt": time.Now()},
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error adding members"})
+			return
+		}
+
+		conversation.Participants = append(conversation.Participants, added...)
+		broadcastToConversation(conversation, "groupMembersAdded", gin.H{
+			"conversationId": conversation.ID,
+			"members":        added,
+			"addedBy":        userID,
+		}, userID)
+
+		c.JSON(http.StatusOK, gin.H{
+			"message":      "Members added",
+			"conversation": conversation,
+			"success":      true,
+		})
+	}
+}
+
+// RemoveGroupMember lets a group admin remove a member
+func RemoveGroupMember() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		conversation, userID, ok := loadGroupForMember(c)
+		if !ok {
+			return
+		}
+
+		if !contains(conversation.Admins, userID) {
+			c.JSON(http.StatusForbidden, gin.H{"message": "Only group admins can remove members"})
+			return
+		}
+
+		memberID, err := primitive.ObjectIDFromHex(c.Param("user_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid member ID"})
+			return
+		}
+
+		if memberID == userID {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Use leave to remove yourself from a group"})
+			return
+		}
+
+		if !contains(conversation.Participants, memberID) {
+			c.JSON(http.StatusNotFound, gin.H{"message": "User is not a member of this group"})
+			return
+		}
+
+		if err := removeGroupMember(conversation, memberID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error removing member"})
+			return
+		}
+
+		payload := gin.H{
+			"conversationId": conversation.ID,
+			"member":         memberID,
+			"removedBy":      userID,
+		}
+		broadcastToConversation(conversation, "groupMemberRemoved", payload, userID)
+		broadcastToUser(memberID, "groupMemberRemoved", payload)
+
+		c.JSON(http.StatusOK, gin.H{
+			"message":      "Member removed",
+			"conversation": conversation,
+			"success":      true,
+		})
+	}
+}
+
+// SetGroupAdmin lets a group admin promote a member to admin or demote an admin
+func SetGroupAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		conversation, userID, ok := loadGroupForMember(c)
+		if !ok {
+			return
+		}
+
+		if !contains(conversation.Admins, userID) {
+			c.JSON(http.StatusForbidden, gin.H{"message": "Only group admins can change admins"})
+			return
+		}
+
+		memberID, err := primitive.ObjectIDFromHex(c.Param("user_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid member ID"})
+			return
+		}
+
+		var req struct {
+			Admin bool `json:"admin"`
+		}
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid input"})
+			return
+		}
+
+		if !contains(conversation.Participants, memberID) {
+			c.JSON(http.StatusNotFound, gin.H{"message": "User is not a member of this group"})
+			return
+		}
+
+		var update bson.M
+		if req.Admin {
+			update = bson.M{"$addToSet": bson.M{"admins": memberID}}
+			conversation.Admins = appendUnique(conversation.Admins, memberID)
+		} else {
+			if contains(conversation.Admins, memberID) && len(conversation.Admins) == 1 {
+				c.JSON(http.StatusBadRequest, gin.H{"message": "A group needs at least one admin"})
+				return
+			}
+			update = bson.M{"$pull": bson.M{"admins": memberID}}
+			conversation.Admins = removeID(conversation.Admins, memberID)
+		}
+		update["$set"] = bson.M{"updatedAt": time.Now()}
+
+		if err := dbInstance.UpdateConversation(conversation.ID, update); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error updating admins"})
+			return
+		}
+
+		broadcastToConversation(conversation, "groupAdminsUpdated", gin.H{
+			"conversationId": conversation.ID,
+			"admins":         conversation.Admins,
+		}, userID)
+
+		c.JSON(http.StatusOK, gin.H{
+			"message":      "Admins updated",
+			"conversation": conversation,
+			"success":      true,
+		})
+	}
+}
+
+// LeaveGroup removes the caller from a group. If the last admin leaves, the
+// longest-standing remaining member becomes admin.
+func LeaveGroup() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		conversation, userID, ok := loadGroupForMember(c)
+		if !ok {
+			return
+		}
+
+		if err := removeGroupMember(conversation, userID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error leaving group"})
+			return
+		}
+
+		broadcastToConversation(conversation, "groupMemberRemoved", gin.H{
+			"conversationId": conversation.ID,
+			"member":         userID,
+			"admins":         conversation.Admins,
+		}, userID)
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Left group",
+			"success": true,
+		})
+	}
+}
+
+// RenameGroup changes the name of a group. Any member can rename it.
+func RenameGroup() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		conversation, userID, ok := loadGroupForMember(c)
+		if !ok {
+			return
+		}
+
+		var req struct {
+			Name string `json:"name"`
+		}
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid input"})
+			return
+		}
+
+		name := strings.TrimSpace(req.Name)
+		if name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Group name is required"})
+			return
+		}
+
+		err := dbInstance.UpdateConversation(conversation.ID, bson.M{"$set": bson.M{"name": name, "updatedAt": time.Now()}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error renaming group"})
+			return
+		}
+
+		conversation.Name = name
+		broadcastToConversation(conversation, "groupRenamed", gin.H{
+			"conversationId": conversation.ID,
+			"name":           name,
+			"renamedBy":      userID,
+		}, userID)
+
+		c.JSON(http.StatusOK, gin.H{
+			"message":      "Group renamed",
+			"conversation": conversation,
+			"success":      true,
+		})
+	}
+}
+
+// SendGroupMessage sends a message to every member of a group
+func SendGroupMessage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		conversation, userID, ok := loadGroupForMember(c)
+		if !ok {
+			return
+		}
+
+		input, ok := parseMessageInput(c, userID)
+		if !ok {
+			return
+		}
+
+		newMessage, err := dbInstance.CreateMessage(db.Message{
+			ConversationID: conversation.ID,
+			SenderID:       userID,
+			Message:        input.Text,
+			Attachment:     input.Attachment,
+		})
+		if err != nil {
+			discardUpload(input)
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error creating message"})
+			return
+		}
+
+		err = dbInstance.RecordConversationMessage(conversation.ID, *newMessage, removeID(conversation.Participants, userID))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error updating conversation"})
+			return
+		}
+
+		// Shared posts are resolved per member since visibility depends on the viewer
+		for _, participant := range conversation.Participants {
+			if participant == userID {
+				continue
+			}
+			broadcastToUser(participant, "newMessage", messageForViewer(newMessage, participant))
+			notifyNewMessage(conversation, newMessage, participant)
+			if isOnline(participant) {
+				markDelivered(conversation.ID, participant)
+			}
+		}
+		emitMessageSent(conversation, newMessage)
+
+		c.JSON(http.StatusCreated, gin.H{
+			"success":    true,
+			"newMessage": messageForViewer(newMessage, userID),
+		})
+	}
+}
+
+// GetGroupMessages retrieves the messages of a group the caller is a member of
+func GetGroupMessages() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		conversation, userID, ok := loadGroupForMember(c)
+		if !ok {
+			return
+		}
+
+		messages, err := dbInstance.GetMessagesByIDs(conversation.Messages)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving messages"})
+			return
+		}
+
+		resolveSharedPosts(messages, userID)
+
+		// Fetching the conversation delivers any messages the caller hadn't received
+		markDelivered(conversation.ID, userID)
+
+		c.JSON(http.StatusOK, gin.H{
+			"success":  true,
+			"messages": messages,
+		})
+	}
+}
+
+// loadGroupForMember loads the group named by the :id parameter and checks that
+// the caller belongs to it. It writes the error response itself and returns
+// false when the request should stop.
+func loadGroupForMember(c *gin.Context) (*db.Conversation, primitive.ObjectID, bool) {
+	userID, err := primitive.ObjectIDFromHex(getUserIDFromContext(c))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid User ID"})
+		return nil, primitive.NilObjectID, false
+	}
+
+	conversationID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid conversation ID"})
+		return nil, primitive.NilObjectID, false
+	}
+
+	conversation, err := dbInstance.GetConversationByID(conversationID)
+	if err != nil || !conversation.IsGroup || !contains(conversation.Participants, userID) {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Group not found"})
+		return nil, primitive.NilObjectID, false
+	}
+
+	return conversation, userID, true
+}
+
+// removeGroupMember takes a member out of a group, handing the admin role to
+// the longest-standing member if the last admin goes, and refreshes the
+// conversation with the result. Both steps are single updates, so members
+// added, removed or promoted at the same time aren't lost.
+func removeGroupMember(conversation *db.Conversation, memberID primitive.ObjectID) error {
+	err := dbInstance.UpdateConversation(conversation.ID, bson.M{
+		"$pull": bson.M{"participants": memberID, "admins": memberID},
+		"$set":  bson.M{"updatedAt": time.Now()},
+	})
+	if err != nil {
+		return err
+	}
+
+	// The update checks for admins itself, so two admins leaving at once
+	// promote only one member
+	err = dbInstance.UpdateConversation(conversation.ID, bson.A{
+		bson.M{"$set": bson.M{"admins": bson.M{"$cond": bson.A{
+			bson.M{"$eq": bson.A{bson.M{"$size": bson.M{"$ifNull": bson.A{"$admins", bson.A{}}}}, 0}},
+			bson.M{"$slice": bson.A{"$participants", 1}},
+			"$admins",
+		}}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	updated, err := dbInstance.GetConversationByID(conversation.ID)
+	if err != nil {
+		return err
+	}
+	*conversation = *updated
+	return nil
+}
+
+// parseMemberIDs converts hex member IDs into ObjectIDs
+func parseMemberIDs(members []string) ([]primitive.ObjectID, error) {
+	ids := make([]primitive.ObjectID, 0, len(members))
+	for _, member := range members {
+		id, err := primitive.ObjectIDFromHex(member)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid member ID: %s", member)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// checkNewGroupMembers checks that the adder may put each of the members in a
+// group. Group messages don't go through the requests folder, so a member has
+// to be someone the adder could message directly: neither blocked the other,
+// and the member follows the adder or has accepted a conversation with them.
+// It writes the error response itself and returns false when the request
+// should stop.
+func checkNewGroupMembers(c *gin.Context, adderID primitive.ObjectID, memberIDs []primitive.ObjectID) bool {
+	adder, err := dbInstance.GetUserByID(adderID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "User not found"})
+		return false
+	}
+	members, err := dbInstance.GetUsersByIDs(memberIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error checking members"})
+		return false
+	}
+	if len(members) != len(memberIDs) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "One or more members do not exist"})
+		return false
+	}
+
+	for _, member := range members {
+		if contains(adder.Blocked, member.ID) || contains(member.Blocked, adderID) {
+			c.JSON(http.StatusForbidden, gin.H{"message": "You can't add " + member.Username + " to a group"})
+			return false
+		}
+		if contains(member.Following, adderID) {
+			continue
+		}
+
+		conversation, err := dbInstance.GetConversation(adderID, member.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error checking members"})
+			return false
+		}
+		if conversation == nil || conversation.IsPendingFor(member.ID) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"message": "You can only add people who follow you or have accepted a conversation with you",
+			})
+			return false
+		}
+	}
+	return true
+}
+
+// appendUnique appends the IDs that are not yet in the list
+func appendUnique(list []primitive.ObjectID, ids ...primitive.ObjectID) []primitive.ObjectID {
+	for _, id := range ids {
+		if !contains(list, id) {
+			list = append(list, id)
+		}
+	}
+	return list
+}
+
+// removeID returns the list without the given ID
+func removeID(list []primitive.ObjectID, id primitive.ObjectID) []primitive.ObjectID {
+	result := make([]primitive.ObjectID, 0, len(list))
+	for _, existing := range list {
+		if existing != id {
+			result = append(result, existing)
+		}
+	}
+	return result
+}
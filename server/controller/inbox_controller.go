@@ -0,0 +1,109 @@
+package controller
+
+import (
+	"instacloneapp/server/pkg/db"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// userSummary is the public part of a user shown next to conversations and messages
+type userSummary struct {
+	ID             primitive.ObjectID `json:"id"`
+	Username       string             `json:"username"`
+	ProfilePicture string             `json:"profilePicture,omitempty"`
+}
+
+// inboxEntry is a single conversation as listed in the caller's inbox
+type inboxEntry struct {
+	ID           primitive.ObjectID   `json:"id"`
+	IsGroup      bool                 `json:"isGroup,omitempty"`
+	Name         string               `json:"name,omitempty"`
+	Participants []userSummary        `json:"participants"`
+	LastMessage  *db.MessagePreview   `json:"lastMessage,omitempty"`
+	UnreadCount  int                  `json:"unreadCount"`
+	Admins       []primitive.ObjectID `json:"admins,omitempty"`
+	CreatedAt    time.Time            `json:"createdAt"`
+	UpdatedAt    time.Time            `json:"updatedAt"`
+}
+
+// GetConversations lists the caller's conversations, most recently active first
+func GetConversations() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := primitive.ObjectIDFromHex(getUserIDFromContext(c))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid User ID"})
+			return
+		}
+
+		page, limit, skip := getPagination(c)
+		conversations, err := dbInstance.GetConversationsByUser(userID, skip, limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving conversations"})
+			return
+		}
+
+		// Load every participant on the page in one query
+		var participantIDs []primitive.ObjectID
+		for _, conversation := range conversations {
+			participantIDs = appendUnique(participantIDs, conversation.Participants...)
+		}
+		summaries, err := getUserSummaries(participantIDs)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving participants"})
+			return
+		}
+
+		entries := make([]inboxEntry, 0, len(conversations))
+		for _, conversation := range conversations {
+			participants := make([]userSummary, 0, len(conversation.Participants))
+			for _, participantID := range conversation.Participants {
+				if summary, ok := summaries[participantID]; ok {
+					participants = append(participants, summary)
+				}
+			}
+
+			entries = append(entries, inboxEntry{
+				ID:           conversation.ID,
+				IsGroup:      conversation.IsGroup,
+				Name:         conversation.Name,
+				Participants: participants,
+				LastMessage:  conversation.LastMessage,
+				UnreadCount:  conversation.UnreadCountFor(userID),
+				Admins:       conversation.Admins,
+				CreatedAt:    conversation.CreatedAt,
+				UpdatedAt:    conversation.UpdatedAt,
+			})
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"success":       true,
+			"conversations": entries,
+			"page":          page,
+			"limit":         limit,
+		})
+	}
+}
+
+// getUserSummaries loads the public summary of each user, keyed by ID
+func getUserSummaries(ids []primitive.ObjectID) (map[primitive.ObjectID]userSummary, error) {
+	summaries := make(map[primitive.ObjectID]userSummary, len(ids))
+	if len(ids) == 0 {
+		return summaries, nil
+	}
+
+	users, err := dbInstance.GetUsersByIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, user := range users {
+		summaries[user.ID] = userSummary{
+			ID:             user.ID,
+			Username:       user.Username,
+			ProfilePicture: user.ProfilePicture,
+		}
+	}
+	return summaries, nil
+}
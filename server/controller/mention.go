@@ -0,0 +1,80 @@
+package controller
+
+import (
+	"instacloneapp/server/pkg/db"
+	"instacloneapp/server/utils"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// resolveMentions turns the @username references in text into mention entities.
+// Unknown usernames and users on either side of a block with the author are skipped.
+func resolveMentions(text string, authorID primitive.ObjectID) ([]db.Mention, error) {
+	matches := utils.ParseMentions(text)
+	if len(matches) == 0 {
+		return nil, nil
+	}
+
+	usernames := make([]string, 0, len(matches))
+	for _, match := range matches {
+		usernames = append(usernames, match.Username)
+	}
+
+	users, err := dbInstance.GetUsersByUsernames(usernames)
+	if err != nil {
+		return nil, err
+	}
+
+	author, err := dbInstance.GetUserByID(authorID)
+	if err != nil {
+		return nil, err
+	}
+
+	byUsername := make(map[string]db.User, len(users))
+	for _, user := range users {
+		byUsername[user.Username] = user
+	}
+
+	var mentions []db.Mention
+	for _, match := range matches {
+		user, ok := byUsername[match.Username]
+		if !ok {
+			continue
+		}
+		if contains(author.Blocked, user.ID) || contains(user.Blocked, authorID) {
+			continue
+		}
+		mentions = append(mentions, db.Mention{
+			UserID:   user.ID,
+			Username: user.Username,
+			Offset:   match.Offset,
+			Length:   match.Length,
+		})
+	}
+	return mentions, nil
+}
+
+// notifyMentions notifies every mentioned user once, except the author
+// mentioning themselves
+func notifyMentions(mentions []db.Mention, authorID, postID, commentID primitive.ObjectID) {
+	notified := make(map[primitive.ObjectID]bool)
+	for _, mention := range mentions {
+		if mention.UserID == authorID || notified[mention.UserID] {
+			continue
+		}
+		notified[mention.UserID] = true
+
+		notification := db.Notification{
+			RecipientID: mention.UserID,
+			Type:        db.NotificationMention,
+			ActorID:     authorID,
+			PostID:      postID,
+			CommentID:   commentID,
+			Message:     "You were mentioned in a post",
+		}
+		if !commentID.IsZero() {
+			notification.Message = "You were mentioned in a comment"
+		}
+		notifyUser(notification)
+	}
+}
@@ -0,0 +1,257 @@
+package controller
+
+import (
+	"instacloneapp/server/pkg/db"
+	"instacloneapp/server/utils"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// defaultMessageEditWindow is how long after sending a message it can be edited,
+// unless MESSAGE_EDIT_WINDOW overrides it
+const defaultMessageEditWindow = 15 * time.Minute
+
+// maxReactionLength bounds a reaction to a single emoji, including modifiers and joiners
+const maxReactionLength = 16
+
+// EditMessage lets the sender change a message within the edit window. The
+// previous text is kept in the message's edit history.
+func EditMessage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		message, conversation, userID, ok := loadMessageForParticipant(c)
+		if !ok {
+			return
+		}
+
+		var req struct {
+			TextMessage string `json:"textMessage"`
+		}
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid input"})
+			return
+		}
+		if strings.TrimSpace(req.TextMessage) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Message text is required"})
+			return
+		}
+
+		if message.SenderID != userID {
+			c.JSON(http.StatusForbidden, gin.H{"message": "Only the sender can edit a message"})
+			return
+		}
+		if message.Unsent {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Message was unsent"})
+			return
+		}
+		if time.Since(message.CreatedAt) > utils.GetEnvDuration("MESSAGE_EDIT_WINDOW", defaultMessageEditWindow) {
+			c.JSON(http.StatusForbidden, gin.H{"message": "Message can no longer be edited"})
+			return
+		}
+
+		editedAt := time.Now()
+		err := dbInstance.UpdateMessage(message.ID, bson.M{
+			"$push": bson.M{"editHistory": db.MessageEdit{Text: message.Message, EditedAt: editedAt}},
+			"$set":  bson.M{"message": req.TextMessage, "editedAt": editedAt},
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error editing message"})
+			return
+		}
+
+		if conversation.LastMessage != nil && conversation.LastMessage.ID == message.ID {
+			updateLastMessagePreview(conversation.ID, req.TextMessage)
+		}
+
+		message.EditHistory = append(message.EditHistory, db.MessageEdit{Text: message.Message, EditedAt: editedAt})
+		message.Message = req.TextMessage
+		message.EditedAt = editedAt
+
+		broadcastToConversation(conversation, "messageEdited", gin.H{
+			"conversationId": conversation.ID,
+			"messageId":      message.ID,
+			"message":        message.Message,
+			"editedAt":       editedAt,
+		}, userID)
+
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": message,
+		})
+	}
+}
+
+// UnsendMessage removes a message's content for everyone in the conversation
+func UnsendMessage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		message, conversation, userID, ok := loadMessageForParticipant(c)
+		if !ok {
+			return
+		}
+
+		if message.SenderID != userID {
+			c.JSON(http.StatusForbidden, gin.H{"message": "Only the sender can unsend a message"})
+			return
+		}
+		if message.Unsent {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Message was already unsent"})
+			return
+		}
+
+		err := dbInstance.UpdateMessage(message.ID, bson.M{
+			"$set":   bson.M{"unsent": true, "message": ""},
+			"$unset": bson.M{"editHistory": "", "reactions": "", "attachment": ""},
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error unsending message"})
+			return
+		}
+
+		if conversation.LastMessage != nil && conversation.LastMessage.ID == message.ID {
+			updateLastMessagePreview(conversation.ID, "")
+		}
+
+		broadcastToConversation(conversation, "messageUnsent", gin.H{
+			"conversationId": conversation.ID,
+			"messageId":      message.ID,
+		}, userID)
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Message unsent",
+			"success": true,
+		})
+	}
+}
+
+// ReactToMessage sets the caller's emoji reaction on a message, replacing any
+// reaction they left before
+func ReactToMessage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		message, conversation, userID, ok := loadMessageForParticipant(c)
+		if !ok {
+			return
+		}
+
+		var req struct {
+			Emoji string `json:"emoji"`
+		}
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid input"})
+			return
+		}
+
+		emoji := strings.TrimSpace(req.Emoji)
+		if emoji == "" || len(emoji) > maxReactionLength || !utf8.ValidString(emoji) || strings.ContainsAny(emoji, " \t\n") {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Reaction must be a single emoji"})
+			return
+		}
+		if message.Unsent {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Message was unsent"})
+			return
+		}
+
+		reaction := db.Reaction{UserID: userID, Emoji: emoji, At: time.Now()}
+		reacted, err := dbInstance.SetMessageReaction(message.ID, reaction)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error reacting to message"})
+			return
+		}
+		// The message may have been unsent since it was loaded
+		if !reacted {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Message was unsent"})
+			return
+		}
+
+		broadcastToConversation(conversation, "messageReaction", gin.H{
+			"conversationId": conversation.ID,
+			"messageId":      message.ID,
+			"userId":         userID,
+			"emoji":          emoji,
+			"action":         "added",
+		}, userID)
+
+		c.JSON(http.StatusOK, gin.H{
+			"success":  true,
+			"reaction": reaction,
+		})
+	}
+}
+
+// RemoveReaction removes the caller's reaction from a message
+func RemoveReaction() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		message, conversation, userID, ok := loadMessageForParticipant(c)
+		if !ok {
+			return
+		}
+
+		if err := dbInstance.UpdateMessage(message.ID, bson.M{"$pull": bson.M{"reactions": bson.M{"userId": userID}}}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error removing reaction"})
+			return
+		}
+
+		broadcastToConversation(conversation, "messageReaction", gin.H{
+			"conversationId": conversation.ID,
+			"messageId":      message.ID,
+			"userId":         userID,
+			"action":         "removed",
+		}, userID)
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Reaction removed",
+			"success": true,
+		})
+	}
+}
+
+// loadMessageForParticipant loads the message named by the :id parameter along
+// with its conversation and checks that the caller takes part in it. The
+// recipient of a pending message request can't act on its messages, since
+// that would show the sender the request was opened. It writes the error
+// response itself and returns false when the request should stop.
+func loadMessageForParticipant(c *gin.Context) (*db.Message, *db.Conversation, primitive.ObjectID, bool) {
+	userID, err := primitive.ObjectIDFromHex(getUserIDFromContext(c))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid User ID"})
+		return nil, nil, primitive.NilObjectID, false
+	}
+
+	messageID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid message ID"})
+		return nil, nil, primitive.NilObjectID, false
+	}
+
+	message, err := dbInstance.GetMessageByID(messageID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Message not found"})
+		return nil, nil, primitive.NilObjectID, false
+	}
+
+	conversation, err := dbInstance.GetConversationByID(message.ConversationID)
+	if err != nil || !contains(conversation.Participants, userID) {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Message not found"})
+		return nil, nil, primitive.NilObjectID, false
+	}
+	if conversation.IsPendingFor(userID) {
+		c.JSON(http.StatusForbidden, gin.H{"message": "Accept the message request first"})
+		return nil, nil, primitive.NilObjectID, false
+	}
+
+	return message, conversation, userID, true
+}
+
+// updateLastMessagePreview keeps the inbox preview in step with an edited or unsent message
+func updateLastMessagePreview(conversationID primitive.ObjectID, text string) {
+	runes := []rune(text)
+	if len(runes) > db.MessagePreviewLength {
+		runes = runes[:db.MessagePreviewLength]
+	}
+	// The preview is cosmetic, so a failure here shouldn't fail the request
+	_ = dbInstance.UpdateConversation(conversationID, bson.M{"$set": bson.M{"lastMessage.text": string(runes)}})
+}
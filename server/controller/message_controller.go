@@ -1,28 +1,22 @@
 package controller
 
 import (
+	"instacloneapp/server/pkg/db"
 	"instacloneapp/server/socket"
 	"net/http"
 
 	// "instacloneapp/server/services"
 
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // SendMessage handles sending a message
 func SendMessage() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		senderID := c.Param("id")
-		receiverID := c.Param("receiver_id")
-		var req struct {
-			TextMessage string `json:"textMessage"`
-		}
-		if err := c.BindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid input"})
-			return
-		}
+		// The sender is the authenticated user and :id names the receiver
+		senderID := getUserIDFromContext(c)
+		receiverID := c.Param("id")
 
 		senderObjectID, err := primitive.ObjectIDFromHex(senderID)
 		if err != nil {
@@ -35,44 +29,68 @@ func SendMessage() gin.HandlerFunc {
 			return
 		}
 
-		// Check if conversation exists
-		conversation, err := dbInstance.GetConversation(senderObjectID, receiverObjectID)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving conversation"})
+		// Check if conversation exists and whether the sender may message the receiver
+		conversation, asRequest, ok := directConversationFor(c, senderObjectID, receiverObjectID)
+		if !ok {
 			return
 		}
 
-		if conversation == nil {
+		input, ok := parseMessageInput(c, senderObjectID)
+		if !ok {
+			return
+		}
+
+		switch {
+		case conversation == nil && asRequest:
+			conversation, err = dbInstance.CreateMessageRequest(senderObjectID, receiverObjectID)
+		case conversation == nil:
 			conversation, err = dbInstance.CreateConversation(senderObjectID, receiverObjectID)
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"message": "Error creating conversation"})
-				return
-			}
+		case conversation.IsPendingFor(senderObjectID):
+			// Replying to a request accepts it
+			err = dbInstance.AcceptMessageRequest(conversation.ID)
+			conversation.Status, conversation.RequestedOf = "", primitive.NilObjectID
+		}
+		if err != nil {
+			discardUpload(input)
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error creating conversation"})
+			return
 		}
 
 		// Create a new message
-		newMessage, err := dbInstance.CreateMessage(senderObjectID, receiverObjectID, req.TextMessage)
+		newMessage, err := dbInstance.CreateMessage(db.Message{
+			ConversationID: conversation.ID,
+			SenderID:       senderObjectID,
+			ReceiverID:     receiverObjectID,
+			Message:        input.Text,
+			Attachment:     input.Attachment,
+		})
 		if err != nil {
+			discardUpload(input)
 			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error creating message"})
 			return
 		}
 
-		conversation.Messages = append(conversation.Messages, newMessage.ID)
-		err = dbInstance.UpdateConversation(conversation.ID, bson.M{"$set": bson.M{"messages": conversation.Messages}})
+		err = dbInstance.RecordConversationMessage(conversation.ID, *newMessage, []primitive.ObjectID{receiverObjectID})
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error updating conversation"})
 			return
 		}
 
+		notifyNewMessage(conversation, newMessage, receiverObjectID)
+		emitMessageSent(conversation, newMessage)
+
 		// Send real-time notification
-		receiverSocketID := socket.GetReceiverSocketID(receiverObjectID.Hex())
-		if receiverSocketID != "" {
-			socket.BroadcastMessageToUser(receiverSocketID, "newMessage", newMessage)
+		if isOnline(receiverObjectID) {
+			broadcastToUser(receiverObjectID, "newMessage", messageForViewer(newMessage, receiverObjectID))
+			// Receipts stay hidden from the sender until the request is accepted
+			if !conversation.IsPendingFor(receiverObjectID) {
+				markDelivered(conversation.ID, receiverObjectID)
+			}
 		}
 
 		c.JSON(http.StatusCreated, gin.H{
 			"success":    true,
-			"newMessage": newMessage,
+			"newMessage": messageForViewer(newMessage, senderObjectID),
 		})
 	}
 }
@@ -80,8 +98,9 @@ func SendMessage() gin.HandlerFunc {
 // GetMessages handles retrieving messages from a conversation
 func GetMessages() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		senderID := c.Param("id")
-		receiverID := c.Param("receiver_id")
+		// The caller is the authenticated user and :id names the other participant
+		senderID := getUserIDFromContext(c)
+		receiverID := c.Param("id")
 
 		senderObjectID, err := primitive.ObjectIDFromHex(senderID)
 		if err != nil {
@@ -111,9 +130,67 @@ func GetMessages() gin.HandlerFunc {
 			return
 		}
 
+		resolveSharedPosts(messages, senderObjectID)
+
+		// Fetching the conversation delivers any messages the caller hadn't
+		// received, unless it's a request they haven't accepted yet
+		if !conversation.IsPendingFor(senderObjectID) {
+			markDelivered(conversation.ID, senderObjectID)
+		}
+
 		c.JSON(http.StatusOK, gin.H{
 			"success":  true,
 			"messages": messages,
 		})
 	}
 }
+
+// notifyNewMessage adds a message notification to the recipient's inbox.
+// Muting the conversation silences it on every channel, push included; the
+// newMessage event carrying the message to an open chat is sent regardless,
+// as muting quiets a conversation without hiding it.
+func notifyNewMessage(conversation *db.Conversation, message *db.Message, recipientID primitive.ObjectID) {
+	text := "You have a new message"
+	if conversation.IsPendingFor(recipientID) {
+		text = "You have a new message request"
+	}
+
+	notifyUser(db.Notification{
+		RecipientID:    recipientID,
+		Type:           db.NotificationMessage,
+		ActorID:        message.SenderID,
+		ConversationID: conversation.ID,
+		MessageID:      message.ID,
+		Message:        text,
+	})
+}
+
+// emitMessageSent tells the participants' webhooks a message was sent. The
+// text stays out of the payload; integrations only learn that it happened.
+func emitMessageSent(conversation *db.Conversation, message *db.Message) {
+	data := gin.H{
+		"messageId":      message.ID,
+		"conversationId": conversation.ID,
+		"senderId":       message.SenderID,
+		"isGroup":        conversation.IsGroup,
+	}
+	if message.Attachment != nil {
+		data["attachmentType"] = message.Attachment.Type
+	}
+	emitWebhookEvent(db.EventMessageSent, conversation.Participants, data)
+}
+
+// broadcastToConversation pushes a realtime event to every participant of a
+// conversation except the given user, usually the one who triggered it
+func broadcastToConversation(conversation *db.Conversation, event string, payload interface{}, except primitive.ObjectID) {
+	for _, participant := range conversation.Participants {
+		if participant != except {
+			broadcastToUser(participant, event, payload)
+		}
+	}
+}
+
+// isOnline reports whether the user has an open realtime connection
+func isOnline(userID primitive.ObjectID) bool {
+	return socket.IsOnline(userID.Hex())
+}
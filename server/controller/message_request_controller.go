@@ -0,0 +1,244 @@
+package controller
+
+import (
+	"instacloneapp/server/pkg/db"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// GetMessageRequests lists the conversations started by people the caller
+// doesn't follow that are waiting for an answer
+func GetMessageRequests() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := primitive.ObjectIDFromHex(getUserIDFromContext(c))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid User ID"})
+			return
+		}
+
+		page, limit, skip := getPagination(c)
+		conversations, err := dbInstance.GetMessageRequests(userID, skip, limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving message requests"})
+			return
+		}
+
+		senderIDs := make([]primitive.ObjectID, 0, len(conversations))
+		for _, conversation := range conversations {
+			senderIDs = appendUnique(senderIDs, conversation.CreatedBy)
+		}
+		summaries, err := getUserSummaries(senderIDs)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving participants"})
+			return
+		}
+
+		entries := make([]inboxEntry, 0, len(conversations))
+		for _, conversation := range conversations {
+			var participants []userSummary
+			if summary, ok := summaries[conversation.CreatedBy]; ok {
+				participants = append(participants, summary)
+			}
+
+			entries = append(entries, inboxEntry{
+				ID:           conversation.ID,
+				Participants: participants,
+				LastMessage:  conversation.LastMessage,
+				UnreadCount:  conversation.UnreadCountFor(userID),
+				CreatedAt:    conversation.CreatedAt,
+				UpdatedAt:    conversation.UpdatedAt,
+			})
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"success":  true,
+			"requests": entries,
+			"page":     page,
+			"limit":    limit,
+		})
+	}
+}
+
+// AcceptMessageRequest moves a request into the caller's inbox
+func AcceptMessageRequest() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		conversation, userID, ok := loadRequestForRecipient(c)
+		if !ok {
+			return
+		}
+
+		if err := dbInstance.AcceptMessageRequest(conversation.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error accepting request"})
+			return
+		}
+
+		// The sender can see receipts from now on, starting with delivery of what they sent
+		markDelivered(conversation.ID, userID)
+		broadcastToUser(conversation.CreatedBy, "requestAccepted", gin.H{
+			"conversationId": conversation.ID,
+			"userId":         userID,
+		})
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Request accepted",
+			"success": true,
+		})
+	}
+}
+
+// DeleteMessageRequest removes a request and its messages
+func DeleteMessageRequest() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		conversation, _, ok := loadRequestForRecipient(c)
+		if !ok {
+			return
+		}
+
+		if err := dbInstance.DeleteConversation(conversation.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error deleting request"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Request deleted",
+			"success": true,
+		})
+	}
+}
+
+// BlockMessageRequest blocks the sender of a request and removes it
+func BlockMessageRequest() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		conversation, userID, ok := loadRequestForRecipient(c)
+		if !ok {
+			return
+		}
+
+		err := dbInstance.UpdateUser(userID, bson.M{"$addToSet": bson.M{"blocked": conversation.CreatedBy}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error blocking user"})
+			return
+		}
+
+		if err := dbInstance.DeleteConversation(conversation.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error deleting request"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "User blocked",
+			"success": true,
+		})
+	}
+}
+
+// UpdateMessageSettings changes who may send the caller message requests
+func UpdateMessageSettings() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := primitive.ObjectIDFromHex(getUserIDFromContext(c))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid User ID"})
+			return
+		}
+
+		var req struct {
+			MessagePrivacy string `json:"messagePrivacy"`
+		}
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid input"})
+			return
+		}
+
+		switch req.MessagePrivacy {
+		case db.MessagePrivacyEveryone, db.MessagePrivacyFollowers, db.MessagePrivacyNobody:
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"message": "messagePrivacy must be everyone, followers or nobody"})
+			return
+		}
+
+		err = dbInstance.UpdateUser(userID, bson.M{"$set": bson.M{"messagePrivacy": req.MessagePrivacy}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error updating settings"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"success":        true,
+			"messagePrivacy": req.MessagePrivacy,
+		})
+	}
+}
+
+// directConversationFor finds the direct conversation between sender and
+// receiver and checks that the sender may message the receiver. When there is
+// no conversation yet, asRequest tells whether a new one has to start as a
+// message request. It writes the error response itself and returns false when
+// the request should stop.
+func directConversationFor(c *gin.Context, senderID, receiverID primitive.ObjectID) (conversation *db.Conversation, asRequest bool, ok bool) {
+	if senderID == receiverID {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "You can't message yourself"})
+		return nil, false, false
+	}
+
+	sender, err := dbInstance.GetUserByID(senderID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "User not found"})
+		return nil, false, false
+	}
+	receiver, err := dbInstance.GetUserByID(receiverID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "User not found"})
+		return nil, false, false
+	}
+
+	if contains(sender.Blocked, receiverID) || contains(receiver.Blocked, senderID) {
+		c.JSON(http.StatusForbidden, gin.H{"message": "You can't message this user"})
+		return nil, false, false
+	}
+
+	conversation, err = dbInstance.GetConversation(senderID, receiverID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving conversation"})
+		return nil, false, false
+	}
+	if conversation != nil {
+		return conversation, false, true
+	}
+
+	// People the receiver follows go straight to their inbox
+	if contains(receiver.Following, senderID) {
+		return nil, false, true
+	}
+	if !receiver.AllowsMessageRequestFrom(&sender) {
+		c.JSON(http.StatusForbidden, gin.H{"message": "This user doesn't accept message requests"})
+		return nil, false, false
+	}
+	return nil, true, true
+}
+
+// loadRequestForRecipient loads the message request named by the :id parameter
+// and checks that it awaits the caller's answer. It writes the error response
+// itself and returns false when the request should stop.
+func loadRequestForRecipient(c *gin.Context) (*db.Conversation, primitive.ObjectID, bool) {
+	userID, err := primitive.ObjectIDFromHex(getUserIDFromContext(c))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid User ID"})
+		return nil, primitive.NilObjectID, false
+	}
+
+	conversationID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid conversation ID"})
+		return nil, primitive.NilObjectID, false
+	}
+
+	conversation, err := dbInstance.GetConversationByID(conversationID)
+	if err != nil || !conversation.IsPendingFor(userID) {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Request not found"})
+		return nil, primitive.NilObjectID, false
+	}
+	return conversation, userID, true
+}
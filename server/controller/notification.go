@@ -0,0 +1,96 @@
+package controller
+
+import (
+	"encoding/json"
+	"instacloneapp/server/pkg/db"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// defaultAggregationRules say how each notification type is grouped. Mentions
+// are personal enough to always stand on their own.
+var defaultAggregationRules = map[string]db.AggregationRule{
+	db.NotificationLike:          {Window: 24 * time.Hour, MaxActors: 3},
+	db.NotificationComment:       {Window: time.Hour, MaxActors: 3},
+	db.NotificationReply:         {Window: time.Hour, MaxActors: 3},
+	db.NotificationFollow:        {Window: 24 * time.Hour, MaxActors: 3},
+	db.NotificationFollowRequest: {Window: 24 * time.Hour, MaxActors: 3},
+	db.NotificationMessage:       {Window: time.Hour, MaxActors: 3, Repeats: true},
+}
+
+var (
+	aggregationRules     map[string]db.AggregationRule
+	aggregationRulesOnce sync.Once
+)
+
+// aggregationRuleFor returns the aggregation rule of a notification type. The
+// defaults can be overridden per type with NOTIFICATION_AGGREGATION, e.g.
+// {"like":{"window":"12h","maxActors":5},"follow":{"window":"0s"}}
+func aggregationRuleFor(notificationType string) db.AggregationRule {
+	aggregationRulesOnce.Do(func() {
+		aggregationRules = make(map[string]db.AggregationRule, len(defaultAggregationRules))
+		for notificationType, rule := range defaultAggregationRules {
+			aggregationRules[notificationType] = rule
+		}
+
+		value := os.Getenv("NOTIFICATION_AGGREGATION")
+		if value == "" {
+			return
+		}
+		var overrides map[string]struct {
+			Window    string `json:"window"`
+			MaxActors int    `json:"maxActors"`
+			Repeats   *bool  `json:"repeats"`
+		}
+		if err := json.Unmarshal([]byte(value), &overrides); err != nil {
+			log.Printf("Invalid NOTIFICATION_AGGREGATION: %v, using defaults", err)
+			return
+		}
+		for notificationType, override := range overrides {
+			rule := aggregationRules[notificationType]
+			if override.Window != "" {
+				window, err := time.ParseDuration(override.Window)
+				if err != nil {
+					log.Printf("Invalid aggregation window for %s: %v, keeping %s", notificationType, err, rule.Window)
+				} else {
+					rule.Window = window
+				}
+			}
+			if override.MaxActors > 0 {
+				rule.MaxActors = override.MaxActors
+			}
+			if override.Repeats != nil {
+				rule.Repeats = *override.Repeats
+			}
+			aggregationRules[notificationType] = rule
+		}
+	})
+	return aggregationRules[notificationType]
+}
+
+// groupKeyFor names the target a notification is about, which together with
+// its type decides which events are grouped
+func groupKeyFor(notification db.Notification) string {
+	switch notification.Type {
+	case db.NotificationFollow, db.NotificationFollowRequest, db.NotificationFollowAccept:
+		return ""
+	case db.NotificationMessage:
+		return notification.ConversationID.Hex()
+	case db.NotificationMention:
+		if !notification.CommentID.IsZero() {
+			return notification.CommentID.Hex()
+		}
+	}
+	return notification.PostID.Hex()
+}
+
+// withdrawNotification takes back an actor's part in a notification whose
+// cause was undone, such as a like removed
+func withdrawNotification(notification db.Notification) {
+	groupKey := groupKeyFor(notification)
+	if err := dbInstance.WithdrawNotification(notification.RecipientID, notification.ActorID, notification.Type, groupKey); err != nil {
+		log.Printf("Error withdrawing %s notification for %s: %v", notification.Type, notification.RecipientID.Hex(), err)
+	}
+}
@@ -0,0 +1,196 @@
+package controller
+
+import (
+	"fmt"
+	"instacloneapp/server/pkg/db"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// notificationEntry is a notification as shown to its recipient, with the
+// latest actors resolved and a summary of the whole group
+type notificationEntry struct {
+	db.Notification
+	Actors  []userSummary `json:"actors"`
+	Summary string        `json:"summary"`
+}
+
+// notificationVerbs describe what the actors of each notification type did
+var notificationVerbs = map[string]string{
+	db.NotificationLike:          "liked your post",
+	db.NotificationComment:       "commented on your post",
+	db.NotificationReply:         "replied to your comment",
+	db.NotificationFollow:        "started following you",
+	db.NotificationFollowRequest: "requested to follow you",
+	db.NotificationFollowAccept:  "accepted your follow request",
+	db.NotificationMention:       "mentioned you",
+	db.NotificationMessage:       "sent you a message",
+}
+
+// notificationEntries resolves the actors of notifications and summarizes them
+func notificationEntries(notifications []db.Notification) ([]notificationEntry, error) {
+	var actorIDs []primitive.ObjectID
+	for _, notification := range notifications {
+		actorIDs = append(actorIDs, notification.LatestActors...)
+	}
+	summaries, err := getUserSummaries(actorIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]notificationEntry, 0, len(notifications))
+	for _, notification := range notifications {
+		entry := notificationEntry{Notification: notification, Actors: []userSummary{}}
+		for _, actorID := range notification.LatestActors {
+			if summary, ok := summaries[actorID]; ok {
+				entry.Actors = append(entry.Actors, summary)
+			}
+		}
+		entry.Summary = summarizeNotification(notification, entry.Actors)
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// summarizeNotification describes a notification group in one line, such as
+// "alice and 499 others liked your post"
+func summarizeNotification(notification db.Notification, actors []userSummary) string {
+	verb, ok := notificationVerbs[notification.Type]
+	if !ok || len(actors) == 0 {
+		return notification.Message
+	}
+	if notification.Type == db.NotificationMessage && notification.EventCount > 1 {
+		verb = fmt.Sprintf("sent you %d messages", notification.EventCount)
+	}
+
+	others := notification.ActorCount - 1
+	switch {
+	case others <= 0:
+		return fmt.Sprintf("%s %s", actors[0].Username, verb)
+	case others == 1 && len(actors) > 1:
+		return fmt.Sprintf("%s and %s %s", actors[0].Username, actors[1].Username, verb)
+	case others == 1:
+		return fmt.Sprintf("%s and 1 other %s", actors[0].Username, verb)
+	default:
+		return fmt.Sprintf("%s and %d others %s", actors[0].Username, others, verb)
+	}
+}
+
+// GetNotifications retrieves a page of the caller's notifications, most
+// recently active first, along with their unread count
+func GetNotifications() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := primitive.ObjectIDFromHex(getUserIDFromContext(c))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid User ID"})
+			return
+		}
+
+		page, limit, skip := getPagination(c)
+		notifications, err := dbInstance.GetNotificationsByUser(userID, skip, limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving notifications"})
+			return
+		}
+
+		entries, err := notificationEntries(notifications)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving notifications"})
+			return
+		}
+
+		unread, err := dbInstance.CountUnreadNotifications(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error counting notifications"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"success":       true,
+			"notifications": entries,
+			"unreadCount":   unread,
+			"page":          page,
+			"limit":         limit,
+		})
+	}
+}
+
+// GetUnreadNotificationCount returns the number shown on the notifications badge
+func GetUnreadNotificationCount() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := primitive.ObjectIDFromHex(getUserIDFromContext(c))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid User ID"})
+			return
+		}
+
+		unread, err := dbInstance.CountUnreadNotifications(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error counting notifications"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"success":     true,
+			"unreadCount": unread,
+		})
+	}
+}
+
+// MarkNotificationRead marks one of the caller's notifications as read
+func MarkNotificationRead() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := primitive.ObjectIDFromHex(getUserIDFromContext(c))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid User ID"})
+			return
+		}
+
+		notificationID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid notification ID"})
+			return
+		}
+
+		if err := dbInstance.MarkNotificationRead(userID, notificationID); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Notification not found"})
+			return
+		}
+
+		unread, err := dbInstance.CountUnreadNotifications(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error counting notifications"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"success":     true,
+			"unreadCount": unread,
+		})
+	}
+}
+
+// MarkAllNotificationsRead marks every notification of the caller as read
+func MarkAllNotificationsRead() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := primitive.ObjectIDFromHex(getUserIDFromContext(c))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid User ID"})
+			return
+		}
+
+		marked, err := dbInstance.MarkAllNotificationsRead(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error marking notifications read"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"success":     true,
+			"read":        marked,
+			"unreadCount": 0,
+		})
+	}
+}
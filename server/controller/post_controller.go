@@ -3,7 +3,6 @@ package controller
 import (
 	"fmt"
 	"instacloneapp/server/pkg/db"
-	"instacloneapp/server/socket"
 	"instacloneapp/server/utils"
 	"net/http"
 	"time"
@@ -15,32 +14,58 @@ import (
 
 // getUserIDFromContext retrieves the user ID from the Gin context
 func getUserIDFromContext(c *gin.Context) string {
-	if userID, exists := c.Get("userId"); exists {
+	if userID, exists := c.Get("userID"); exists {
 		return userID.(string)
 	}
 	return ""
 }
 
-// AddNewPost handles adding a new post
+// canViewPost reports whether the viewer may see a post. Drafts, scheduled
+// and archived posts are only visible to their author, deleted posts to no one,
+// and posts of private accounts to the followers they approved.
+func canViewPost(post *db.Post, viewerID primitive.ObjectID) bool {
+	if post.IsDeleted() {
+		return false
+	}
+	if post.Author == viewerID {
+		return true
+	}
+	return post.IsPublished() && !post.Archived && canViewContentOf(post.Author, viewerID)
+}
+
+// AddNewPost handles adding a new post. The post can also be saved as a draft
+// or scheduled to go live later, in which case the image is uploaded now and
+// the post is published by the scheduler.
 func AddNewPost() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Extract author ID from URL parameters
+		// Extract author ID from URL parameters, falling back to the authenticated user
 		authorID := c.Param("author_id")
+		if authorID == "" {
+			authorID = getUserIDFromContext(c)
+		}
 		authorIDObjectID, err := primitive.ObjectIDFromHex(authorID)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid author ID"})
 			return
 		}
 
-		// Parse caption from the request body
+		// Parse caption and publishing options from the request body
 		var req struct {
-			Caption string `json:"caption"`
+			Caption     string `json:"caption" form:"caption"`
+			Status      string `json:"status" form:"status"`
+			ScheduledAt string `json:"scheduledAt" form:"scheduledAt"`
 		}
-		if err := c.BindJSON(&req); err != nil {
+		if err := c.ShouldBind(&req); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid input"})
 			return
 		}
 
+		status, scheduledAt, err := parsePublishOptions(req.Status, req.ScheduledAt)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+			return
+		}
+
 		// Get the image from form data
 		image, _, err := c.Request.FormFile("image")
 		if err != nil {
@@ -55,13 +80,32 @@ func AddNewPost() gin.HandlerFunc {
 			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error uploading image"})
 			return
 		}
+
+		// Resolve @mentions in the caption
+		mentions, err := resolveMentions(req.Caption, authorIDObjectID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error resolving mentions"})
+			return
+		}
+
 		// Create a Post object
 		postInput := db.Post{
-			Caption:   req.Caption,
-			Image:     imageURL,
-			Author:    authorIDObjectID,
-			CreatedAt: time.Now(),
+			Caption:     req.Caption,
+			Image:       imageURL,
+			Author:      authorIDObjectID,
+			Mentions:    mentions,
+			Status:      status,
+			ScheduledAt: scheduledAt,
+			CreatedAt:   time.Now(),
+		}
+		// A post published right away is claimed like a scheduled one, so the
+		// scheduler finishes publishing it if this request doesn't
+		if status == db.PostStatusPublished {
+			postInput.Status = db.PostStatusPublishing
+			postInput.PublishLeaseEnds = postInput.CreatedAt.Add(postPublishLease)
+			postInput.PublishLease = primitive.NewObjectID()
 		}
+
 		// Create a new post in the database
 		post, err := dbInstance.CreatePost(postInput)
 		if err != nil {
@@ -69,8 +113,22 @@ func AddNewPost() gin.HandlerFunc {
 			return
 		}
 
+		// Drafts and scheduled posts stay private until they are published
+		if status != db.PostStatusPublished {
+			message := "Draft saved"
+			if status == db.PostStatusScheduled {
+				message = "Post scheduled"
+			}
+			c.JSON(http.StatusCreated, gin.H{
+				"message": message,
+				"post":    post,
+				"success": true,
+			})
+			return
+		}
+
 		// Update user by adding the post ID to the user's posts array
-		err = dbInstance.AddPostToUser(authorIDObjectID, post.ID)
+		err = finishPublishing(post)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error updating user with post"})
 			return
@@ -79,20 +137,27 @@ func AddNewPost() gin.HandlerFunc {
 		// Return success response
 		c.JSON(http.StatusCreated, gin.H{
 			"message": "New post added",
-			"post":    postInput,
+			"post":    post,
 			"success": true,
 		})
 	}
 }
 
-// GetAllPosts retrieves all posts
+// GetAllPosts retrieves all posts the caller can see
 func GetAllPosts() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		viewerID, _ := primitive.ObjectIDFromHex(getUserIDFromContext(c))
+
 		posts, err := dbInstance.GetAllPosts()
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving posts"})
 			return
 		}
+		posts, err = visiblePosts(posts, viewerID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving posts"})
+			return
+		}
 
 		c.JSON(http.StatusOK, gin.H{
 			"posts":   posts,
@@ -111,6 +176,12 @@ func GetUserPosts() gin.HandlerFunc {
 			return
 		}
 
+		viewerID, _ := primitive.ObjectIDFromHex(getUserIDFromContext(c))
+		if !canViewContentOf(authorIDObjectID, viewerID) {
+			c.JSON(http.StatusForbidden, gin.H{"message": "This account is private"})
+			return
+		}
+
 		posts, err := dbInstance.GetPostsByUserID(authorIDObjectID)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving posts"})
@@ -127,8 +198,8 @@ func GetUserPosts() gin.HandlerFunc {
 // LikePost handles liking a post
 func LikePost() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userID := c.Param("user_id")
-		postID := c.Param("post_id")
+		userID := getUserIDFromContext(c)
+		postID := c.Param("id")
 
 		userIDObjectID, err := primitive.ObjectIDFromHex(userID)
 		if err != nil {
@@ -142,32 +213,33 @@ func LikePost() gin.HandlerFunc {
 			return
 		}
 
-		// Like the post
-		err = dbInstance.AddLikeToPost(postIDObjectID, userIDObjectID)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error liking post"})
+		post, err := dbInstance.GetPostByID(postIDObjectID)
+		if err != nil || !canViewPost(post, userIDObjectID) {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Post not found"})
 			return
 		}
 
-		// Notify the post owner
-		post, err := dbInstance.GetPostByID(postIDObjectID)
+		// Like the post
+		added, err := dbInstance.AddLikeToPost(postIDObjectID, userIDObjectID)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving post"})
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error liking post"})
 			return
 		}
 
-		postOwnerID := post.Author.Hex()
-		if postOwnerID != userID {
-			notification := bson.M{
-				"type":    "like",
-				"userId":  userID,
-				"postId":  postID,
-				"message": "Your post was liked",
-			}
-			socketID := socket.GetReceiverSocketID(postOwnerID)
-			if socketID != "" {
-				socket.BroadcastMessageToUser(socketID, "notification", notification)
-			}
+		// Liking a post twice changes nothing, so there's nothing to tell anyone
+		if added {
+			notifyUser(db.Notification{
+				RecipientID: post.Author,
+				Type:        db.NotificationLike,
+				ActorID:     userIDObjectID,
+				PostID:      postIDObjectID,
+				Message:     "Your post was liked",
+			})
+			emitWebhookEvent(db.EventPostLiked, []primitive.ObjectID{userIDObjectID, post.Author}, gin.H{
+				"postId":   postIDObjectID,
+				"authorId": post.Author,
+				"userId":   userIDObjectID,
+			})
 		}
 
 		c.JSON(http.StatusOK, gin.H{
@@ -177,6 +249,15 @@ func LikePost() gin.HandlerFunc {
 	}
 }
 
+// likeWithdrawal tells a connected post owner to drop a like that was taken
+// back. It only carries IDs; clients already know the users and posts in their
+// notifications.
+type likeWithdrawal struct {
+	Type   string             `json:"type"`
+	UserID primitive.ObjectID `json:"userId"`
+	PostID primitive.ObjectID `json:"postId"`
+}
+
 // DislikePost handles the logic for disliking a post
 func DislikePost() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -194,7 +275,7 @@ func DislikePost() gin.HandlerFunc {
 			return
 		}
 		post, err := dbInstance.GetPostByID(postID)
-		if err != nil {
+		if err != nil || !canViewPost(post, userID) {
 			c.JSON(http.StatusNotFound, gin.H{"message": "Post not found"})
 			return
 		}
@@ -205,27 +286,20 @@ func DislikePost() gin.HandlerFunc {
 			return
 		}
 
-		// Implement socket.io for real-time notification
-		user, err := dbInstance.GetUserByID(userID)
-		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"message": "User not found"})
-			return
-		}
-
-		postOwnerID := post.Author.Hex()
-		if postOwnerID != userID.Hex() {
-			notification := bson.M{
-				"type":    "dislike",
-				"userId":  userID,
-				"user":    user,
-				"postId":  postID,
-				"message": "Your post was disliked",
-			}
+		// Take back the like notification and let a connected owner drop it too
+		withdrawNotification(db.Notification{
+			RecipientID: post.Author,
+			Type:        db.NotificationLike,
+			ActorID:     userID,
+			PostID:      postID,
+		})
 
-			socketID := socket.GetReceiverSocketID(postOwnerID)
-			if socketID != "" {
-				socket.BroadcastMessageToUser(socketID, "notification", notification)
-			}
+		if post.Author != userID {
+			broadcastNotificationEvent(db.Notification{
+				RecipientID: post.Author,
+				Type:        db.NotificationLike,
+				PostID:      postID,
+			}, likeWithdrawal{Type: "dislike", UserID: userID, PostID: postID})
 		}
 
 		c.JSON(http.StatusOK, gin.H{
@@ -250,8 +324,29 @@ func AddComment() gin.HandlerFunc {
 			return
 		}
 
+		post, err := dbInstance.GetPostByID(postID)
+		if err != nil || !canViewPost(post, userID) {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Post not found"})
+			return
+		}
+
+		reason, message, err := checkCommentPermission(post, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error checking comment permissions"})
+			return
+		}
+		if reason != "" {
+			c.JSON(http.StatusForbidden, gin.H{
+				"message": message,
+				"reason":  reason,
+				"success": false,
+			})
+			return
+		}
+
 		var req struct {
-			Text string `json:"text"`
+			Text     string `json:"text"`
+			ParentID string `json:"parentId"`
 		}
 		if err := c.BindJSON(&req); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request payload"})
@@ -263,7 +358,42 @@ func AddComment() gin.HandlerFunc {
 			return
 		}
 
-		comment, err := dbInstance.CreateComment(userID, postID, req.Text)
+		var parentID, replyTo primitive.ObjectID
+		if req.ParentID != "" {
+			parentID, err = primitive.ObjectIDFromHex(req.ParentID)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid parent comment ID"})
+				return
+			}
+
+			parent, err := dbInstance.GetCommentByID(parentID)
+			if err != nil || parent.Post != postID {
+				c.JSON(http.StatusNotFound, gin.H{"message": "Parent comment not found"})
+				return
+			}
+
+			replyTo = parent.Author
+
+			// Threads are one level deep, so replying to a reply joins the top-level thread
+			if !parent.ParentID.IsZero() {
+				parentID = parent.ParentID
+			}
+		}
+
+		mentions, err := resolveMentions(req.Text, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error resolving mentions"})
+			return
+		}
+
+		comment, err := dbInstance.CreateComment(db.Comment{
+			Author:   userID,
+			Post:     postID,
+			ParentID: parentID,
+			ReplyTo:  replyTo,
+			Text:     req.Text,
+			Mentions: mentions,
+		})
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error creating comment"})
 			return
@@ -275,6 +405,45 @@ func AddComment() gin.HandlerFunc {
 			return
 		}
 
+		if !parentID.IsZero() {
+			err = dbInstance.UpdateComment(parentID, bson.M{"$inc": bson.M{"replyCount": 1}})
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"message": "Error updating parent comment"})
+				return
+			}
+		}
+
+		notifyMentions(comment.Mentions, userID, postID, comment.ID)
+		notifyUser(db.Notification{
+			RecipientID: post.Author,
+			Type:        db.NotificationComment,
+			ActorID:     userID,
+			PostID:      postID,
+			CommentID:   comment.ID,
+			Message:     "Someone commented on your post",
+		})
+		if replyTo != post.Author {
+			notifyUser(db.Notification{
+				RecipientID: replyTo,
+				Type:        db.NotificationReply,
+				ActorID:     userID,
+				PostID:      postID,
+				CommentID:   comment.ID,
+				Message:     "Someone replied to your comment",
+			})
+		}
+		commentEvent := gin.H{
+			"commentId":    comment.ID,
+			"postId":       postID,
+			"authorId":     userID,
+			"postAuthorId": post.Author,
+			"text":         comment.Text,
+		}
+		if !parentID.IsZero() {
+			commentEvent["parentId"] = parentID
+		}
+		emitWebhookEvent(db.EventCommentAdded, []primitive.ObjectID{userID, post.Author, replyTo}, commentEvent)
+
 		c.JSON(http.StatusCreated, gin.H{
 			"message": "Comment added",
 			"comment": comment,
@@ -292,6 +461,14 @@ func GetCommentsOfPost() gin.HandlerFunc {
 			return
 		}
 
+		viewerID, _ := primitive.ObjectIDFromHex(getUserIDFromContext(c))
+
+		post, err := dbInstance.GetPostByID(postID)
+		if err != nil || !canViewPost(post, viewerID) {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Post not found"})
+			return
+		}
+
 		comments, err := dbInstance.GetCommentsByPostID(postID)
 		if err != nil {
 			c.JSON(http.StatusNotFound, gin.H{"message": "No comments found"})
@@ -299,13 +476,16 @@ func GetCommentsOfPost() gin.HandlerFunc {
 		}
 
 		c.JSON(http.StatusOK, gin.H{
-			"success":  true,
-			"comments": comments,
+			"success":        true,
+			"comments":       pinnedCommentsFirst(comments, post.PinnedComments),
+			"pinnedComments": post.PinnedComments,
 		})
 	}
 }
 
-// DeletePost handles deleting a post and its comments
+// DeletePost moves a post to the recently deleted list. It can be restored
+// within db.DeletedPostRetention, after which the purge job removes it along
+// with its comments and media.
 func DeletePost() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		postID, err := primitive.ObjectIDFromHex(c.Param("id"))
@@ -321,7 +501,7 @@ func DeletePost() gin.HandlerFunc {
 		}
 
 		post, err := dbInstance.GetPostByID(postID)
-		if err != nil {
+		if err != nil || post.IsDeleted() {
 			c.JSON(http.StatusNotFound, gin.H{"message": "Post not found"})
 			return
 		}
@@ -331,18 +511,13 @@ func DeletePost() gin.HandlerFunc {
 			return
 		}
 
-		err = dbInstance.DeletePost(postID)
+		deletedAt := time.Now()
+		err = dbInstance.UpdatePost(postID, bson.M{"$set": bson.M{"deletedAt": deletedAt}})
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error deleting post"})
 			return
 		}
 
-		err = dbInstance.DeleteCommentsByPostID(postID)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error deleting comments"})
-			return
-		}
-
 		err = dbInstance.RemovePostFromUser(userID, postID)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error updating user posts"})
@@ -350,8 +525,9 @@ func DeletePost() gin.HandlerFunc {
 		}
 
 		c.JSON(http.StatusOK, gin.H{
-			"message": "Post deleted",
-			"success": true,
+			"message":      "Post deleted",
+			"restoreUntil": deletedAt.Add(db.DeletedPostRetention),
+			"success":      true,
 		})
 	}
 }
@@ -374,7 +550,7 @@ func BookmarkPost() gin.HandlerFunc {
 		}
 
 		post, err := dbInstance.GetPostByID(postID)
-		if err != nil {
+		if err != nil || !canViewPost(post, userID) {
 			c.JSON(http.StatusNotFound, gin.H{"message": "Post not found"})
 			return
 		}
@@ -0,0 +1,58 @@
+package controller
+
+import (
+	"instacloneapp/server/pkg/db"
+	"instacloneapp/server/utils"
+	"log"
+	"time"
+)
+
+// StartPostPurgeJob permanently removes posts whose recovery window has
+// passed, together with their comments and uploaded media
+func StartPostPurgeJob(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			purgeDeletedPosts()
+		}
+	}()
+}
+
+// postPurgeLease is how long a post claimed for purging is left to the
+// instance that claimed it before another one may retry
+const postPurgeLease = 5 * time.Minute
+
+// purgeDeletedPosts claims and removes posts deleted more than
+// db.DeletedPostRetention ago until none are left. Each post is claimed
+// before anything is deleted, so the job can run on every instance.
+func purgeDeletedPosts() {
+	for {
+		now := time.Now()
+		post, err := dbInstance.ClaimPostToPurge(now.Add(-db.DeletedPostRetention), now, postPurgeLease)
+		if err != nil {
+			log.Printf("Error claiming post to purge: %v", err)
+			return
+		}
+		if post == nil {
+			return
+		}
+
+		if err := dbInstance.DeleteCommentsByPostID(post.ID); err != nil {
+			log.Printf("Error deleting comments of post %s: %v", post.ID.Hex(), err)
+			continue
+		}
+
+		if post.Image != "" && cloudinaryClient != nil {
+			// A missing asset shouldn't keep the post around forever, so only log it
+			if err := utils.DeleteImageFromCloudinary(cloudinaryClient, post.Image); err != nil {
+				log.Printf("Error deleting media of post %s: %v", post.ID.Hex(), err)
+			}
+		}
+
+		if err := dbInstance.DeletePost(post.ID); err != nil {
+			log.Printf("Error purging post %s: %v", post.ID.Hex(), err)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package controller
+
+import (
+	"context"
+	"instacloneapp/server/pkg/db"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// postPublishLease is how long a post claimed for publishing is left to the
+// instance that claimed it before the scheduler claims it again
+const postPublishLease = 2 * time.Minute
+
+// StartPostScheduler publishes scheduled posts once their time has come, and
+// retries posts whose publishing didn't finish. It is safe to run on every
+// server instance: each due post is claimed atomically by the database, so
+// only one instance publishes it.
+func StartPostScheduler(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			publishDuePosts()
+		}
+	}()
+}
+
+// publishDuePosts claims and publishes scheduled posts until none are due
+func publishDuePosts() {
+	for {
+		post, err := dbInstance.ClaimDueScheduledPost(time.Now(), postPublishLease)
+		if err != nil {
+			log.Printf("Error claiming scheduled post: %v", err)
+			return
+		}
+		if post == nil {
+			return
+		}
+
+		if err := finishPublishing(post); err != nil {
+			log.Printf("Error publishing scheduled post %s: %v", post.ID.Hex(), err)
+		}
+	}
+}
+
+// finishPublishing makes a post claimed for publishing visible: it links the
+// post to its author and marks it published, and only then fans it out to
+// followers and notifies mentioned users. If a step before the mark fails the
+// post stays claimed, and the scheduler retries it once the lease runs out. If
+// the lease ran out already, the instance that claimed the post since then
+// publishes it, so nothing is sent from here.
+func finishPublishing(post *db.Post) error {
+	if err := dbInstance.AddPostToUser(post.Author, post.ID); err != nil {
+		return err
+	}
+
+	publishedAt := time.Now()
+	marked, err := dbInstance.MarkPostPublished(post.ID, post.PublishLease, publishedAt)
+	if err != nil {
+		return err
+	}
+	if !marked {
+		log.Printf("Publishing lease on post %s ran out, leaving it to the new claim", post.ID.Hex())
+		return nil
+	}
+
+	post.Status = db.PostStatusPublished
+	post.PublishedAt = publishedAt
+	post.CreatedAt = publishedAt
+	post.ScheduledAt = time.Time{}
+	// The post is live now, so a failed fan-out only means followers see it
+	// when they next load their feed
+	if err := fanOutNewPost(post); err != nil {
+		log.Printf("Error fanning out post %s: %v", post.ID.Hex(), err)
+	}
+
+	notifyMentions(post.Mentions, post.Author, post.ID, primitive.NilObjectID)
+	emitWebhookEvent(db.EventPostCreated, []primitive.ObjectID{post.Author}, map[string]interface{}{
+		"postId":   post.ID,
+		"authorId": post.Author,
+		"caption":  post.Caption,
+		"image":    post.Image,
+	})
+	return nil
+}
+
+// fanOutNewPost pushes a new post to the feeds of everyone following its author
+func fanOutNewPost(post *db.Post) error {
+	cursor, err := dbInstance.GetUsers(bson.M{"following": post.Author})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(context.Background())
+
+	for cursor.Next(context.Background()) {
+		var follower db.User
+		if err := cursor.Decode(&follower); err != nil {
+			log.Printf("Error decoding follower: %v", err)
+			continue
+		}
+		broadcastToUser(follower.ID, "newPost", post)
+	}
+	return cursor.Err()
+}
@@ -0,0 +1,246 @@
+package controller
+
+import (
+	"encoding/json"
+	"instacloneapp/server/pkg/db"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// preferencesResponse spells out the caller's notification preferences with
+// every type and channel listed, so clients don't have to know the defaults
+func preferencesResponse(preferences db.NotificationPreferences) gin.H {
+	channels := make(map[string]map[string]bool, len(db.NotificationTypes))
+	for _, notificationType := range db.NotificationTypes {
+		channels[notificationType] = make(map[string]bool, len(db.NotificationChannels))
+		for _, channel := range db.NotificationChannels {
+			channels[notificationType][channel] = preferences.Allows(notificationType, channel)
+		}
+	}
+
+	mutedPosts := preferences.MutedPosts
+	if mutedPosts == nil {
+		mutedPosts = []primitive.ObjectID{}
+	}
+	mutedConversations := preferences.MutedConversations
+	if mutedConversations == nil {
+		mutedConversations = []primitive.ObjectID{}
+	}
+
+	return gin.H{
+		"channels":           channels,
+		"mutedPosts":         mutedPosts,
+		"mutedConversations": mutedConversations,
+		"quietHours":         preferences.QuietHours,
+		"digestFrequency":    preferences.Digest(),
+	}
+}
+
+// GetNotificationPreferences returns which notifications the caller receives
+// and how
+func GetNotificationPreferences() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := primitive.ObjectIDFromHex(getUserIDFromContext(c))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid User ID"})
+			return
+		}
+
+		user, err := dbInstance.GetUserByID(userID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"message": "User not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"success":     true,
+			"preferences": preferencesResponse(user.NotificationPreferences),
+		})
+	}
+}
+
+// UpdateNotificationPreferences changes the channels the caller receives each
+// notification type on, their quiet hours and how often they get an email
+// digest. Settings left out of the request stay as they are; quiet hours set
+// to null are removed.
+func UpdateNotificationPreferences() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := primitive.ObjectIDFromHex(getUserIDFromContext(c))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid User ID"})
+			return
+		}
+
+		var req struct {
+			Channels        map[string]map[string]bool `json:"channels"`
+			QuietHours      json.RawMessage            `json:"quietHours"`
+			DigestFrequency string                     `json:"digestFrequency"`
+		}
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid input"})
+			return
+		}
+
+		set := bson.M{}
+		for notificationType, channels := range req.Channels {
+			if !containsString(db.NotificationTypes, notificationType) {
+				c.JSON(http.StatusBadRequest, gin.H{"message": "Unknown notification type: " + notificationType})
+				return
+			}
+			for channel, enabled := range channels {
+				if !containsString(db.NotificationChannels, channel) {
+					c.JSON(http.StatusBadRequest, gin.H{"message": "Unknown notification channel: " + channel})
+					return
+				}
+				set["notificationPreferences.channels."+notificationType+"."+channel] = enabled
+			}
+		}
+
+		switch req.DigestFrequency {
+		case "":
+		case db.DigestDaily, db.DigestWeekly, db.DigestOff:
+			set["notificationPreferences.digestFrequency"] = req.DigestFrequency
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid digest frequency"})
+			return
+		}
+
+		update := bson.M{}
+		switch string(req.QuietHours) {
+		case "":
+		case "null":
+			update["$unset"] = bson.M{"notificationPreferences.quietHours": ""}
+		default:
+			var quietHours db.QuietHours
+			if err := json.Unmarshal(req.QuietHours, &quietHours); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid quiet hours"})
+				return
+			}
+			if err := quietHours.Validate(); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid quiet hours: " + err.Error()})
+				return
+			}
+			set["notificationPreferences.quietHours"] = quietHours
+		}
+		if len(set) > 0 {
+			update["$set"] = set
+		}
+		if len(update) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Nothing to update"})
+			return
+		}
+
+		if err := dbInstance.UpdateUser(userID, update); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error updating notification preferences"})
+			return
+		}
+
+		user, err := dbInstance.GetUserByID(userID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"message": "User not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message":     "Notification preferences updated",
+			"success":     true,
+			"preferences": preferencesResponse(user.NotificationPreferences),
+		})
+	}
+}
+
+// MutePost stops the caller's notifications about a post
+func MutePost() gin.HandlerFunc {
+	return setPostMuted(true)
+}
+
+// UnmutePost resumes the caller's notifications about a post
+func UnmutePost() gin.HandlerFunc {
+	return setPostMuted(false)
+}
+
+func setPostMuted(muted bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := primitive.ObjectIDFromHex(getUserIDFromContext(c))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid User ID"})
+			return
+		}
+
+		postID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid post ID"})
+			return
+		}
+
+		if muted {
+			if _, err := dbInstance.GetPostByID(postID); err != nil {
+				c.JSON(http.StatusNotFound, gin.H{"message": "Post not found"})
+				return
+			}
+		}
+
+		updateMuted(c, userID, "notificationPreferences.mutedPosts", postID, muted)
+	}
+}
+
+// MuteConversation stops the caller's notifications about new messages in a
+// conversation
+func MuteConversation() gin.HandlerFunc {
+	return setConversationMuted(true)
+}
+
+// UnmuteConversation resumes the caller's notifications about new messages in
+// a conversation
+func UnmuteConversation() gin.HandlerFunc {
+	return setConversationMuted(false)
+}
+
+func setConversationMuted(muted bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := primitive.ObjectIDFromHex(getUserIDFromContext(c))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid User ID"})
+			return
+		}
+
+		conversationID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid conversation ID"})
+			return
+		}
+
+		if muted {
+			conversation, err := dbInstance.GetConversationByID(conversationID)
+			if err != nil || conversation == nil || !contains(conversation.Participants, userID) {
+				c.JSON(http.StatusNotFound, gin.H{"message": "Conversation not found"})
+				return
+			}
+		}
+
+		updateMuted(c, userID, "notificationPreferences.mutedConversations", conversationID, muted)
+	}
+}
+
+// updateMuted adds an ID to or removes it from one of the caller's mute lists
+func updateMuted(c *gin.Context, userID primitive.ObjectID, field string, id primitive.ObjectID, muted bool) {
+	update := bson.M{"$pull": bson.M{field: id}}
+	message := "Notifications unmuted"
+	if muted {
+		update = bson.M{"$addToSet": bson.M{field: id}}
+		message = "Notifications muted"
+	}
+
+	if err := dbInstance.UpdateUser(userID, update); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error updating notification preferences"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": message,
+		"success": true,
+	})
+}
@@ -0,0 +1,308 @@
+package controller
+
+import (
+	"instacloneapp/server/pkg/db"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// canViewProfile reports whether the viewer may see the posts and connections
+// of an account. Those of a private account are only visible to the followers
+// it approved.
+func canViewProfile(owner db.User, viewerID primitive.ObjectID) bool {
+	if !owner.IsPrivate || owner.ID == viewerID {
+		return true
+	}
+	if viewerID.IsZero() {
+		return false
+	}
+	viewer, err := dbInstance.GetUserByID(viewerID)
+	return err == nil && contains(viewer.Following, owner.ID)
+}
+
+// restrictProfile hides what an account only shows its approved followers
+func restrictProfile(user *db.User) {
+	user.Posts, user.Followers, user.Following, user.Bookmarks = nil, nil, nil, nil
+}
+
+// canViewContentOf is canViewProfile for an account that hasn't been loaded yet
+func canViewContentOf(ownerID, viewerID primitive.ObjectID) bool {
+	if ownerID == viewerID {
+		return true
+	}
+	owner, err := dbInstance.GetUserByID(ownerID)
+	if err != nil {
+		return false
+	}
+	return canViewProfile(owner, viewerID)
+}
+
+// visiblePosts drops the posts of private accounts the viewer doesn't follow
+func visiblePosts(posts []db.Post, viewerID primitive.ObjectID) ([]db.Post, error) {
+	seen := make(map[primitive.ObjectID]bool)
+	var authorIDs []primitive.ObjectID
+	for _, post := range posts {
+		if !seen[post.Author] {
+			seen[post.Author] = true
+			authorIDs = append(authorIDs, post.Author)
+		}
+	}
+	if len(authorIDs) == 0 {
+		return posts, nil
+	}
+
+	authors, err := dbInstance.GetUsersByIDs(authorIDs)
+	if err != nil {
+		return nil, err
+	}
+	hidden := make(map[primitive.ObjectID]bool)
+	for _, author := range authors {
+		if author.IsPrivate && author.ID != viewerID {
+			hidden[author.ID] = true
+		}
+	}
+	if len(hidden) == 0 {
+		return posts, nil
+	}
+	if viewer, err := dbInstance.GetUserByID(viewerID); err == nil {
+		for _, followed := range viewer.Following {
+			delete(hidden, followed)
+		}
+	}
+
+	visible := make([]db.Post, 0, len(posts))
+	for _, post := range posts {
+		if !hidden[post.Author] {
+			visible = append(visible, post)
+		}
+	}
+	return visible, nil
+}
+
+// requestFollow handles following a private account the requester doesn't
+// follow yet: the first call asks the owner for approval, a second one while
+// the request is pending cancels it
+func requestFollow(c *gin.Context, requesterID primitive.ObjectID, target db.User) {
+	if contains(target.FollowRequests, requesterID) {
+		if _, err := dbInstance.RemoveFollowRequest(target.ID, requesterID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error cancelling follow request"})
+			return
+		}
+		withdrawNotification(db.Notification{
+			RecipientID: target.ID,
+			Type:        db.NotificationFollowRequest,
+			ActorID:     requesterID,
+		})
+
+		c.JSON(http.StatusOK, gin.H{
+			"message":   "Follow request cancelled",
+			"success":   true,
+			"requested": false,
+		})
+		return
+	}
+
+	if err := dbInstance.RequestFollow(requesterID, target.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error sending follow request"})
+		return
+	}
+	notifyUser(db.Notification{
+		RecipientID: target.ID,
+		Type:        db.NotificationFollowRequest,
+		ActorID:     requesterID,
+		Message:     "Someone requested to follow you",
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "Follow request sent",
+		"success":   true,
+		"requested": true,
+	})
+}
+
+// emitUserFollowed tells the webhooks of both users that one now follows the other
+func emitUserFollowed(followerID, userID primitive.ObjectID) {
+	emitWebhookEvent(db.EventUserFollowed, []primitive.ObjectID{followerID, userID}, gin.H{
+		"followerId": followerID,
+		"userId":     userID,
+	})
+}
+
+// acceptFollowRequests turns pending follow requests into follows and lets
+// the requesters know. A nil list accepts every pending request.
+func acceptFollowRequests(ownerID primitive.ObjectID, requesterIDs []primitive.ObjectID) ([]primitive.ObjectID, error) {
+	accepted, err := dbInstance.AcceptFollowRequests(ownerID, requesterIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, requesterID := range accepted {
+		withdrawNotification(db.Notification{
+			RecipientID: ownerID,
+			Type:        db.NotificationFollowRequest,
+			ActorID:     requesterID,
+		})
+		notifyUser(db.Notification{
+			RecipientID: requesterID,
+			Type:        db.NotificationFollowAccept,
+			ActorID:     ownerID,
+			Message:     "Your follow request was accepted",
+		})
+		emitUserFollowed(requesterID, ownerID)
+	}
+	return accepted, nil
+}
+
+// UpdateAccountPrivacy makes the caller's account private or public. Going
+// public accepts every pending follow request.
+func UpdateAccountPrivacy() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := primitive.ObjectIDFromHex(getUserIDFromContext(c))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid User ID"})
+			return
+		}
+
+		var req struct {
+			IsPrivate *bool `json:"isPrivate"`
+		}
+		if err := c.BindJSON(&req); err != nil || req.IsPrivate == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "isPrivate is required"})
+			return
+		}
+
+		err = dbInstance.UpdateUser(userID, bson.M{"$set": bson.M{"isPrivate": *req.IsPrivate}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error updating settings"})
+			return
+		}
+
+		// Requests are accepted after the account is public, so none sent in
+		// between are left pending
+		var accepted []primitive.ObjectID
+		if !*req.IsPrivate {
+			accepted, err = acceptFollowRequests(userID, nil)
+			if err != nil {
+				log.Printf("Error accepting follow requests of %s: %v", userID.Hex(), err)
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"success":   true,
+			"isPrivate": *req.IsPrivate,
+			"accepted":  len(accepted),
+		})
+	}
+}
+
+// GetFollowRequests lists the people waiting for the caller to approve their
+// follow requests, oldest request first
+func GetFollowRequests() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := primitive.ObjectIDFromHex(getUserIDFromContext(c))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid User ID"})
+			return
+		}
+
+		user, err := dbInstance.GetUserByID(userID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"message": "User not found"})
+			return
+		}
+
+		summaries, err := getUserSummaries(user.FollowRequests)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving follow requests"})
+			return
+		}
+		requests := []userSummary{}
+		for _, requesterID := range user.FollowRequests {
+			if summary, ok := summaries[requesterID]; ok {
+				requests = append(requests, summary)
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"success":  true,
+			"requests": requests,
+		})
+	}
+}
+
+// AcceptFollowRequest lets the requester follow the caller
+func AcceptFollowRequest() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, requesterID, ok := followRequestParams(c)
+		if !ok {
+			return
+		}
+
+		accepted, err := acceptFollowRequests(userID, []primitive.ObjectID{requesterID})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error accepting follow request"})
+			return
+		}
+		if len(accepted) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Follow request not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Follow request accepted",
+			"success": true,
+		})
+	}
+}
+
+// DeclineFollowRequest turns down the requester's follow request. The
+// requester isn't told.
+func DeclineFollowRequest() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, requesterID, ok := followRequestParams(c)
+		if !ok {
+			return
+		}
+
+		removed, err := dbInstance.RemoveFollowRequest(userID, requesterID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error declining follow request"})
+			return
+		}
+		if !removed {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Follow request not found"})
+			return
+		}
+		withdrawNotification(db.Notification{
+			RecipientID: userID,
+			Type:        db.NotificationFollowRequest,
+			ActorID:     requesterID,
+		})
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Follow request declined",
+			"success": true,
+		})
+	}
+}
+
+// followRequestParams parses the caller and the requester named by :id. It
+// writes the error response itself and returns false when the request should stop.
+func followRequestParams(c *gin.Context) (userID, requesterID primitive.ObjectID, ok bool) {
+	userID, err := primitive.ObjectIDFromHex(getUserIDFromContext(c))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid User ID"})
+		return userID, requesterID, false
+	}
+
+	requesterID, err = primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid user ID"})
+		return userID, requesterID, false
+	}
+	return userID, requesterID, true
+}
@@ -0,0 +1,196 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"instacloneapp/server/pkg/db"
+	"instacloneapp/server/pkg/webpush"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// pushSender sends web push messages. It's nil when web push isn't configured.
+var pushSender *webpush.Sender
+
+// pushTTL is how long push services keep a notification for a browser that's
+// offline
+const pushTTL = 24 * time.Hour
+
+// InitPush sets the sender notifications are pushed to browsers with
+func InitPush(sender *webpush.Sender) {
+	pushSender = sender
+}
+
+// pushMessage is the payload the service worker turns into a notification
+type pushMessage struct {
+	ID             primitive.ObjectID `json:"id,omitempty"`
+	Type           string             `json:"type"`
+	Body           string             `json:"body"`
+	Icon           string             `json:"icon,omitempty"`
+	PostID         primitive.ObjectID `json:"postId,omitempty"`
+	ConversationID primitive.ObjectID `json:"conversationId,omitempty"`
+	CreatedAt      time.Time          `json:"createdAt"`
+}
+
+// sendPush pushes a notification to every browser the recipient registered.
+// It returns right away; the push services are contacted in the background.
+func sendPush(recipientID primitive.ObjectID, entry notificationEntry) {
+	if pushSender == nil {
+		return
+	}
+
+	message := pushMessage{
+		ID:             entry.ID,
+		Type:           entry.Type,
+		Body:           entry.Summary,
+		PostID:         entry.PostID,
+		ConversationID: entry.ConversationID,
+		CreatedAt:      entry.UpdatedAt,
+	}
+	if len(entry.Actors) > 0 {
+		message.Icon = entry.Actors[0].ProfilePicture
+	}
+	payload, err := json.Marshal(message)
+	if err != nil {
+		log.Printf("Error encoding push message: %v", err)
+		return
+	}
+
+	opts := webpush.Options{TTL: pushTTL, Urgency: webpush.UrgencyNormal}
+	if urgentNotificationTypes[entry.Type] {
+		opts.Urgency = webpush.UrgencyHigh
+	}
+	if !entry.ID.IsZero() {
+		// A later update of an aggregated notification replaces the one the
+		// push service still holds
+		opts.Topic = entry.ID.Hex()
+	}
+
+	go func() {
+		subscriptions, err := dbInstance.GetPushSubscriptions(recipientID)
+		if err != nil {
+			log.Printf("Error loading push subscriptions of %s: %v", recipientID.Hex(), err)
+			return
+		}
+
+		for _, subscription := range subscriptions {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			err := pushSender.Send(ctx, webpush.Subscription{
+				Endpoint: subscription.Endpoint,
+				Keys:     webpush.Keys{P256dh: subscription.P256dh, Auth: subscription.Auth},
+			}, payload, opts)
+			cancel()
+
+			switch {
+			case errors.Is(err, webpush.ErrSubscriptionGone):
+				if err := dbInstance.DeletePushSubscriptionByEndpoint(subscription.Endpoint); err != nil {
+					log.Printf("Error removing expired push subscription: %v", err)
+				}
+			case err != nil:
+				log.Printf("Error pushing notification to %s: %v", recipientID.Hex(), err)
+			}
+		}
+	}()
+}
+
+// GetPushPublicKey returns the VAPID public key browsers subscribe with
+func GetPushPublicKey() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if pushSender == nil {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Web push is not enabled"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"success":   true,
+			"publicKey": pushSender.PublicKey(),
+		})
+	}
+}
+
+// SubscribePush registers the caller's browser for web push. The body is the
+// PushSubscription the browser returned, as JSON.
+func SubscribePush() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := primitive.ObjectIDFromHex(getUserIDFromContext(c))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid User ID"})
+			return
+		}
+		if pushSender == nil {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Web push is not enabled"})
+			return
+		}
+
+		var req webpush.Subscription
+		if err := c.BindJSON(&req); err != nil || req.Endpoint == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid input"})
+			return
+		}
+		if err := webpush.ValidateEndpoint(req.Endpoint); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid subscription endpoint: " + err.Error()})
+			return
+		}
+		if err := req.Keys.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid subscription keys: " + err.Error()})
+			return
+		}
+
+		err = dbInstance.SavePushSubscription(db.PushSubscription{
+			UserID:    userID,
+			Endpoint:  req.Endpoint,
+			P256dh:    req.Keys.P256dh,
+			Auth:      req.Keys.Auth,
+			UserAgent: c.Request.UserAgent(),
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving push subscription"})
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{
+			"message": "Push subscription saved",
+			"success": true,
+		})
+	}
+}
+
+// UnsubscribePush unregisters one of the caller's browsers, given the endpoint
+// of its subscription
+func UnsubscribePush() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := primitive.ObjectIDFromHex(getUserIDFromContext(c))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid User ID"})
+			return
+		}
+
+		var req struct {
+			Endpoint string `json:"endpoint"`
+		}
+		if err := c.BindJSON(&req); err != nil || req.Endpoint == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid input"})
+			return
+		}
+
+		if err := dbInstance.DeletePushSubscription(userID, req.Endpoint); err != nil {
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusNotFound, gin.H{"message": "Push subscription not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error removing push subscription"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Push subscription removed",
+			"success": true,
+		})
+	}
+}
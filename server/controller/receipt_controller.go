@@ -0,0 +1,108 @@
+package controller
+
+import (
+	"instacloneapp/server/pkg/db"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MarkConversationRead marks every message in a conversation up to and
+// including the given message as read by the caller
+func MarkConversationRead() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := primitive.ObjectIDFromHex(getUserIDFromContext(c))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid User ID"})
+			return
+		}
+
+		conversationID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid conversation ID"})
+			return
+		}
+
+		var req struct {
+			MessageID string `json:"messageId"`
+		}
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid input"})
+			return
+		}
+
+		messageID, err := primitive.ObjectIDFromHex(req.MessageID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid message ID"})
+			return
+		}
+
+		conversation, err := dbInstance.GetConversationByID(conversationID)
+		if err != nil || !contains(conversation.Participants, userID) {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Conversation not found"})
+			return
+		}
+
+		message, err := dbInstance.GetMessageByID(messageID)
+		if err != nil || message.ConversationID != conversationID {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Message not found"})
+			return
+		}
+
+		// Reading a request clears its badge but isn't reported to the sender
+		var messages []db.Message
+		if !conversation.IsPendingFor(userID) {
+			messages, err = dbInstance.MarkMessagesRead(conversationID, userID, message.CreatedAt)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"message": "Error marking messages read"})
+				return
+			}
+		}
+		unread, err := dbInstance.MarkConversationRead(conversationID, userID, message.CreatedAt, int64(len(messages)))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error updating conversation"})
+			return
+		}
+
+		notifyReceipts("read", conversationID, userID, messages)
+
+		c.JSON(http.StatusOK, gin.H{
+			"success":     true,
+			"read":        len(messages),
+			"unreadCount": unread,
+		})
+	}
+}
+
+// markDelivered records delivery of the conversation's pending messages to the
+// user and lets their senders know
+func markDelivered(conversationID, userID primitive.ObjectID) {
+	messages, err := dbInstance.MarkMessagesDelivered(conversationID, userID)
+	if err != nil {
+		log.Printf("Error marking messages delivered to %s: %v", userID.Hex(), err)
+		return
+	}
+	notifyReceipts("delivered", conversationID, userID, messages)
+}
+
+// notifyReceipts pushes a "delivered" or "read" event to each sender listing
+// which of their messages the user received or read
+func notifyReceipts(event string, conversationID, userID primitive.ObjectID, messages []db.Message) {
+	bySender := make(map[primitive.ObjectID][]primitive.ObjectID)
+	for _, message := range messages {
+		bySender[message.SenderID] = append(bySender[message.SenderID], message.ID)
+	}
+
+	at := time.Now()
+	for senderID, messageIDs := range bySender {
+		broadcastToUser(senderID, event, gin.H{
+			"conversationId": conversationID,
+			"userId":         userID,
+			"messageIds":     messageIDs,
+			"at":             at,
+		})
+	}
+}
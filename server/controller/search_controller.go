@@ -0,0 +1,77 @@
+package controller
+
+import (
+	"instacloneapp/server/utils"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// searchSnippetRadius is how many characters of context a result snippet keeps on each side of the match
+const searchSnippetRadius = 40
+
+// messageSearchResult is a message matching a search, with the matched terms
+// located in its snippet
+type messageSearchResult struct {
+	ConversationID primitive.ObjectID `json:"conversationId"`
+	MessageID      primitive.ObjectID `json:"messageId"`
+	SenderID       primitive.ObjectID `json:"senderId"`
+	Snippet        string             `json:"snippet"`
+	Highlights     []utils.TextRange  `json:"highlights"`
+	CreatedAt      time.Time          `json:"createdAt"`
+}
+
+// SearchMessages searches the text of messages in the caller's conversations
+func SearchMessages() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := primitive.ObjectIDFromHex(getUserIDFromContext(c))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid User ID"})
+			return
+		}
+
+		query := strings.TrimSpace(c.Query("q"))
+		if utf8.RuneCountInString(query) < 2 {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Search query must be at least 2 characters"})
+			return
+		}
+
+		page, limit, skip := getPagination(c)
+		messages, err := dbInstance.SearchMessages(userID, query, skip, limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error searching messages"})
+			return
+		}
+
+		// Excluded terms ("-word") never appear in results, so they aren't highlighted
+		var terms []string
+		for _, term := range strings.Fields(strings.ReplaceAll(query, `"`, "")) {
+			if !strings.HasPrefix(term, "-") {
+				terms = append(terms, term)
+			}
+		}
+		results := make([]messageSearchResult, 0, len(messages))
+		for _, message := range messages {
+			snippet, highlights := utils.Highlight(message.Message, terms, searchSnippetRadius)
+			results = append(results, messageSearchResult{
+				ConversationID: message.ConversationID,
+				MessageID:      message.ID,
+				SenderID:       message.SenderID,
+				Snippet:        snippet,
+				Highlights:     highlights,
+				CreatedAt:      message.CreatedAt,
+			})
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"results": results,
+			"page":    page,
+			"limit":   limit,
+		})
+	}
+}
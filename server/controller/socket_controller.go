@@ -0,0 +1,32 @@
+package controller
+
+import (
+	"instacloneapp/server/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetSocketTicket issues a short-lived ticket the caller can pass as the
+// "ticket" query parameter when opening a websocket connection
+func GetSocketTicket() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := getUserIDFromContext(c)
+		if userID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"message": "User not authenticated"})
+			return
+		}
+
+		ticket, err := utils.GenerateSocketTicket(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error generating socket ticket"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"success":   true,
+			"ticket":    ticket,
+			"expiresIn": int(utils.SocketTicketTTL.Seconds()),
+		})
+	}
+}
@@ -43,6 +43,13 @@ func GetUsers() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		filter := bson.M{}
 
+		// Private accounts are listed, but only approved followers see their connections
+		viewerID, _ := primitive.ObjectIDFromHex(getUserIDFromContext(c))
+		var viewerFollowing []primitive.ObjectID
+		if viewer, err := dbInstance.GetUserByID(viewerID); err == nil {
+			viewerFollowing = viewer.Following
+		}
+
 		cursor, err := dbInstance.GetUsers(filter)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -57,6 +64,9 @@ func GetUsers() gin.HandlerFunc {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 				return
 			}
+			if user.IsPrivate && user.ID != viewerID && !contains(viewerFollowing, user.ID) {
+				restrictProfile(&user)
+			}
 			users = append(users, user)
 		}
 
@@ -189,6 +199,18 @@ func GetProfile() gin.HandlerFunc {
 			return
 		}
 
+		// A private account only shows its posts and connections to approved followers
+		viewerID, _ := primitive.ObjectIDFromHex(getUserIDFromContext(c))
+		if !canViewProfile(user, viewerID) {
+			restrictProfile(&user)
+			c.JSON(http.StatusOK, gin.H{
+				"user":            user,
+				"restricted":      true,
+				"followRequested": contains(user.FollowRequests, viewerID),
+			})
+			return
+		}
+
 		c.JSON(http.StatusOK, gin.H{"user": user})
 	}
 }
@@ -429,6 +451,20 @@ func FollowOrUnfollowUser() gin.HandlerFunc {
 		}
 
 		isFollowing := contains(user.Following, targetUserID)
+
+		// Following a private account takes the owner's approval
+		if !isFollowing {
+			target, err := dbInstance.GetUserByID(targetUserID)
+			if err != nil {
+				c.JSON(http.StatusNotFound, gin.H{"message": "User not found"})
+				return
+			}
+			if target.IsPrivate {
+				requestFollow(c, followingUserID, target)
+				return
+			}
+		}
+
 		action := "follow"
 		if isFollowing {
 			action = "unfollow"
@@ -444,6 +480,14 @@ func FollowOrUnfollowUser() gin.HandlerFunc {
 		message := "Followed successfully"
 		if action == "unfollow" {
 			message = "Unfollowed successfully"
+		} else {
+			notifyUser(db.Notification{
+				RecipientID: targetUserID,
+				Type:        db.NotificationFollow,
+				ActorID:     followingUserID,
+				Message:     "Someone started following you",
+			})
+			emitUserFollowed(followingUserID, targetUserID)
 		}
 
 		c.JSON(http.StatusOK, gin.H{
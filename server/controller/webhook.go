@@ -0,0 +1,235 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"instacloneapp/server/pkg/db"
+	"instacloneapp/server/pkg/webhook"
+	"instacloneapp/server/utils"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Webhook delivery defaults, each overridable through the environment
+const (
+	webhookMaxAttempts = 8                // WEBHOOK_MAX_ATTEMPTS
+	webhookRetryBase   = 30 * time.Second // WEBHOOK_RETRY_BASE, doubled after each failed attempt
+	webhookRetryMax    = 6 * time.Hour    // WEBHOOK_RETRY_MAX
+	webhookTimeout     = 10 * time.Second // WEBHOOK_TIMEOUT
+	webhookWorkers     = 8                // WEBHOOK_WORKERS, attempts each instance makes at once
+	webhookPerHook     = 2                // WEBHOOK_WORKERS_PER_HOOK, how many of them may go to one webhook
+
+	// webhookAttemptLease is how long a claimed delivery is left to the
+	// instance attempting it before another one may retry it
+	webhookAttemptLease = 2 * time.Minute
+)
+
+var (
+	webhookClient     *webhook.Client
+	webhookClientOnce sync.Once
+)
+
+// webhookHTTPClient returns the client deliveries are sent with. Endpoints on
+// private networks are refused unless WEBHOOK_ALLOW_PRIVATE_NETWORKS is true,
+// e.g. for local development.
+func webhookHTTPClient() *webhook.Client {
+	webhookClientOnce.Do(func() {
+		timeout := utils.GetEnvDuration("WEBHOOK_TIMEOUT", webhookTimeout)
+		webhookClient = webhook.NewClient(timeout, os.Getenv("WEBHOOK_ALLOW_PRIVATE_NETWORKS") == "true")
+	})
+	return webhookClient
+}
+
+// webhookEvent is the body of a delivery
+type webhookEvent struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	CreatedAt time.Time   `json:"createdAt"`
+	Data      interface{} `json:"data"`
+}
+
+// webhookWake tells an idle delivery worker that deliveries are queued. A
+// signal already pending covers any that follow, so it holds just one; a
+// worker that finds work passes the signal on, so the others join in.
+var webhookWake = make(chan struct{}, 1)
+
+// wakeWebhookWorker has a delivery worker look for due deliveries now instead
+// of on its next tick
+func wakeWebhookWorker() {
+	select {
+	case webhookWake <- struct{}{}:
+	default:
+	}
+}
+
+// webhooksInFlight counts the attempts this instance is making to each
+// webhook, so a slow endpoint can't take up every worker
+var webhooksInFlight = struct {
+	sync.Mutex
+	counts map[primitive.ObjectID]int
+}{counts: make(map[primitive.ObjectID]int)}
+
+// emitWebhookEvent queues an event for the webhooks of the users involved in
+// it and those registered for all users, and wakes the delivery worker. It
+// returns right away.
+func emitWebhookEvent(event string, involved []primitive.ObjectID, data interface{}) {
+	go func() {
+		webhooks, err := dbInstance.GetWebhooksForEvent(event, involved)
+		if err != nil {
+			log.Printf("Error finding webhooks for %s: %v", event, err)
+			return
+		}
+		if len(webhooks) == 0 {
+			return
+		}
+
+		now := time.Now()
+		eventID := primitive.NewObjectID().Hex()
+		payload, err := json.Marshal(webhookEvent{ID: eventID, Type: event, CreatedAt: now, Data: data})
+		if err != nil {
+			log.Printf("Error encoding %s event: %v", event, err)
+			return
+		}
+
+		deliveries := make([]db.WebhookDelivery, 0, len(webhooks))
+		for _, hook := range webhooks {
+			deliveries = append(deliveries, db.WebhookDelivery{
+				WebhookID:     hook.ID,
+				EventID:       eventID,
+				Event:         event,
+				Payload:       string(payload),
+				Status:        db.DeliveryPending,
+				NextAttemptAt: now,
+				CreatedAt:     now,
+			})
+		}
+		if err := dbInstance.CreateWebhookDeliveries(deliveries); err != nil {
+			log.Printf("Error queueing %s deliveries: %v", event, err)
+			return
+		}
+
+		wakeWebhookWorker()
+	}()
+}
+
+// StartWebhookDeliveryJob starts the workers that deliver webhook events. They
+// send new deliveries as soon as they're queued, retry failed ones once their
+// backoff has passed, and pick up deliveries left behind by an instance that
+// stopped mid-attempt. Each attempt is claimed atomically, so they run on
+// every instance.
+func StartWebhookDeliveryJob(interval time.Duration) {
+	workers := int(utils.GetEnvInt64("WEBHOOK_WORKERS", webhookWorkers))
+	perHook := int(utils.GetEnvInt64("WEBHOOK_WORKERS_PER_HOOK", webhookPerHook))
+	for i := 0; i < workers; i++ {
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-ticker.C:
+				case <-webhookWake:
+				}
+				deliverDueWebhooks(perHook)
+			}
+		}()
+	}
+}
+
+// deliverDueWebhooks claims and attempts deliveries until none are due, making
+// at most perHook attempts to a webhook at once across this instance's workers
+func deliverDueWebhooks(perHook int) {
+	for {
+		delivery, err := claimWebhookDelivery(perHook)
+		if err != nil {
+			log.Printf("Error claiming webhook delivery: %v", err)
+			return
+		}
+		if delivery == nil {
+			return
+		}
+
+		// There may be more, so have an idle worker look too
+		wakeWebhookWorker()
+		attemptDelivery(delivery)
+
+		webhooksInFlight.Lock()
+		if webhooksInFlight.counts[delivery.WebhookID]--; webhooksInFlight.counts[delivery.WebhookID] <= 0 {
+			delete(webhooksInFlight.counts, delivery.WebhookID)
+		}
+		webhooksInFlight.Unlock()
+	}
+}
+
+// claimWebhookDelivery claims a due delivery to a webhook that has fewer than
+// perHook attempts in flight, and counts it. Claims are made one at a time, so
+// the count stays within the limit.
+func claimWebhookDelivery(perHook int) (*db.WebhookDelivery, error) {
+	webhooksInFlight.Lock()
+	defer webhooksInFlight.Unlock()
+
+	var busy []primitive.ObjectID
+	for id, count := range webhooksInFlight.counts {
+		if count >= perHook {
+			busy = append(busy, id)
+		}
+	}
+	delivery, err := dbInstance.ClaimDueWebhookDelivery(time.Now(), webhookAttemptLease, busy)
+	if err != nil || delivery == nil {
+		return nil, err
+	}
+	webhooksInFlight.counts[delivery.WebhookID]++
+	return delivery, nil
+}
+
+// attemptDelivery sends a claimed delivery and records the outcome, scheduling
+// a retry with exponential backoff if it failed and attempts remain
+func attemptDelivery(delivery *db.WebhookDelivery) {
+	var attempt db.DeliveryAttempt
+	hook, err := dbInstance.GetWebhookByID(delivery.WebhookID)
+	switch {
+	case err != nil:
+		attempt = db.DeliveryAttempt{Status: db.DeliveryFailed, Error: "webhook no longer exists"}
+	case !hook.Active:
+		attempt = db.DeliveryAttempt{Status: db.DeliveryFailed, Error: "webhook is disabled"}
+	default:
+		attempt = sendDelivery(hook, delivery)
+	}
+
+	if err := dbInstance.RecordDeliveryAttempt(delivery.ID, attempt); err != nil {
+		log.Printf("Error recording webhook delivery %s: %v", delivery.ID.Hex(), err)
+	}
+}
+
+func sendDelivery(hook *db.Webhook, delivery *db.WebhookDelivery) db.DeliveryAttempt {
+	ctx, cancel := context.WithTimeout(context.Background(), webhookAttemptLease/2)
+	defer cancel()
+
+	result, err := webhookHTTPClient().Deliver(ctx, hook.URL, hook.Secret, delivery.Event, delivery.ID.Hex(), []byte(delivery.Payload))
+	attempt := db.DeliveryAttempt{
+		ResponseStatus: result.StatusCode,
+		ResponseBody:   result.Body,
+		Duration:       result.Duration,
+	}
+	if err != nil {
+		attempt.Error = err.Error()
+	}
+
+	maxAttempts := int(utils.GetEnvInt64("WEBHOOK_MAX_ATTEMPTS", webhookMaxAttempts))
+	switch {
+	case err == nil && result.Succeeded():
+		attempt.Status = db.DeliverySucceeded
+	case delivery.Attempts >= maxAttempts:
+		attempt.Status = db.DeliveryFailed
+	default:
+		attempt.Status = db.DeliveryPending
+		base := utils.GetEnvDuration("WEBHOOK_RETRY_BASE", webhookRetryBase)
+		max := utils.GetEnvDuration("WEBHOOK_RETRY_MAX", webhookRetryMax)
+		attempt.NextAttemptAt = time.Now().Add(webhook.Backoff(delivery.Attempts, base, max))
+	}
+	return attempt
+}
@@ -0,0 +1,326 @@
+package controller
+
+import (
+	"instacloneapp/server/pkg/db"
+	"instacloneapp/server/pkg/webhook"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// validWebhookEvents checks that a webhook subscribes to known event types
+func validWebhookEvents(events []string) bool {
+	if len(events) == 0 {
+		return false
+	}
+	for _, event := range events {
+		if event != db.EventAll && !containsString(db.WebhookEvents, event) {
+			return false
+		}
+	}
+	return true
+}
+
+// CreateWebhook registers an endpoint for the caller. Only admins may register
+// one for all users. The signing secret is returned this once.
+func CreateWebhook() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := primitive.ObjectIDFromHex(getUserIDFromContext(c))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid User ID"})
+			return
+		}
+
+		var req struct {
+			URL         string   `json:"url"`
+			Events      []string `json:"events"`
+			Description string   `json:"description"`
+			AllUsers    bool     `json:"allUsers"`
+		}
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid input"})
+			return
+		}
+		if err := webhook.ValidateURL(req.URL); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid webhook URL: " + err.Error()})
+			return
+		}
+		if !validWebhookEvents(req.Events) {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Unknown or missing event types"})
+			return
+		}
+
+		if req.AllUsers {
+			user, err := dbInstance.GetUserByID(userID)
+			if err != nil || !user.IsAdmin {
+				c.JSON(http.StatusForbidden, gin.H{"message": "Only admins can register webhooks for all users"})
+				return
+			}
+		}
+
+		secret, err := webhook.GenerateSecret()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error creating webhook"})
+			return
+		}
+
+		hook, err := dbInstance.CreateWebhook(db.Webhook{
+			OwnerID:     userID,
+			URL:         req.URL,
+			Secret:      secret,
+			Events:      req.Events,
+			AllUsers:    req.AllUsers,
+			Active:      true,
+			Description: req.Description,
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error creating webhook"})
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{
+			"message": "Webhook created",
+			"success": true,
+			"webhook": hook,
+			"secret":  secret,
+		})
+	}
+}
+
+// GetWebhooks lists the caller's webhooks
+func GetWebhooks() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := primitive.ObjectIDFromHex(getUserIDFromContext(c))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid User ID"})
+			return
+		}
+
+		webhooks, err := dbInstance.GetWebhooksByOwner(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving webhooks"})
+			return
+		}
+		if webhooks == nil {
+			webhooks = []db.Webhook{}
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"success":  true,
+			"webhooks": webhooks,
+		})
+	}
+}
+
+// UpdateWebhook changes the URL, events, description or active state of one
+// of the caller's webhooks
+func UpdateWebhook() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		hook, ok := loadWebhookForOwner(c)
+		if !ok {
+			return
+		}
+
+		var req struct {
+			URL         *string  `json:"url"`
+			Events      []string `json:"events"`
+			Description *string  `json:"description"`
+			Active      *bool    `json:"active"`
+		}
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid input"})
+			return
+		}
+
+		set := bson.M{"updatedAt": time.Now()}
+		if req.URL != nil {
+			if err := webhook.ValidateURL(*req.URL); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid webhook URL: " + err.Error()})
+				return
+			}
+			set["url"] = *req.URL
+		}
+		if req.Events != nil {
+			if !validWebhookEvents(req.Events) {
+				c.JSON(http.StatusBadRequest, gin.H{"message": "Unknown or missing event types"})
+				return
+			}
+			set["events"] = req.Events
+		}
+		if req.Description != nil {
+			set["description"] = *req.Description
+		}
+		if req.Active != nil {
+			set["active"] = *req.Active
+		}
+
+		if err := dbInstance.UpdateWebhook(hook.ID, bson.M{"$set": set}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error updating webhook"})
+			return
+		}
+
+		updated, err := dbInstance.GetWebhookByID(hook.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving webhook"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Webhook updated",
+			"success": true,
+			"webhook": updated,
+		})
+	}
+}
+
+// RotateWebhookSecret replaces the signing secret of one of the caller's
+// webhooks and returns the new one
+func RotateWebhookSecret() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		hook, ok := loadWebhookForOwner(c)
+		if !ok {
+			return
+		}
+
+		secret, err := webhook.GenerateSecret()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error rotating secret"})
+			return
+		}
+		update := bson.M{"$set": bson.M{"secret": secret, "updatedAt": time.Now()}}
+		if err := dbInstance.UpdateWebhook(hook.ID, update); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error rotating secret"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Webhook secret rotated",
+			"success": true,
+			"secret":  secret,
+		})
+	}
+}
+
+// DeleteWebhook removes one of the caller's webhooks and its delivery log
+func DeleteWebhook() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		hook, ok := loadWebhookForOwner(c)
+		if !ok {
+			return
+		}
+
+		if err := dbInstance.DeleteWebhook(hook.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error deleting webhook"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Webhook deleted",
+			"success": true,
+		})
+	}
+}
+
+// GetWebhookDeliveries retrieves a page of the delivery log of one of the
+// caller's webhooks, newest first
+func GetWebhookDeliveries() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		hook, ok := loadWebhookForOwner(c)
+		if !ok {
+			return
+		}
+
+		page, limit, skip := getPagination(c)
+		deliveries, err := dbInstance.GetWebhookDeliveries(hook.ID, skip, limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error retrieving deliveries"})
+			return
+		}
+		if deliveries == nil {
+			deliveries = []db.WebhookDelivery{}
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"success":    true,
+			"deliveries": deliveries,
+			"page":       page,
+			"limit":      limit,
+		})
+	}
+}
+
+// RedeliverWebhookDelivery sends a logged event to one of the caller's
+// webhooks again, as a new delivery with a fresh set of attempts
+func RedeliverWebhookDelivery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		hook, ok := loadWebhookForOwner(c)
+		if !ok {
+			return
+		}
+
+		deliveryID, err := primitive.ObjectIDFromHex(c.Param("deliveryId"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid delivery ID"})
+			return
+		}
+		original, err := dbInstance.GetWebhookDelivery(deliveryID)
+		if err != nil || original.WebhookID != hook.ID {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Delivery not found"})
+			return
+		}
+		if !hook.Active {
+			c.JSON(http.StatusConflict, gin.H{"message": "Webhook is disabled"})
+			return
+		}
+
+		now := time.Now()
+		redelivery := db.WebhookDelivery{
+			ID:            primitive.NewObjectID(),
+			WebhookID:     hook.ID,
+			EventID:       original.EventID,
+			Event:         original.Event,
+			Payload:       original.Payload,
+			Status:        db.DeliveryPending,
+			NextAttemptAt: now,
+			Redelivery:    true,
+			CreatedAt:     now,
+		}
+		if err := dbInstance.CreateWebhookDeliveries([]db.WebhookDelivery{redelivery}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error queueing redelivery"})
+			return
+		}
+		wakeWebhookWorker()
+
+		c.JSON(http.StatusAccepted, gin.H{
+			"message":  "Redelivery queued",
+			"success":  true,
+			"delivery": redelivery,
+		})
+	}
+}
+
+// loadWebhookForOwner loads the webhook named by :id if the caller owns it. It
+// writes the error response itself and returns false when the request should stop.
+func loadWebhookForOwner(c *gin.Context) (*db.Webhook, bool) {
+	userID, err := primitive.ObjectIDFromHex(getUserIDFromContext(c))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid User ID"})
+		return nil, false
+	}
+
+	webhookID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid webhook ID"})
+		return nil, false
+	}
+
+	hook, err := dbInstance.GetWebhookByID(webhookID)
+	if err != nil || hook.OwnerID != userID {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Webhook not found"})
+		return nil, false
+	}
+	return hook, true
+}
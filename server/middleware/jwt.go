@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"fmt"
+	"instacloneapp/server/utils"
 	"net/http"
 	"os"
 
@@ -32,6 +33,17 @@ func IsAuthenticated() gin.HandlerFunc {
 	}
 }
 
+// OptionalAuthentication identifies logged in callers but lets anonymous ones
+// through, for routes whose response depends on who is asking
+func OptionalAuthentication() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if claims, err := extractClaims(c); err == nil {
+			c.Set("userID", claims["userID"])
+		}
+		c.Next()
+	}
+}
+
 // Extract claims from the token
 func extractClaims(c *gin.Context) (map[string]interface{}, error) {
 	// Load environment variables from .env file (if using godotenv)
@@ -48,6 +60,61 @@ func extractClaims(c *gin.Context) (map[string]interface{}, error) {
 
 	//fmt.Println("Token from cookie:", tokenString)
 
+	claims, err := parseToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	// Socket tickets travel in URLs, so they must not work as session tokens
+	if _, isTicket := claims["purpose"]; isTicket {
+		return nil, fmt.Errorf("invalid token purpose")
+	}
+	return claims, nil
+}
+
+// AuthenticateSocket identifies the user opening a websocket connection, either
+// from the session cookie or from a socket ticket in the "ticket" query
+// parameter for clients that can't send the cookie
+func AuthenticateSocket(c *gin.Context) (string, error) {
+	if claims, err := extractClaims(c); err == nil {
+		return userIDFromClaims(claims)
+	}
+
+	ticket := c.Query("ticket")
+	if ticket == "" {
+		return "", fmt.Errorf("no session or socket ticket")
+	}
+
+	claims, err := parseToken(ticket)
+	if err != nil {
+		return "", err
+	}
+	if claims["purpose"] != utils.SocketTicketPurpose {
+		return "", fmt.Errorf("invalid token purpose")
+	}
+	return userIDFromClaims(claims)
+}
+
+// AuthenticateUnsubscribe identifies the user an unsubscribe link in an email
+// was made for, from its signed "token" query parameter
+func AuthenticateUnsubscribe(c *gin.Context) (string, error) {
+	token := c.Query("token")
+	if token == "" {
+		return "", fmt.Errorf("no unsubscribe token")
+	}
+
+	claims, err := parseToken(token)
+	if err != nil {
+		return "", err
+	}
+	if claims["purpose"] != utils.UnsubscribePurpose {
+		return "", fmt.Errorf("invalid token purpose")
+	}
+	return userIDFromClaims(claims)
+}
+
+// parseToken validates a signed token and returns its claims
+func parseToken(tokenString string) (jwt.MapClaims, error) {
 	// Parse the token
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		// Validate the token's signing method
@@ -69,3 +136,12 @@ func extractClaims(c *gin.Context) (map[string]interface{}, error) {
 
 	return nil, fmt.Errorf("invalid token claims")
 }
+
+// userIDFromClaims reads the user ID a token was issued for
+func userIDFromClaims(claims jwt.MapClaims) (string, error) {
+	userID, ok := claims["userID"].(string)
+	if !ok || userID == "" {
+		return "", fmt.Errorf("token has no user ID")
+	}
+	return userID, nil
+}
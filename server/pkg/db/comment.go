@@ -1,12 +1,24 @@
 package db
 
 import (
+	"time"
+
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// Comment represents a comment on a post. Replies point at their top-level
+// comment through ParentID; threads are only one level deep. ReplyTo is the
+// author of the comment a reply answers, which may itself be a reply.
 type Comment struct {
-	ID     primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
-	Text   string             `bson:"text" json:"text"`
-	Author primitive.ObjectID `bson:"author,omitempty" json:"author,omitempty"`
-	Post   primitive.ObjectID `bson:"post,omitempty" json:"post,omitempty"`
+	ID         primitive.ObjectID   `bson:"_id,omitempty" json:"id,omitempty"`
+	Text       string               `bson:"text" json:"text"`
+	Author     primitive.ObjectID   `bson:"author,omitempty" json:"author,omitempty"`
+	Post       primitive.ObjectID   `bson:"post,omitempty" json:"post,omitempty"`
+	ParentID   primitive.ObjectID   `bson:"parentId,omitempty" json:"parentId,omitempty"`
+	ReplyTo    primitive.ObjectID   `bson:"replyTo,omitempty" json:"replyTo,omitempty"`
+	Mentions   []Mention            `bson:"mentions,omitempty" json:"mentions,omitempty"`
+	Likes      []primitive.ObjectID `bson:"likes,omitempty" json:"likes,omitempty"`
+	ReplyCount int                  `bson:"replyCount" json:"replyCount"`
+	CreatedAt  time.Time            `bson:"createdAt,omitempty" json:"createdAt,omitempty"`
+	UpdatedAt  time.Time            `bson:"updatedAt,omitempty" json:"updatedAt,omitempty"`
 }
@@ -1,11 +1,62 @@
 package db
 
 import (
+	"time"
+
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// Group conversations hold between MinGroupMembers and MaxGroupMembers participants
+const (
+	MinGroupMembers = 3
+	MaxGroupMembers = 64
+)
+
+// Conversation is either a direct conversation between exactly two users or,
+// when IsGroup is set, a named group whose admins manage its membership.
 type Conversation struct {
 	ID           primitive.ObjectID   `bson:"_id,omitempty" json:"id,omitempty"`
+	IsGroup      bool                 `bson:"isGroup,omitempty" json:"isGroup,omitempty"`
+	Name         string               `bson:"name,omitempty" json:"name,omitempty"`
 	Participants []primitive.ObjectID `bson:"participants,omitempty" json:"participants,omitempty"`
+	Admins       []primitive.ObjectID `bson:"admins,omitempty" json:"admins,omitempty"`
+	CreatedBy    primitive.ObjectID   `bson:"createdBy,omitempty" json:"createdBy,omitempty"`
+	Status       string               `bson:"status,omitempty" json:"status,omitempty"`
+	RequestedOf  primitive.ObjectID   `bson:"requestedOf,omitempty" json:"requestedOf,omitempty"`
 	Messages     []primitive.ObjectID `bson:"messages,omitempty" json:"messages,omitempty"`
+	LastMessage  *MessagePreview      `bson:"lastMessage,omitempty" json:"lastMessage,omitempty"`
+	UnreadCounts map[string]int       `bson:"unreadCounts,omitempty" json:"-"` // keyed by participant ID hex
+	CreatedAt    time.Time            `bson:"createdAt,omitempty" json:"createdAt,omitempty"`
+	UpdatedAt    time.Time            `bson:"updatedAt,omitempty" json:"updatedAt,omitempty"`
+}
+
+// ConversationPending marks a direct conversation started by someone the
+// recipient doesn't follow. It stays in the recipient's requests folder until
+// they accept it; conversations without a status are accepted.
+const ConversationPending = "pending"
+
+// IsPending reports whether the conversation is an unanswered message request
+func (c *Conversation) IsPending() bool {
+	return c.Status == ConversationPending
+}
+
+// IsPendingFor reports whether the conversation is a message request awaiting the user's answer
+func (c *Conversation) IsPendingFor(userID primitive.ObjectID) bool {
+	return c.IsPending() && c.RequestedOf == userID
+}
+
+// MessagePreview is the short summary of a conversation's latest message shown in the inbox
+type MessagePreview struct {
+	ID        primitive.ObjectID `bson:"id" json:"id"`
+	SenderID  primitive.ObjectID `bson:"senderId" json:"senderId"`
+	Text      string             `bson:"text" json:"text"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+}
+
+// MessagePreviewLength is the number of characters of a message kept in its preview
+const MessagePreviewLength = 100
+
+// UnreadCountFor returns how many messages the user hasn't read in the conversation
+func (c *Conversation) UnreadCountFor(userID primitive.ObjectID) int {
+	return c.UnreadCounts[userID.Hex()]
 }
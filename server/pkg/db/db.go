@@ -1,6 +1,8 @@
 package db
 
 import (
+	"time"
+
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 )
@@ -10,28 +12,50 @@ type Database interface {
 	GetUserByID(id primitive.ObjectID) (User, error)    // Retrieve a single user by ID
 	CreateUser(User) (User, error)
 	GetUserByEmail(email string) (User, error)                                                                         // Create a new user
+	GetUsersByUsernames(usernames []string) ([]User, error)                                                            // Retrieve users matching any of the usernames
+	GetUsersByIDs(ids []primitive.ObjectID) ([]User, error)                                                            // Retrieve users matching any of the IDs
 	UpdateUser(id primitive.ObjectID, update interface{}) error                                                        // Update a user's information
 	DeleteUser(id primitive.ObjectID) (*mongo.DeleteResult, error)                                                     // Delete a user by ID
 	FollowOrUnfollowUser(followingUserID, targetUserID primitive.ObjectID, action string) (*mongo.UpdateResult, error) // Follow or unfollow a user
+	RequestFollow(requesterID, targetID primitive.ObjectID) error                                                      // Ask to follow a private account
+	RemoveFollowRequest(targetID, requesterID primitive.ObjectID) (bool, error)                                        // Decline or cancel a follow request
+	AcceptFollowRequests(targetID primitive.ObjectID, requesterIDs []primitive.ObjectID) ([]primitive.ObjectID, error) // Turn follow requests into follows
 
 	// Conversation operations
 	GetConversation(senderID, receiverID primitive.ObjectID) (*Conversation, error)
+	GetConversationByID(id primitive.ObjectID) (*Conversation, error)
 	UpdateConversation(id primitive.ObjectID, update interface{}) error
 	CreateConversation(participant1, participant2 primitive.ObjectID) (*Conversation, error)
+	CreateGroupConversation(name string, creatorID primitive.ObjectID, participants []primitive.ObjectID) (*Conversation, error)
+	CreateMessageRequest(senderID, recipientID primitive.ObjectID) (*Conversation, error)
+	GetMessageRequests(userID primitive.ObjectID, skip, limit int64) ([]Conversation, error)
+	AcceptMessageRequest(conversationID primitive.ObjectID) error
+	DeleteConversation(conversationID primitive.ObjectID) error
+	GetConversationContacts(userID primitive.ObjectID) ([]primitive.ObjectID, error)
+	GetConversationsByUser(userID primitive.ObjectID, skip, limit int64) ([]Conversation, error)
+	RecordConversationMessage(conversationID primitive.ObjectID, message Message, recipients []primitive.ObjectID) error
+	MarkConversationRead(conversationID, userID primitive.ObjectID, upTo time.Time, read int64) (int64, error)
 
 	// Message operations
 	GetMessagesByIDs(ids []primitive.ObjectID) ([]Message, error)
-	CreateMessage(senderID, receiverID primitive.ObjectID, messageText string) (*Message, error)
+	CreateMessage(message Message) (*Message, error)
+	GetMessageByID(id primitive.ObjectID) (*Message, error)
+	UpdateMessage(id primitive.ObjectID, update interface{}) error
+	SetMessageReaction(messageID primitive.ObjectID, reaction Reaction) (bool, error)
+	MarkMessagesDelivered(conversationID, userID primitive.ObjectID) ([]Message, error)
+	MarkMessagesRead(conversationID, userID primitive.ObjectID, upTo time.Time) ([]Message, error)
+	SearchMessages(userID primitive.ObjectID, query string, skip, limit int64) ([]Message, error)
 	RemoveBookmarkFromUser(userID, postID primitive.ObjectID) error
 	AddBookmarkToUser(userID, postID primitive.ObjectID) error
 
 	RemovePostFromUser(userID, postID primitive.ObjectID) error
 
-	CreateComment(authorID, postID primitive.ObjectID, text string) (*Comment, error)
+	CreateComment(comment Comment) (*Comment, error)
 
 	DeleteCommentsByPostID(postID primitive.ObjectID) error
 
 	GetPostByID(postID primitive.ObjectID) (*Post, error)
+	UpdatePost(id primitive.ObjectID, update interface{}) error
 
 	RemoveLikeFromPost(postID, userID primitive.ObjectID) error
 
@@ -41,9 +65,65 @@ type Database interface {
 
 	GetCommentsByPostID(postID primitive.ObjectID) ([]Comment, error)
 
+	// Comment thread operations
+	GetCommentByID(commentID primitive.ObjectID) (*Comment, error)
+	GetCommentReplies(parentID primitive.ObjectID, skip, limit int64) ([]Comment, error)
+	UpdateComment(id primitive.ObjectID, update interface{}) error
+	AddLikeToComment(commentID, userID primitive.ObjectID) error
+	RemoveLikeFromComment(commentID, userID primitive.ObjectID) error
+	DeleteCommentThread(commentID primitive.ObjectID) ([]Comment, error)
+	RemoveCommentsFromPost(postID primitive.ObjectID, commentIDs []primitive.ObjectID) error
+
 	CreatePost(post Post) (*Post, error)
 	AddPostToUser(userID primitive.ObjectID, postID primitive.ObjectID) error
 	GetAllPosts() ([]Post, error)
 	GetPostsByUserID(authorID primitive.ObjectID) ([]Post, error)
-	AddLikeToPost(postID, userID primitive.ObjectID) error
+
+	// Draft and scheduled post operations
+	GetDraftsByUserID(authorID primitive.ObjectID) ([]Post, error)
+	PublishPost(postID primitive.ObjectID, lease time.Duration) (*Post, error)
+	ClaimDueScheduledPost(now time.Time, lease time.Duration) (*Post, error)
+	MarkPostPublished(postID, lease primitive.ObjectID, publishedAt time.Time) (bool, error)
+
+	// Archived and soft-deleted post operations
+	GetArchivedPostsByUserID(authorID primitive.ObjectID) ([]Post, error)
+	GetDeletedPostsByUserID(authorID primitive.ObjectID) ([]Post, error)
+	ClaimPostToPurge(cutoff, now time.Time, lease time.Duration) (*Post, error)
+	AddLikeToPost(postID, userID primitive.ObjectID) (bool, error)
+	PinComment(postID, commentID primitive.ObjectID, limit int) (bool, error)
+
+	// Notifications
+	RecordNotification(notification Notification, rule AggregationRule) (*Notification, bool, error)
+	GetNotificationsByUser(userID primitive.ObjectID, skip, limit int64) ([]Notification, error)
+	CountUnreadNotifications(userID primitive.ObjectID) (int64, error)
+	MarkNotificationRead(userID, notificationID primitive.ObjectID) error
+	MarkAllNotificationsRead(userID primitive.ObjectID) (int64, error)
+	WithdrawNotification(recipientID, actorID primitive.ObjectID, notificationType, groupKey string) error
+	GetUnreadNotificationsSince(userID primitive.ObjectID, since time.Time, limit int64) ([]Notification, error)
+	HoldDelivery(delivery HeldDelivery) error
+	ClaimDueDelivery(now time.Time) (*HeldDelivery, error)
+
+	// Email digests
+	ClaimDigestRecipient(now, inactiveSince time.Time) (*User, error)
+	DeferDigestRecipient(userID primitive.ObjectID, claimedAt, previous time.Time, failures int, retryAt time.Time) error
+	GetTopPostsByAuthors(authorIDs []primitive.ObjectID, since time.Time, limit int64) ([]Post, error)
+
+	// Webhooks
+	CreateWebhook(webhook Webhook) (*Webhook, error)
+	GetWebhookByID(id primitive.ObjectID) (*Webhook, error)
+	GetWebhooksByOwner(ownerID primitive.ObjectID) ([]Webhook, error)
+	GetWebhooksForEvent(event string, userIDs []primitive.ObjectID) ([]Webhook, error)
+	UpdateWebhook(id primitive.ObjectID, update interface{}) error
+	DeleteWebhook(id primitive.ObjectID) error
+	CreateWebhookDeliveries(deliveries []WebhookDelivery) error
+	ClaimDueWebhookDelivery(now time.Time, lease time.Duration, skipWebhooks []primitive.ObjectID) (*WebhookDelivery, error)
+	RecordDeliveryAttempt(id primitive.ObjectID, attempt DeliveryAttempt) error
+	GetWebhookDeliveries(webhookID primitive.ObjectID, skip, limit int64) ([]WebhookDelivery, error)
+	GetWebhookDelivery(id primitive.ObjectID) (*WebhookDelivery, error)
+
+	// Web push subscriptions
+	SavePushSubscription(subscription PushSubscription) error
+	GetPushSubscriptions(userID primitive.ObjectID) ([]PushSubscription, error)
+	DeletePushSubscription(userID primitive.ObjectID, endpoint string) error
+	DeletePushSubscriptionByEndpoint(endpoint string) error
 }
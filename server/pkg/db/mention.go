@@ -0,0 +1,15 @@
+package db
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Mention is a resolved @username reference inside a caption or comment.
+// Offset and Length are measured in UTF-16 code units, the way JavaScript
+// indexes strings, so clients can render links.
+type Mention struct {
+	UserID   primitive.ObjectID `bson:"userId" json:"userId"`
+	Username string             `bson:"username" json:"username"`
+	Offset   int                `bson:"offset" json:"offset"`
+	Length   int                `bson:"length" json:"length"`
+}
@@ -1,12 +1,89 @@
 package db
 
 import (
+	"time"
+
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// Message is a single chat message. ReceiverID is only set for direct
+// conversations; group messages are addressed through ConversationID.
 type Message struct {
-	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
-	SenderID   primitive.ObjectID `bson:"senderId,omitempty" json:"senderId,omitempty"`
-	ReceiverID primitive.ObjectID `bson:"receiverId,omitempty" json:"receiverId,omitempty"`
-	Message    string             `bson:"message" json:"message"`
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	ConversationID primitive.ObjectID `bson:"conversationId,omitempty" json:"conversationId,omitempty"`
+	SenderID       primitive.ObjectID `bson:"senderId,omitempty" json:"senderId,omitempty"`
+	ReceiverID     primitive.ObjectID `bson:"receiverId,omitempty" json:"receiverId,omitempty"`
+	Message        string             `bson:"message" json:"message"`
+	Attachment     *Attachment        `bson:"attachment,omitempty" json:"attachment,omitempty"`
+	DeliveredTo    []Receipt          `bson:"deliveredTo,omitempty" json:"deliveredTo,omitempty"`
+	ReadBy         []Receipt          `bson:"readBy,omitempty" json:"readBy,omitempty"`
+	Reactions      []Reaction         `bson:"reactions,omitempty" json:"reactions,omitempty"`
+	EditHistory    []MessageEdit      `bson:"editHistory,omitempty" json:"editHistory,omitempty"`
+	EditedAt       time.Time          `bson:"editedAt,omitempty" json:"editedAt,omitempty"`
+	Unsent         bool               `bson:"unsent,omitempty" json:"unsent,omitempty"`
+	CreatedAt      time.Time          `bson:"createdAt,omitempty" json:"createdAt,omitempty"`
+}
+
+// Attachment types a message can carry
+const (
+	AttachmentImage = "image"
+	AttachmentVideo = "video"
+	AttachmentVoice = "voice"
+	AttachmentPost  = "post"
+)
+
+// Attachment is media or a shared post sent along with a message. Media is
+// stored in the media store and referenced by URL; a shared post is stored by
+// ID and resolved into Post for each viewer when messages are read.
+type Attachment struct {
+	Type     string             `bson:"type" json:"type"`
+	URL      string             `bson:"url,omitempty" json:"url,omitempty"`
+	MimeType string             `bson:"mimeType,omitempty" json:"mimeType,omitempty"`
+	Size     int64              `bson:"size,omitempty" json:"size,omitempty"`
+	PostID   primitive.ObjectID `bson:"postId,omitempty" json:"postId,omitempty"`
+	Post     *SharedPost        `bson:"-" json:"post,omitempty"`
+}
+
+// PreviewText describes the attachment in the inbox when a message has no text
+func (a *Attachment) PreviewText() string {
+	switch a.Type {
+	case AttachmentImage:
+		return "Sent a photo"
+	case AttachmentVideo:
+		return "Sent a video"
+	case AttachmentVoice:
+		return "Sent a voice message"
+	case AttachmentPost:
+		return "Shared a post"
+	}
+	return "Sent an attachment"
+}
+
+// SharedPost is the embedded preview of a post shared in a message. Unavailable
+// is set when the post was deleted or the viewer isn't allowed to see it.
+type SharedPost struct {
+	ID          primitive.ObjectID `json:"id"`
+	Image       string             `json:"image,omitempty"`
+	Caption     string             `json:"caption,omitempty"`
+	Author      primitive.ObjectID `json:"author,omitempty"`
+	Unavailable bool               `json:"unavailable,omitempty"`
+}
+
+// Receipt records when a recipient received or read a message
+type Receipt struct {
+	UserID primitive.ObjectID `bson:"userId" json:"userId"`
+	At     time.Time          `bson:"at" json:"at"`
+}
+
+// Reaction is an emoji a participant attached to a message
+type Reaction struct {
+	UserID primitive.ObjectID `bson:"userId" json:"userId"`
+	Emoji  string             `bson:"emoji" json:"emoji"`
+	At     time.Time          `bson:"at" json:"at"`
+}
+
+// MessageEdit keeps a previous version of an edited message
+type MessageEdit struct {
+	Text     string    `bson:"text" json:"text"`
+	EditedAt time.Time `bson:"editedAt" json:"editedAt"`
 }
@@ -3,6 +3,7 @@ package db
 import (
 	"context"
 	"errors"
+	"strconv"
 	"strings"
 	"time"
 
@@ -31,7 +32,78 @@ func NewMongoDB(uri string, dbName string, collectionNames string) (*MongoDB, er
 		collections[name] = client.Database(dbName).Collection(name)
 	}
 
-	return &MongoDB{client: client, collections: collections}, nil
+	db := &MongoDB{client: client, collections: collections}
+	if err := db.ensureIndexes(); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// ensureIndexes creates the indexes queries rely on. Creating an index that
+// already exists is a no-op, so this is safe to run on every start.
+func (db *MongoDB) ensureIndexes() error {
+	if messages, exists := db.GetCollection("messages"); exists {
+		_, err := messages.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+			Keys:    bson.D{{Key: "message", Value: "text"}},
+			Options: options.Index().SetName("message_text"),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if notifications, exists := db.GetCollection("notifications"); exists {
+		// Finds the open group an aggregated notification joins
+		_, err := notifications.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+			Keys: bson.D{
+				{Key: "recipientId", Value: 1},
+				{Key: "type", Value: 1},
+				{Key: "groupKey", Value: 1},
+				{Key: "createdAt", Value: -1},
+			},
+			Options: options.Index().SetName("notification_group"),
+		})
+		if err != nil {
+			return err
+		}
+		// Makes sure a target has a single group open for new events
+		_, err = notifications.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+			Keys: bson.D{{Key: "openKey", Value: 1}},
+			Options: options.Index().
+				SetName("notification_open_group").
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"openKey": bson.M{"$exists": true}}),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if deliveries, exists := db.GetCollection("webhookDeliveries"); exists {
+		// Finds deliveries due an attempt, and lists a webhook's delivery log
+		_, err := deliveries.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+			{
+				Keys:    bson.D{{Key: "status", Value: 1}, {Key: "nextAttemptAt", Value: 1}},
+				Options: options.Index().SetName("delivery_due"),
+			},
+			{
+				Keys:    bson.D{{Key: "webhookId", Value: 1}, {Key: "createdAt", Value: -1}},
+				Options: options.Index().SetName("delivery_log"),
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if subscriptions, exists := db.GetCollection("pushSubscriptions"); exists {
+		// A browser has one subscription, whichever user it belongs to
+		_, err := subscriptions.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+			Keys:    bson.D{{Key: "endpoint", Value: 1}},
+			Options: options.Index().SetName("push_endpoint").SetUnique(true),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (db *MongoDB) GetCollection(name string) (*mongo.Collection, bool) {
@@ -164,6 +236,46 @@ func (db *MongoDB) GetUserByID(id primitive.ObjectID) (User, error) {
 	return user, err
 }
 
+// GetUsersByIDs retrieves all users whose ID is in the given list
+func (db *MongoDB) GetUsersByIDs(ids []primitive.ObjectID) ([]User, error) {
+	collection, exists := db.GetCollection("users")
+	if !exists {
+		return nil, errors.New("collection 'users' does not exist")
+	}
+
+	cursor, err := collection.Find(context.Background(), bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var users []User
+	if err := cursor.All(context.Background(), &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// GetUsersByUsernames retrieves all users whose username is in the given list
+func (db *MongoDB) GetUsersByUsernames(usernames []string) ([]User, error) {
+	collection, exists := db.GetCollection("users")
+	if !exists {
+		return nil, errors.New("collection 'users' does not exist")
+	}
+
+	cursor, err := collection.Find(context.Background(), bson.M{"username": bson.M{"$in": usernames}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var users []User
+	if err := cursor.All(context.Background(), &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
 func (db *MongoDB) DeleteUser(id primitive.ObjectID) (*mongo.DeleteResult, error) {
 	collection, exists := db.GetCollection("users") // Specify the collection name
 	if !exists {
@@ -194,6 +306,76 @@ func (db *MongoDB) FollowOrUnfollowUser(followingUserID, targetUserID primitive.
 	return collection.UpdateOne(context.Background(), filter, update)
 }
 
+// RequestFollow records a pending request to follow a private account
+func (db *MongoDB) RequestFollow(requesterID, targetID primitive.ObjectID) error {
+	collection, exists := db.GetCollection("users")
+	if !exists {
+		return errors.New("collection 'users' does not exist")
+	}
+
+	update := bson.M{"$addToSet": bson.M{"followRequests": requesterID}}
+	_, err := collection.UpdateOne(context.Background(), bson.M{"_id": targetID}, update)
+	return err
+}
+
+// RemoveFollowRequest drops a pending follow request without following. It
+// reports whether there was a request to drop.
+func (db *MongoDB) RemoveFollowRequest(targetID, requesterID primitive.ObjectID) (bool, error) {
+	collection, exists := db.GetCollection("users")
+	if !exists {
+		return false, errors.New("collection 'users' does not exist")
+	}
+
+	filter := bson.M{"_id": targetID, "followRequests": requesterID}
+	update := bson.M{"$pull": bson.M{"followRequests": requesterID}}
+	result, err := collection.UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+// AcceptFollowRequests makes the requesters follow the target account. A nil
+// list accepts every pending request. Only requests still pending are accepted,
+// so concurrent calls don't accept one twice; the accepted requesters are returned.
+func (db *MongoDB) AcceptFollowRequests(targetID primitive.ObjectID, requesterIDs []primitive.ObjectID) ([]primitive.ObjectID, error) {
+	collection, exists := db.GetCollection("users")
+	if !exists {
+		return nil, errors.New("collection 'users' does not exist")
+	}
+
+	update := bson.M{"$unset": bson.M{"followRequests": ""}}
+	if requesterIDs != nil {
+		update = bson.M{"$pullAll": bson.M{"followRequests": requesterIDs}}
+	}
+	opts := options.FindOneAndUpdate().
+		SetReturnDocument(options.Before).
+		SetProjection(bson.M{"followRequests": 1})
+
+	var before User
+	err := collection.FindOneAndUpdate(context.Background(), bson.M{"_id": targetID}, update, opts).Decode(&before)
+	if err != nil {
+		return nil, err
+	}
+
+	var accepted []primitive.ObjectID
+	for _, requesterID := range before.FollowRequests {
+		if requesterIDs == nil || containsObjectID(requesterIDs, requesterID) {
+			accepted = append(accepted, requesterID)
+		}
+	}
+	if len(accepted) == 0 {
+		return nil, nil
+	}
+
+	filter := bson.M{"_id": bson.M{"$in": accepted}}
+	_, err = collection.UpdateMany(context.Background(), filter, bson.M{"$addToSet": bson.M{"following": targetID}})
+	if err != nil {
+		return nil, err
+	}
+	return accepted, nil
+}
+
 // GetConversation retrieves a conversation by participants' IDs
 func (db *MongoDB) GetConversation(senderID, receiverID primitive.ObjectID) (*Conversation, error) {
 	collection, exists := db.GetCollection("conversations") // Get the collection and existence flag
@@ -201,8 +383,10 @@ func (db *MongoDB) GetConversation(senderID, receiverID primitive.ObjectID) (*Co
 		return nil, errors.New("collection 'conversations' does not exist")
 	}
 
+	// Only match the direct conversation, not a group that happens to contain both users
 	filter := bson.M{
-		"participants": bson.M{"$all": []primitive.ObjectID{senderID, receiverID}},
+		"participants": bson.M{"$all": []primitive.ObjectID{senderID, receiverID}, "$size": 2},
+		"isGroup":      bson.M{"$ne": true},
 	}
 	var conversation Conversation
 	err := collection.FindOne(context.Background(), filter).Decode(&conversation)
@@ -215,6 +399,21 @@ func (db *MongoDB) GetConversation(senderID, receiverID primitive.ObjectID) (*Co
 	return &conversation, nil
 }
 
+// GetConversationByID retrieves a conversation by its ID
+func (db *MongoDB) GetConversationByID(id primitive.ObjectID) (*Conversation, error) {
+	collection, exists := db.GetCollection("conversations")
+	if !exists {
+		return nil, errors.New("collection 'conversations' does not exist")
+	}
+
+	var conversation Conversation
+	err := collection.FindOne(context.Background(), bson.M{"_id": id}).Decode(&conversation)
+	if err != nil {
+		return nil, err
+	}
+	return &conversation, nil
+}
+
 // UpdateConversation updates a conversation with the provided data
 func (db *MongoDB) UpdateConversation(id primitive.ObjectID, update interface{}) error {
 	collection, exists := db.GetCollection("conversations") // Get the collection and existence flag
@@ -228,17 +427,14 @@ func (db *MongoDB) UpdateConversation(id primitive.ObjectID, update interface{})
 }
 
 // CreateMessage creates a new message
-func (db *MongoDB) CreateMessage(senderID, receiverID primitive.ObjectID, messageText string) (*Message, error) {
+func (db *MongoDB) CreateMessage(message Message) (*Message, error) {
+	message.CreatedAt = time.Now()
+
 	collection, exists := db.GetCollection("messages") // Get the collection and existence flag
 	if !exists {
 		return nil, errors.New("collection 'messages' does not exist")
 	}
 
-	message := Message{
-		SenderID:   senderID,
-		ReceiverID: receiverID,
-		Message:    messageText,
-	}
 	result, err := collection.InsertOne(context.Background(), message)
 	if err != nil {
 		return nil, err
@@ -247,6 +443,131 @@ func (db *MongoDB) CreateMessage(senderID, receiverID primitive.ObjectID, messag
 	return &message, nil
 }
 
+// GetMessageByID retrieves a message by its ID
+func (db *MongoDB) GetMessageByID(id primitive.ObjectID) (*Message, error) {
+	collection, exists := db.GetCollection("messages")
+	if !exists {
+		return nil, errors.New("collection 'messages' does not exist")
+	}
+
+	var message Message
+	err := collection.FindOne(context.Background(), bson.M{"_id": id}).Decode(&message)
+	if err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+// UpdateMessage updates a message with the provided data
+func (db *MongoDB) UpdateMessage(id primitive.ObjectID, update interface{}) error {
+	collection, exists := db.GetCollection("messages")
+	if !exists {
+		return errors.New("collection 'messages' does not exist")
+	}
+
+	_, err := collection.UpdateOne(context.Background(), bson.M{"_id": id}, update)
+	return err
+}
+
+// SetMessageReaction sets the user's reaction on a message, replacing any
+// reaction they left before, in a single update so each participant keeps at
+// most one. It reports false when the message was unsent, and leaves it alone.
+func (db *MongoDB) SetMessageReaction(messageID primitive.ObjectID, reaction Reaction) (bool, error) {
+	collection, exists := db.GetCollection("messages")
+	if !exists {
+		return false, errors.New("collection 'messages' does not exist")
+	}
+
+	filter := bson.M{"_id": messageID, "unsent": bson.M{"$ne": true}}
+	update := bson.A{bson.M{"$set": bson.M{
+		"reactions": bson.M{"$concatArrays": bson.A{
+			bson.M{"$filter": bson.M{
+				"input": bson.M{"$ifNull": bson.A{"$reactions", bson.A{}}},
+				"cond":  bson.M{"$ne": bson.A{"$$this.userId", reaction.UserID}},
+			}},
+			// The emoji comes from the client, so keep it from being read as an expression
+			bson.A{bson.M{"$literal": reaction}},
+		}},
+	}}}
+	result, err := collection.UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+// MarkMessagesDelivered records delivery to the user of every message in the
+// conversation they haven't received yet, and returns the messages it updated
+func (db *MongoDB) MarkMessagesDelivered(conversationID, userID primitive.ObjectID) ([]Message, error) {
+	filter := bson.M{
+		"conversationId":     conversationID,
+		"senderId":           bson.M{"$ne": userID},
+		"deliveredTo.userId": bson.M{"$ne": userID},
+	}
+	return db.addMessageReceipts(filter, "deliveredTo", userID)
+}
+
+// MarkMessagesRead records that the user has read every message in the
+// conversation sent up to the given time, and returns the messages it updated.
+// Reading a message also marks it delivered.
+func (db *MongoDB) MarkMessagesRead(conversationID, userID primitive.ObjectID, upTo time.Time) ([]Message, error) {
+	filter := bson.M{
+		"conversationId": conversationID,
+		"senderId":       bson.M{"$ne": userID},
+		"createdAt":      bson.M{"$lte": upTo},
+		"readBy.userId":  bson.M{"$ne": userID},
+	}
+	messages, err := db.addMessageReceipts(filter, "readBy", userID)
+	if err != nil || len(messages) == 0 {
+		return messages, err
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(messages))
+	for _, message := range messages {
+		ids = append(ids, message.ID)
+	}
+	_, err = db.addMessageReceipts(bson.M{
+		"_id":                bson.M{"$in": ids},
+		"deliveredTo.userId": bson.M{"$ne": userID},
+	}, "deliveredTo", userID)
+	return messages, err
+}
+
+// addMessageReceipts pushes a receipt for the user onto the given receipt list
+// of every message matching the filter
+func (db *MongoDB) addMessageReceipts(filter bson.M, field string, userID primitive.ObjectID) ([]Message, error) {
+	collection, exists := db.GetCollection("messages")
+	if !exists {
+		return nil, errors.New("collection 'messages' does not exist")
+	}
+
+	cursor, err := collection.Find(context.Background(), filter)
+	if err != nil {
+		return nil, err
+	}
+	var messages []Message
+	if err := cursor.All(context.Background(), &messages); err != nil {
+		return nil, err
+	}
+	if len(messages) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(messages))
+	for _, message := range messages {
+		ids = append(ids, message.ID)
+	}
+
+	// Re-check the filter so a receipt is never added twice by concurrent calls
+	receipt := Receipt{UserID: userID, At: time.Now()}
+	filter["_id"] = bson.M{"$in": ids}
+	_, err = collection.UpdateMany(context.Background(), filter, bson.M{"$push": bson.M{field: receipt}})
+	if err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
 // CreateConversation creates a new conversation
 func (db *MongoDB) CreateConversation(participant1, participant2 primitive.ObjectID) (*Conversation, error) {
 	collection, exists := db.GetCollection("conversations") // Get the collection and existence flag
@@ -256,7 +577,214 @@ func (db *MongoDB) CreateConversation(participant1, participant2 primitive.Objec
 
 	conversation := Conversation{
 		Participants: []primitive.ObjectID{participant1, participant2},
+		CreatedAt:    time.Now(),
+	}
+	conversation.UpdatedAt = conversation.CreatedAt
+	result, err := collection.InsertOne(context.Background(), conversation)
+	if err != nil {
+		return nil, err
+	}
+	conversation.ID = result.InsertedID.(primitive.ObjectID)
+	return &conversation, nil
+}
+
+// GetConversationsByUser retrieves a page of the user's conversations, most recently active first
+func (db *MongoDB) GetConversationsByUser(userID primitive.ObjectID, skip, limit int64) ([]Conversation, error) {
+	// The message ID list can be long and the inbox doesn't need it
+	opts := options.Find().
+		SetSort(bson.D{{Key: "updatedAt", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(skip).
+		SetLimit(limit).
+		SetProjection(bson.M{"messages": 0})
+
+	// Requests the user hasn't accepted yet live in their requests folder instead
+	filter := bson.M{
+		"participants": userID,
+		"$nor":         bson.A{bson.M{"status": ConversationPending, "requestedOf": userID}},
+	}
+	return db.findConversations(filter, opts)
+}
+
+// CreateMessageRequest starts a direct conversation that waits for the recipient to accept it
+func (db *MongoDB) CreateMessageRequest(senderID, recipientID primitive.ObjectID) (*Conversation, error) {
+	collection, exists := db.GetCollection("conversations")
+	if !exists {
+		return nil, errors.New("collection 'conversations' does not exist")
+	}
+
+	conversation := Conversation{
+		Participants: []primitive.ObjectID{senderID, recipientID},
+		CreatedBy:    senderID,
+		Status:       ConversationPending,
+		RequestedOf:  recipientID,
+		CreatedAt:    time.Now(),
+	}
+	conversation.UpdatedAt = conversation.CreatedAt
+	result, err := collection.InsertOne(context.Background(), conversation)
+	if err != nil {
+		return nil, err
+	}
+	conversation.ID = result.InsertedID.(primitive.ObjectID)
+	return &conversation, nil
+}
+
+// GetMessageRequests retrieves a page of the requests waiting for the user's answer, newest first
+func (db *MongoDB) GetMessageRequests(userID primitive.ObjectID, skip, limit int64) ([]Conversation, error) {
+	opts := options.Find().
+		SetSort(bson.D{{Key: "updatedAt", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(skip).
+		SetLimit(limit).
+		SetProjection(bson.M{"messages": 0})
+
+	return db.findConversations(bson.M{"status": ConversationPending, "requestedOf": userID}, opts)
+}
+
+// AcceptMessageRequest moves a request into both participants' inboxes
+func (db *MongoDB) AcceptMessageRequest(conversationID primitive.ObjectID) error {
+	return db.UpdateConversation(conversationID, bson.M{"$unset": bson.M{"status": "", "requestedOf": ""}})
+}
+
+// DeleteConversation removes a conversation together with its messages
+func (db *MongoDB) DeleteConversation(conversationID primitive.ObjectID) error {
+	conversations, exists := db.GetCollection("conversations")
+	if !exists {
+		return errors.New("collection 'conversations' does not exist")
+	}
+	messages, exists := db.GetCollection("messages")
+	if !exists {
+		return errors.New("collection 'messages' does not exist")
+	}
+
+	if _, err := messages.DeleteMany(context.Background(), bson.M{"conversationId": conversationID}); err != nil {
+		return err
+	}
+	_, err := conversations.DeleteOne(context.Background(), bson.M{"_id": conversationID})
+	return err
+}
+
+// GetConversationContacts lists everyone the user shares an accepted conversation with
+func (db *MongoDB) GetConversationContacts(userID primitive.ObjectID) ([]primitive.ObjectID, error) {
+	collection, exists := db.GetCollection("conversations")
+	if !exists {
+		return nil, errors.New("collection 'conversations' does not exist")
+	}
+
+	filter := bson.M{"participants": userID, "status": bson.M{"$ne": ConversationPending}}
+	values, err := collection.Distinct(context.Background(), "participants", filter)
+	if err != nil {
+		return nil, err
+	}
+
+	contacts := make([]primitive.ObjectID, 0, len(values))
+	for _, value := range values {
+		if id, ok := value.(primitive.ObjectID); ok && id != userID {
+			contacts = append(contacts, id)
+		}
+	}
+	return contacts, nil
+}
+
+// findConversations runs a conversation query and decodes every result
+func (db *MongoDB) findConversations(filter bson.M, opts *options.FindOptions) ([]Conversation, error) {
+	collection, exists := db.GetCollection("conversations")
+	if !exists {
+		return nil, errors.New("collection 'conversations' does not exist")
+	}
+
+	cursor, err := collection.Find(context.Background(), filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var conversations []Conversation
+	if err := cursor.All(context.Background(), &conversations); err != nil {
+		return nil, err
+	}
+	return conversations, nil
+}
+
+// RecordConversationMessage appends a message to a conversation, updates its
+// last message preview and bumps the unread count of every recipient
+func (db *MongoDB) RecordConversationMessage(conversationID primitive.ObjectID, message Message, recipients []primitive.ObjectID) error {
+	text := []rune(message.Message)
+	if len(text) == 0 && message.Attachment != nil {
+		text = []rune(message.Attachment.PreviewText())
+	}
+	if len(text) > MessagePreviewLength {
+		text = text[:MessagePreviewLength]
+	}
+
+	unread := bson.M{}
+	for _, recipient := range recipients {
+		unread["unreadCounts."+recipient.Hex()] = 1
+	}
+
+	update := bson.M{
+		"$push": bson.M{"messages": message.ID},
+		"$set": bson.M{
+			"lastMessage": MessagePreview{
+				ID:        message.ID,
+				SenderID:  message.SenderID,
+				Text:      string(text),
+				CreatedAt: message.CreatedAt,
+			},
+			"updatedAt": message.CreatedAt,
+		},
 	}
+	if len(unread) > 0 {
+		update["$inc"] = unread
+	}
+	return db.UpdateConversation(conversationID, update)
+}
+
+// MarkConversationRead updates the user's unread count after they read the
+// conversation up to upTo, which marked read messages as read. The count drops
+// to zero if nothing newer has been sent, and otherwise by the number read, so
+// messages that arrive meanwhile stay counted. It returns the new count.
+func (db *MongoDB) MarkConversationRead(conversationID, userID primitive.ObjectID, upTo time.Time, read int64) (int64, error) {
+	collection, exists := db.GetCollection("conversations")
+	if !exists {
+		return 0, errors.New("collection 'conversations' does not exist")
+	}
+
+	field := "unreadCounts." + userID.Hex()
+	update := bson.A{
+		bson.M{"$set": bson.M{field: bson.M{"$cond": bson.A{
+			bson.M{"$lte": bson.A{"$lastMessage.createdAt", upTo}},
+			0,
+			bson.M{"$max": bson.A{0, bson.M{"$subtract": bson.A{bson.M{"$ifNull": bson.A{"$" + field, 0}}, read}}}},
+		}}}},
+	}
+	var conversation Conversation
+	err := collection.FindOneAndUpdate(
+		context.Background(),
+		bson.M{"_id": conversationID},
+		update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&conversation)
+	if err != nil {
+		return 0, err
+	}
+	return int64(conversation.UnreadCountFor(userID)), nil
+}
+
+// CreateGroupConversation creates a named group with the creator as its first admin
+func (db *MongoDB) CreateGroupConversation(name string, creatorID primitive.ObjectID, participants []primitive.ObjectID) (*Conversation, error) {
+	collection, exists := db.GetCollection("conversations")
+	if !exists {
+		return nil, errors.New("collection 'conversations' does not exist")
+	}
+
+	conversation := Conversation{
+		IsGroup:      true,
+		Name:         name,
+		Participants: participants,
+		Admins:       []primitive.ObjectID{creatorID},
+		CreatedBy:    creatorID,
+		CreatedAt:    time.Now(),
+	}
+	conversation.UpdatedAt = conversation.CreatedAt
 	result, err := collection.InsertOne(context.Background(), conversation)
 	if err != nil {
 		return nil, err
@@ -311,17 +839,14 @@ func (db *MongoDB) RemovePostFromUser(userID, postID primitive.ObjectID) error {
 }
 
 // CreateComment creates a new comment
-func (db *MongoDB) CreateComment(authorID, postID primitive.ObjectID, text string) (*Comment, error) {
+func (db *MongoDB) CreateComment(comment Comment) (*Comment, error) {
+	comment.CreatedAt = time.Now()
+
 	collection, exists := db.GetCollection("comments") // Get the collection and existence flag
 	if !exists {
 		return nil, errors.New("collection 'comments' does not exist")
 	}
 
-	comment := Comment{
-		Author: authorID,
-		Post:   postID,
-		Text:   text,
-	}
 	result, err := collection.InsertOne(context.Background(), comment)
 	if err != nil {
 		return nil, err
@@ -356,6 +881,17 @@ func (db *MongoDB) GetPostByID(postID primitive.ObjectID) (*Post, error) {
 	return &post, nil
 }
 
+// UpdatePost updates a post with the provided data
+func (db *MongoDB) UpdatePost(id primitive.ObjectID, update interface{}) error {
+	collection, exists := db.GetCollection("posts")
+	if !exists {
+		return errors.New("collection 'posts' does not exist")
+	}
+
+	_, err := collection.UpdateOne(context.Background(), bson.M{"_id": id}, update)
+	return err
+}
+
 // RemoveLikeFromPost removes a like from a post
 func (db *MongoDB) RemoveLikeFromPost(postID, userID primitive.ObjectID) error {
 	collection, exists := db.GetCollection("posts") // Get the collection and existence flag
@@ -371,11 +907,33 @@ func (db *MongoDB) RemoveLikeFromPost(postID, userID primitive.ObjectID) error {
 	return err
 }
 
-// AddCommentToPost adds a comment to a post
-func (db *MongoDB) AddCommentToPost(postID, commentID primitive.ObjectID) error {
-	collection, exists := db.GetCollection("posts") // Get the collection and existence flag
+// PinComment adds a comment to the post's pinned comments as long as fewer
+// than limit are pinned. The limit is part of the update's filter, so
+// concurrent pins can't go past it. It reports whether the comment is pinned.
+func (db *MongoDB) PinComment(postID, commentID primitive.ObjectID, limit int) (bool, error) {
+	collection, exists := db.GetCollection("posts")
 	if !exists {
-		return errors.New("collection 'posts' does not exist")
+		return false, errors.New("collection 'posts' does not exist")
+	}
+	filter := bson.M{
+		"_id": postID,
+		"$or": bson.A{
+			bson.M{"pinnedComments." + strconv.Itoa(limit-1): bson.M{"$exists": false}},
+			bson.M{"pinnedComments": commentID},
+		},
+	}
+	result, err := collection.UpdateOne(context.Background(), filter, bson.M{"$addToSet": bson.M{"pinnedComments": commentID}})
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+// AddCommentToPost adds a comment to a post
+func (db *MongoDB) AddCommentToPost(postID, commentID primitive.ObjectID) error {
+	collection, exists := db.GetCollection("posts") // Get the collection and existence flag
+	if !exists {
+		return errors.New("collection 'posts' does not exist")
 	}
 
 	_, err := collection.UpdateOne(
@@ -397,14 +955,18 @@ func (db *MongoDB) DeletePost(postID primitive.ObjectID) error {
 	return err
 }
 
-// GetCommentsByPostID retrieves comments for a post by its ID
+// GetCommentsByPostID retrieves the top-level comments for a post by its ID
 func (db *MongoDB) GetCommentsByPostID(postID primitive.ObjectID) ([]Comment, error) {
 	collection, exists := db.GetCollection("comments") // Get the collection and existence flag
 	if !exists {
 		return nil, errors.New("collection 'comments' does not exist")
 	}
 
-	cursor, err := collection.Find(context.Background(), bson.M{"post": postID})
+	// Replies are fetched separately through GetCommentReplies
+	filter := bson.M{"post": postID, "parentId": bson.M{"$exists": false}}
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}})
+
+	cursor, err := collection.Find(context.Background(), filter, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -425,6 +987,111 @@ func (db *MongoDB) GetCommentsByPostID(postID primitive.ObjectID) ([]Comment, er
 	return comments, nil
 }
 
+// GetCommentByID retrieves a comment by its ID
+func (db *MongoDB) GetCommentByID(commentID primitive.ObjectID) (*Comment, error) {
+	collection, exists := db.GetCollection("comments")
+	if !exists {
+		return nil, errors.New("collection 'comments' does not exist")
+	}
+
+	var comment Comment
+	err := collection.FindOne(context.Background(), bson.M{"_id": commentID}).Decode(&comment)
+	if err != nil {
+		return nil, err
+	}
+	return &comment, nil
+}
+
+// GetCommentReplies retrieves a page of replies to a top-level comment, oldest first
+func (db *MongoDB) GetCommentReplies(parentID primitive.ObjectID, skip, limit int64) ([]Comment, error) {
+	collection, exists := db.GetCollection("comments")
+	if !exists {
+		return nil, errors.New("collection 'comments' does not exist")
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: 1}}).
+		SetSkip(skip).
+		SetLimit(limit)
+
+	cursor, err := collection.Find(context.Background(), bson.M{"parentId": parentID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var replies []Comment
+	if err := cursor.All(context.Background(), &replies); err != nil {
+		return nil, err
+	}
+	return replies, nil
+}
+
+// UpdateComment updates a comment with the provided data
+func (db *MongoDB) UpdateComment(id primitive.ObjectID, update interface{}) error {
+	collection, exists := db.GetCollection("comments")
+	if !exists {
+		return errors.New("collection 'comments' does not exist")
+	}
+
+	_, err := collection.UpdateOne(context.Background(), bson.M{"_id": id}, update)
+	return err
+}
+
+// AddLikeToComment adds a user ID to the likes array of the specified comment
+func (db *MongoDB) AddLikeToComment(commentID, userID primitive.ObjectID) error {
+	return db.UpdateComment(commentID, bson.M{"$addToSet": bson.M{"likes": userID}})
+}
+
+// RemoveLikeFromComment removes a user ID from the likes array of the specified comment
+func (db *MongoDB) RemoveLikeFromComment(commentID, userID primitive.ObjectID) error {
+	return db.UpdateComment(commentID, bson.M{"$pull": bson.M{"likes": userID}})
+}
+
+// DeleteCommentThread deletes a comment together with its replies and
+// returns every removed comment
+func (db *MongoDB) DeleteCommentThread(commentID primitive.ObjectID) ([]Comment, error) {
+	collection, exists := db.GetCollection("comments")
+	if !exists {
+		return nil, errors.New("collection 'comments' does not exist")
+	}
+
+	filter := bson.M{"$or": []bson.M{{"_id": commentID}, {"parentId": commentID}}}
+	cursor, err := collection.Find(context.Background(), filter)
+	if err != nil {
+		return nil, err
+	}
+	var removed []Comment
+	if err := cursor.All(context.Background(), &removed); err != nil {
+		return nil, err
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(removed))
+	for _, comment := range removed {
+		ids = append(ids, comment.ID)
+	}
+
+	if _, err := collection.DeleteMany(context.Background(), bson.M{"_id": bson.M{"$in": ids}}); err != nil {
+		return nil, err
+	}
+	return removed, nil
+}
+
+// RemoveCommentsFromPost removes comment IDs from a post's comments array
+func (db *MongoDB) RemoveCommentsFromPost(postID primitive.ObjectID, commentIDs []primitive.ObjectID) error {
+	collection, exists := db.GetCollection("posts")
+	if !exists {
+		return errors.New("collection 'posts' does not exist")
+	}
+
+	_, err := collection.UpdateOne(
+		context.Background(),
+		bson.M{"_id": postID},
+		bson.M{"$pullAll": bson.M{"comments": commentIDs}},
+	)
+	return err
+}
+
 // GetMessagesByIDs retrieves messages by their IDs
 func (db *MongoDB) GetMessagesByIDs(ids []primitive.ObjectID) ([]Message, error) {
 	collection, exists := db.GetCollection("messages") // Get the collection and existence flag
@@ -454,6 +1121,51 @@ func (db *MongoDB) GetMessagesByIDs(ids []primitive.ObjectID) ([]Message, error)
 	return messages, nil
 }
 
+// SearchMessages runs a full-text search over the messages of every
+// conversation the user takes part in, best matches first. It relies on the
+// message_text index; the SQL backends search with their own full-text index.
+func (db *MongoDB) SearchMessages(userID primitive.ObjectID, query string, skip, limit int64) ([]Message, error) {
+	conversations, exists := db.GetCollection("conversations")
+	if !exists {
+		return nil, errors.New("collection 'conversations' does not exist")
+	}
+	collection, exists := db.GetCollection("messages")
+	if !exists {
+		return nil, errors.New("collection 'messages' does not exist")
+	}
+
+	conversationIDs, err := conversations.Distinct(context.Background(), "_id", bson.M{"participants": userID})
+	if err != nil {
+		return nil, err
+	}
+	if len(conversationIDs) == 0 {
+		return nil, nil
+	}
+
+	filter := bson.M{
+		"$text":          bson.M{"$search": query},
+		"conversationId": bson.M{"$in": conversationIDs},
+		"unsent":         bson.M{"$ne": true},
+	}
+	opts := options.Find().
+		SetProjection(bson.M{"score": bson.M{"$meta": "textScore"}}).
+		SetSort(bson.D{{Key: "score", Value: bson.M{"$meta": "textScore"}}, {Key: "createdAt", Value: -1}}).
+		SetSkip(skip).
+		SetLimit(limit)
+
+	cursor, err := collection.Find(context.Background(), filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var messages []Message
+	if err := cursor.All(context.Background(), &messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
 // GetConversation retrieves a conversation by participants' IDs
 // func (db *MongoDB) GetConversation(senderID, receiverID primitive.ObjectID) (*Conversation, error) {
 // 	filter := bson.M{
@@ -620,18 +1332,22 @@ func (db *MongoDB) GetMessagesByIDs(ids []primitive.ObjectID) ([]Message, error)
 // 	return err
 // }
 
-// AddLikeToPost adds a user ID to the likes array of the specified post
-func (db *MongoDB) AddLikeToPost(postID, userID primitive.ObjectID) error {
+// AddLikeToPost adds a user ID to the likes array of the specified post and
+// reports whether it was added, which it isn't if the user already liked it
+func (db *MongoDB) AddLikeToPost(postID, userID primitive.ObjectID) (bool, error) {
 	collection, exists := db.GetCollection("posts") // Get the collection and existence flag
 	if !exists {
-		return errors.New("collection 'posts' does not exist")
+		return false, errors.New("collection 'posts' does not exist")
 	}
-	_, err := collection.UpdateOne(
+	result, err := collection.UpdateOne(
 		context.Background(),
 		bson.M{"_id": postID},
 		bson.M{"$addToSet": bson.M{"likes": userID}}, // $addToSet ensures the userID is only added once
 	)
-	return err
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
 }
 
 // AddCommentToPost adds a comment to a post
@@ -685,6 +1401,7 @@ func (db *MongoDB) AddLikeToPost(postID, userID primitive.ObjectID) error {
 func (db *MongoDB) CreatePost(post Post) (*Post, error) {
 	// Set the created time for the post
 	post.CreatedAt = time.Now()
+	post.UpdatedAt = post.CreatedAt
 
 	// Get the collection
 	collection, exists := db.GetCollection("posts") // Get the collection and existence flag
@@ -713,10 +1430,11 @@ func (db *MongoDB) AddPostToUser(userID primitive.ObjectID, postID primitive.Obj
 	// Define the filter to find the user by ID
 	filter := bson.M{"_id": userID}
 
-	// Define the update to append the post ID to the user's posts array
+	// Define the update to add the post ID to the user's posts array. Publishing
+	// is retried after a failure, so the post may already be there.
 	update := bson.M{
-		"$push": bson.M{"posts": postID},
-		"$set":  bson.M{"updatedAt": time.Now()}, // Update the 'updatedAt' field
+		"$addToSet": bson.M{"posts": postID},
+		"$set":      bson.M{"updatedAt": time.Now()}, // Update the 'updatedAt' field
 	}
 
 	// Perform the update operation
@@ -731,8 +1449,7 @@ func (db *MongoDB) GetAllPosts() ([]Post, error) {
 		return nil, errors.New("collection 'posts' does not exist")
 	}
 
-	// Create an empty filter to match all documents
-	filter := bson.M{} // Corrected to use bson.M for an empty filter
+	filter := visiblePostFilter(bson.M{})
 
 	cursor, err := collection.Find(context.Background(), filter)
 	if err != nil {
@@ -763,7 +1480,7 @@ func (db *MongoDB) GetPostsByUserID(authorID primitive.ObjectID) ([]Post, error)
 		return nil, errors.New("collection 'posts' does not exist")
 	}
 
-	filter := bson.M{"author": authorID}
+	filter := visiblePostFilter(bson.M{"author": authorID})
 	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}})
 
 	cursor, err := collection.Find(context.Background(), filter, opts)
@@ -787,3 +1504,929 @@ func (db *MongoDB) GetPostsByUserID(authorID primitive.ObjectID) ([]Post, error)
 
 	return posts, nil
 }
+
+// visiblePostFilter restricts a post filter to posts that show up on profiles and
+// feeds: published, not archived and not deleted. Posts without a status predate
+// drafts and count as published.
+func visiblePostFilter(filter bson.M) bson.M {
+	filter["status"] = bson.M{"$in": []interface{}{nil, PostStatusPublished}}
+	filter["archived"] = bson.M{"$ne": true}
+	filter["deletedAt"] = bson.M{"$exists": false}
+	return filter
+}
+
+// GetDraftsByUserID retrieves the author's drafts and scheduled posts, most recently updated first
+func (db *MongoDB) GetDraftsByUserID(authorID primitive.ObjectID) ([]Post, error) {
+	collection, exists := db.GetCollection("posts")
+	if !exists {
+		return nil, errors.New("collection 'posts' does not exist")
+	}
+
+	filter := bson.M{
+		"author": authorID,
+		"status": bson.M{"$in": []string{PostStatusDraft, PostStatusScheduled}},
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "updatedAt", Value: -1}})
+
+	cursor, err := collection.Find(context.Background(), filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var posts []Post
+	if err := cursor.All(context.Background(), &posts); err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
+
+// PublishPost atomically claims a draft or scheduled post for publishing for
+// the length of the lease. It returns nil without an error if the post was not
+// waiting to be published, so callers racing on the same post publish it only once.
+func (db *MongoDB) PublishPost(postID primitive.ObjectID, lease time.Duration) (*Post, error) {
+	return db.claimPostForPublishing(bson.M{
+		"_id":    postID,
+		"status": bson.M{"$in": []string{PostStatusDraft, PostStatusScheduled}},
+	}, time.Now(), lease)
+}
+
+// ClaimDueScheduledPost atomically claims one scheduled post whose time has come,
+// or one whose publishing lease ran out before it was published, for the length
+// of the lease. Each claim gets a new lease token, so an instance whose lease
+// ran out can no longer mark the post published. It returns nil without an error when no post is due. Because the
+// claim is a single findAndModify, each post is handed to exactly one caller
+// across server instances.
+func (db *MongoDB) ClaimDueScheduledPost(now time.Time, lease time.Duration) (*Post, error) {
+	return db.claimPostForPublishing(bson.M{
+		"$or": []bson.M{
+			{"status": PostStatusScheduled, "scheduledAt": bson.M{"$lte": now}},
+			{"status": PostStatusPublishing, "publishLeaseEnds": bson.M{"$lte": now}},
+		},
+	}, now, lease)
+}
+
+func (db *MongoDB) claimPostForPublishing(filter bson.M, now time.Time, lease time.Duration) (*Post, error) {
+	collection, exists := db.GetCollection("posts")
+	if !exists {
+		return nil, errors.New("collection 'posts' does not exist")
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"status":           PostStatusPublishing,
+			"publishLeaseEnds": now.Add(lease),
+			"publishLease":     primitive.NewObjectID(),
+			"updatedAt":        now,
+		},
+	}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "scheduledAt", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var post Post
+	err := collection.FindOneAndUpdate(context.Background(), filter, update, opts).Decode(&post)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &post, nil
+}
+
+// MarkPostPublished makes a post that was claimed for publishing live, as long
+// as the claim holding the lease token is still the current one. It reports
+// whether it did; false means the lease ran out and another claim took over.
+func (db *MongoDB) MarkPostPublished(postID, lease primitive.ObjectID, publishedAt time.Time) (bool, error) {
+	collection, exists := db.GetCollection("posts")
+	if !exists {
+		return false, errors.New("collection 'posts' does not exist")
+	}
+
+	filter := bson.M{"_id": postID, "status": PostStatusPublishing, "publishLease": lease}
+	update := bson.M{
+		"$set":   bson.M{"status": PostStatusPublished, "publishedAt": publishedAt, "createdAt": publishedAt, "updatedAt": publishedAt},
+		"$unset": bson.M{"scheduledAt": "", "publishLeaseEnds": "", "publishLease": ""},
+	}
+	result, err := collection.UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+// GetArchivedPostsByUserID retrieves the author's archived posts, most recently archived first
+func (db *MongoDB) GetArchivedPostsByUserID(authorID primitive.ObjectID) ([]Post, error) {
+	filter := bson.M{
+		"author":    authorID,
+		"archived":  true,
+		"deletedAt": bson.M{"$exists": false},
+	}
+	return db.findPosts(filter, options.Find().SetSort(bson.D{{Key: "archivedAt", Value: -1}}))
+}
+
+// GetDeletedPostsByUserID retrieves the author's deleted posts that can still be restored
+func (db *MongoDB) GetDeletedPostsByUserID(authorID primitive.ObjectID) ([]Post, error) {
+	filter := bson.M{
+		"author":    authorID,
+		"deletedAt": bson.M{"$gt": time.Now().Add(-DeletedPostRetention)},
+	}
+	return db.findPosts(filter, options.Find().SetSort(bson.D{{Key: "deletedAt", Value: -1}}))
+}
+
+// ClaimPostToPurge atomically claims one soft-deleted post whose deletion is
+// older than cutoff for the length of the lease, marking it as purging. A post
+// whose purge didn't finish is claimed again once its lease runs out. It
+// returns nil without an error when nothing is left to purge, and hands each
+// post to exactly one caller across server instances.
+func (db *MongoDB) ClaimPostToPurge(cutoff, now time.Time, lease time.Duration) (*Post, error) {
+	collection, exists := db.GetCollection("posts")
+	if !exists {
+		return nil, errors.New("collection 'posts' does not exist")
+	}
+
+	filter := bson.M{
+		"deletedAt": bson.M{"$lte": cutoff},
+		"$or": bson.A{
+			bson.M{"status": bson.M{"$ne": PostStatusPurging}},
+			bson.M{"purgeLeaseEnds": bson.M{"$lte": now}},
+		},
+	}
+	update := bson.M{"$set": bson.M{"status": PostStatusPurging, "purgeLeaseEnds": now.Add(lease)}}
+
+	var post Post
+	err := collection.FindOneAndUpdate(context.Background(), filter, update).Decode(&post)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &post, nil
+}
+
+func (db *MongoDB) findPosts(filter bson.M, opts *options.FindOptions) ([]Post, error) {
+	collection, exists := db.GetCollection("posts")
+	if !exists {
+		return nil, errors.New("collection 'posts' does not exist")
+	}
+
+	cursor, err := collection.Find(context.Background(), filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var posts []Post
+	if err := cursor.All(context.Background(), &posts); err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
+
+// notificationGroupAttempts bounds how often RecordNotification retries when
+// concurrent events keep changing the group it's joining
+const notificationGroupAttempts = 5
+
+// errGroupChanged is returned by joinNotificationGroup when the group no longer
+// looks the way the update was worked out for
+var errGroupChanged = errors.New("notification group changed concurrently")
+
+// RecordNotification stores an event in the recipient's inbox. Under an
+// aggregation rule the event joins the open group of the same type and target
+// while it's inside the rule's window, or starts a new one. It returns the
+// resulting notification and whether the event was news to the recipient,
+// which repeats and actors returning after a withdrawal aren't.
+//
+// Each open group is the only document with its openKey, so concurrent events
+// on the same target, even from different server instances, join one group
+// rather than each starting their own.
+func (db *MongoDB) RecordNotification(notification Notification, rule AggregationRule) (*Notification, bool, error) {
+	collection, exists := db.GetCollection("notifications")
+	if !exists {
+		return nil, false, errors.New("collection 'notifications' does not exist")
+	}
+
+	now := time.Now()
+	notification.ActorIDs = []primitive.ObjectID{notification.ActorID}
+	notification.LatestActors = []primitive.ObjectID{notification.ActorID}
+	notification.ActorCount = 1
+	notification.EventCount = 1
+	notification.Read = false
+	notification.CreatedAt = now
+	notification.UpdatedAt = now
+
+	if rule.Window <= 0 {
+		result, err := collection.InsertOne(context.Background(), notification)
+		if err != nil {
+			return nil, false, err
+		}
+		notification.ID = result.InsertedID.(primitive.ObjectID)
+		return &notification, true, nil
+	}
+
+	notification.OpenKey = notification.RecipientID.Hex() + ":" + notification.Type + ":" + notification.GroupKey
+	for attempt := 0; attempt < notificationGroupAttempts; attempt++ {
+		// A group past its window stops taking events
+		_, err := collection.UpdateMany(context.Background(),
+			bson.M{"openKey": notification.OpenKey, "createdAt": bson.M{"$lt": now.Add(-rule.Window)}},
+			bson.M{"$unset": bson.M{"openKey": ""}},
+		)
+		if err != nil {
+			return nil, false, err
+		}
+
+		// Start a group with the event unless one is open, in which case the
+		// event joins it
+		notification.ID = primitive.NewObjectID()
+		var group Notification
+		err = collection.FindOneAndUpdate(context.Background(),
+			bson.M{"openKey": notification.OpenKey},
+			bson.M{"$setOnInsert": notification},
+			options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.Before),
+		).Decode(&group)
+		switch {
+		case err == mongo.ErrNoDocuments:
+			return &notification, true, nil
+		case mongo.IsDuplicateKeyError(err):
+			// Another event started the group first
+			continue
+		case err != nil:
+			return nil, false, err
+		}
+
+		joined, fresh, err := db.joinNotificationGroup(collection, &group, notification, rule, now)
+		if err == errGroupChanged {
+			continue
+		}
+		return joined, fresh, err
+	}
+	return nil, false, errGroupChanged
+}
+
+// joinNotificationGroup adds an event to an open notification group. The update
+// only applies if the group still looks the way it did when it was read, so an
+// actor is counted once however many of their events arrive at the same time;
+// otherwise errGroupChanged is returned and the caller reads the group again.
+func (db *MongoDB) joinNotificationGroup(collection *mongo.Collection, group *Notification, event Notification, rule AggregationRule, now time.Time) (*Notification, bool, error) {
+	actor := event.ActorID
+	maxActors := rule.MaxActors
+	if maxActors <= 0 {
+		maxActors = 3
+	}
+	latestActors := bson.M{"$each": bson.A{actor}, "$position": 0, "$slice": maxActors}
+
+	// The group points at the latest event and shows up as unread again
+	latest := bson.M{"actorId": actor, "updatedAt": now, "read": false, "message": event.Message, "hidden": event.Hidden}
+	if !event.CommentID.IsZero() {
+		latest["commentId"] = event.CommentID
+	}
+	if !event.MessageID.IsZero() {
+		latest["messageId"] = event.MessageID
+	}
+
+	filter := bson.M{"_id": group.ID}
+	var update bson.M
+	fresh := true
+	switch {
+	case containsObjectID(group.Withdrawn, actor):
+		// An actor coming back after taking their event back, like a like
+		// toggled off and on, is restored without notifying again
+		filter["withdrawn"] = actor
+		update = bson.M{
+			"$pull": bson.M{"withdrawn": actor},
+			"$push": bson.M{"latestActors": latestActors},
+			"$inc":  bson.M{"actorCount": 1},
+		}
+		fresh = false
+	case containsObjectID(group.ActorIDs, actor) && !rule.Repeats:
+		return group, false, nil
+	case containsObjectID(group.ActorIDs, actor):
+		filter["withdrawn"] = bson.M{"$ne": actor}
+		update = bson.M{
+			"$set":   latest,
+			"$unset": bson.M{"readAt": ""},
+			"$inc":   bson.M{"eventCount": 1},
+		}
+	default:
+		filter["actorIds"] = bson.M{"$ne": actor}
+		update = bson.M{
+			"$set":      latest,
+			"$unset":    bson.M{"readAt": ""},
+			"$addToSet": bson.M{"actorIds": actor},
+			"$push":     bson.M{"latestActors": latestActors},
+			"$inc":      bson.M{"actorCount": 1, "eventCount": 1},
+		}
+	}
+
+	var updated Notification
+	err := collection.FindOneAndUpdate(
+		context.Background(),
+		filter,
+		update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	if err == mongo.ErrNoDocuments {
+		return nil, false, errGroupChanged
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return &updated, fresh, nil
+}
+
+// GetNotificationsByUser retrieves a page of the user's notifications, most
+// recently active first
+func (db *MongoDB) GetNotificationsByUser(userID primitive.ObjectID, skip, limit int64) ([]Notification, error) {
+	collection, exists := db.GetCollection("notifications")
+	if !exists {
+		return nil, errors.New("collection 'notifications' does not exist")
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "updatedAt", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(skip).
+		SetLimit(limit)
+
+	// Groups whose every actor withdrew aren't shown
+	filter := bson.M{"recipientId": userID, "actorCount": bson.M{"$gt": 0}, "hidden": bson.M{"$ne": true}}
+	cursor, err := collection.Find(context.Background(), filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var notifications []Notification
+	if err := cursor.All(context.Background(), &notifications); err != nil {
+		return nil, err
+	}
+	return notifications, nil
+}
+
+// CountUnreadNotifications counts the notifications the user hasn't read
+func (db *MongoDB) CountUnreadNotifications(userID primitive.ObjectID) (int64, error) {
+	collection, exists := db.GetCollection("notifications")
+	if !exists {
+		return 0, errors.New("collection 'notifications' does not exist")
+	}
+
+	return collection.CountDocuments(context.Background(), bson.M{"recipientId": userID, "read": false, "actorCount": bson.M{"$gt": 0}, "hidden": bson.M{"$ne": true}})
+}
+
+// MarkNotificationRead marks one of the user's notifications as read
+func (db *MongoDB) MarkNotificationRead(userID, notificationID primitive.ObjectID) error {
+	collection, exists := db.GetCollection("notifications")
+	if !exists {
+		return errors.New("collection 'notifications' does not exist")
+	}
+
+	result, err := collection.UpdateOne(
+		context.Background(),
+		bson.M{"_id": notificationID, "recipientId": userID},
+		bson.M{"$set": bson.M{"read": true, "readAt": time.Now()}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// MarkAllNotificationsRead marks every unread notification of the user as read
+// and returns how many there were
+func (db *MongoDB) MarkAllNotificationsRead(userID primitive.ObjectID) (int64, error) {
+	collection, exists := db.GetCollection("notifications")
+	if !exists {
+		return 0, errors.New("collection 'notifications' does not exist")
+	}
+
+	result, err := collection.UpdateMany(
+		context.Background(),
+		bson.M{"recipientId": userID, "read": false},
+		bson.M{"$set": bson.M{"read": true, "readAt": time.Now()}},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+// WithdrawNotification takes an actor's event back out of the latest group
+// they're part of, e.g. when a like is removed. The actor is remembered so
+// that repeating the event later restores them quietly, and a group left
+// without actors disappears from the inbox.
+func (db *MongoDB) WithdrawNotification(recipientID, actorID primitive.ObjectID, notificationType, groupKey string) error {
+	collection, exists := db.GetCollection("notifications")
+	if !exists {
+		return errors.New("collection 'notifications' does not exist")
+	}
+
+	filter := bson.M{
+		"recipientId": recipientID,
+		"type":        notificationType,
+		"groupKey":    groupKey,
+		"actorIds":    actorID,
+		"withdrawn":   bson.M{"$ne": actorID},
+	}
+	update := bson.M{
+		"$pull":     bson.M{"latestActors": actorID},
+		"$addToSet": bson.M{"withdrawn": actorID},
+		"$inc":      bson.M{"actorCount": -1},
+	}
+	err := collection.FindOneAndUpdate(context.Background(), filter, update, options.FindOneAndUpdate().SetSort(bson.M{"createdAt": -1})).Err()
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	return err
+}
+
+// HoldDelivery holds a notification back until delivery.DeliverAt. Holding a
+// notification that's already held refreshes its state and adds the channels
+// instead of queueing it twice.
+func (db *MongoDB) HoldDelivery(delivery HeldDelivery) error {
+	collection, exists := db.GetCollection("deliveries")
+	if !exists {
+		return errors.New("collection 'deliveries' does not exist")
+	}
+
+	delivery.CreatedAt = time.Now()
+	if delivery.NotificationID.IsZero() {
+		_, err := collection.InsertOne(context.Background(), delivery)
+		return err
+	}
+
+	filter := bson.M{"recipientId": delivery.RecipientID, "notificationId": delivery.NotificationID}
+	update := bson.M{
+		"$set":         bson.M{"notification": delivery.Notification},
+		"$addToSet":    bson.M{"channels": bson.M{"$each": delivery.Channels}},
+		"$setOnInsert": bson.M{"deliverAt": delivery.DeliverAt, "createdAt": delivery.CreatedAt},
+	}
+	_, err := collection.UpdateOne(context.Background(), filter, update, options.Update().SetUpsert(true))
+	return err
+}
+
+// ClaimDueDelivery atomically takes one held delivery whose time has come off
+// the queue. It returns nil without an error when none is due.
+func (db *MongoDB) ClaimDueDelivery(now time.Time) (*HeldDelivery, error) {
+	collection, exists := db.GetCollection("deliveries")
+	if !exists {
+		return nil, errors.New("collection 'deliveries' does not exist")
+	}
+
+	opts := options.FindOneAndDelete().SetSort(bson.D{{Key: "deliverAt", Value: 1}})
+	var delivery HeldDelivery
+	err := collection.FindOneAndDelete(context.Background(), bson.M{"deliverAt": bson.M{"$lte": now}}, opts).Decode(&delivery)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// SavePushSubscription registers a browser for web push. A browser that
+// subscribes again, possibly for another user after switching accounts,
+// replaces its previous subscription.
+func (db *MongoDB) SavePushSubscription(subscription PushSubscription) error {
+	collection, exists := db.GetCollection("pushSubscriptions")
+	if !exists {
+		return errors.New("collection 'pushSubscriptions' does not exist")
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"userId":    subscription.UserID,
+			"p256dh":    subscription.P256dh,
+			"auth":      subscription.Auth,
+			"userAgent": subscription.UserAgent,
+		},
+		"$setOnInsert": bson.M{"createdAt": time.Now()},
+	}
+	_, err := collection.UpdateOne(context.Background(), bson.M{"endpoint": subscription.Endpoint}, update, options.Update().SetUpsert(true))
+	return err
+}
+
+// GetPushSubscriptions retrieves every browser the user registered for web push
+func (db *MongoDB) GetPushSubscriptions(userID primitive.ObjectID) ([]PushSubscription, error) {
+	collection, exists := db.GetCollection("pushSubscriptions")
+	if !exists {
+		return nil, errors.New("collection 'pushSubscriptions' does not exist")
+	}
+
+	cursor, err := collection.Find(context.Background(), bson.M{"userId": userID})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var subscriptions []PushSubscription
+	if err := cursor.All(context.Background(), &subscriptions); err != nil {
+		return nil, err
+	}
+	return subscriptions, nil
+}
+
+// DeletePushSubscription unregisters one of the user's browsers
+func (db *MongoDB) DeletePushSubscription(userID primitive.ObjectID, endpoint string) error {
+	collection, exists := db.GetCollection("pushSubscriptions")
+	if !exists {
+		return errors.New("collection 'pushSubscriptions' does not exist")
+	}
+
+	result, err := collection.DeleteOne(context.Background(), bson.M{"userId": userID, "endpoint": endpoint})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// DeletePushSubscriptionByEndpoint forgets a subscription its push service
+// reported as expired
+func (db *MongoDB) DeletePushSubscriptionByEndpoint(endpoint string) error {
+	collection, exists := db.GetCollection("pushSubscriptions")
+	if !exists {
+		return errors.New("collection 'pushSubscriptions' does not exist")
+	}
+
+	_, err := collection.DeleteOne(context.Background(), bson.M{"endpoint": endpoint})
+	return err
+}
+
+// GetUnreadNotificationsSince retrieves the user's unread notifications with
+// activity since the given time, most recently active first
+func (db *MongoDB) GetUnreadNotificationsSince(userID primitive.ObjectID, since time.Time, limit int64) ([]Notification, error) {
+	collection, exists := db.GetCollection("notifications")
+	if !exists {
+		return nil, errors.New("collection 'notifications' does not exist")
+	}
+
+	filter := bson.M{
+		"recipientId": userID,
+		"read":        false,
+		"actorCount":  bson.M{"$gt": 0},
+		"updatedAt":   bson.M{"$gte": since},
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "updatedAt", Value: -1}}).SetLimit(limit)
+	cursor, err := collection.Find(context.Background(), filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var notifications []Notification
+	if err := cursor.All(context.Background(), &notifications); err != nil {
+		return nil, err
+	}
+	return notifications, nil
+}
+
+// ClaimDigestRecipient atomically picks one user who is due an email digest:
+// they have an email address, haven't been connected since inactiveSince (or
+// never connected at all), and their last digest is older than their digest
+// frequency, and any retry of a failed digest is due. The user's lastDigestAt
+// is set to now as part of the claim, so across server instances each digest
+// is sent once. It returns nil without an error when nobody is due.
+func (db *MongoDB) ClaimDigestRecipient(now, inactiveSince time.Time) (*User, error) {
+	collection, exists := db.GetCollection("users")
+	if !exists {
+		return nil, errors.New("collection 'users' does not exist")
+	}
+
+	var due bson.A
+	for frequency, interval := range DigestIntervals {
+		filter := bson.M{
+			"$or": bson.A{
+				bson.M{"lastDigestAt": bson.M{"$exists": false}},
+				bson.M{"lastDigestAt": bson.M{"$lte": now.Add(-interval)}},
+			},
+			"notificationPreferences.digestFrequency": frequency,
+		}
+		if frequency == DigestWeekly {
+			filter["notificationPreferences.digestFrequency"] = bson.M{"$in": bson.A{nil, "", DigestWeekly}}
+		}
+		due = append(due, filter)
+	}
+
+	filter := bson.M{
+		"email": bson.M{"$nin": bson.A{nil, ""}},
+		"$and": bson.A{
+			// lastSeen is only recorded when a socket disconnects, so users
+			// who never connected count as inactive
+			bson.M{"$or": bson.A{
+				bson.M{"lastSeen": bson.M{"$exists": false}},
+				bson.M{"lastSeen": bson.M{"$lte": inactiveSince}},
+			}},
+			bson.M{"$or": due},
+			bson.M{"$or": bson.A{
+				bson.M{"digestRetryAt": bson.M{"$exists": false}},
+				bson.M{"digestRetryAt": bson.M{"$lte": now}},
+			}},
+		},
+	}
+	update := bson.M{
+		"$set": bson.M{"lastDigestAt": now},
+		// A failed send puts these back through DeferDigestRecipient
+		"$unset": bson.M{"digestFailures": "", "digestRetryAt": ""},
+	}
+	// The previous digest time is what the digest covers, so return it as it was
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "lastDigestAt", Value: 1}}).
+		SetReturnDocument(options.Before)
+
+	var user User
+	err := collection.FindOneAndUpdate(context.Background(), filter, update, opts).Decode(&user)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// DeferDigestRecipient undoes ClaimDigestRecipient for a digest that couldn't
+// be sent, putting back the lastDigestAt the claim returned so the digest
+// still covers everything since the previous one. The user isn't claimed
+// again before retryAt, so one failing address doesn't hold up everyone else.
+// It leaves the user alone if they were claimed again in the meantime.
+func (db *MongoDB) DeferDigestRecipient(userID primitive.ObjectID, claimedAt, previous time.Time, failures int, retryAt time.Time) error {
+	collection, exists := db.GetCollection("users")
+	if !exists {
+		return errors.New("collection 'users' does not exist")
+	}
+
+	set := bson.M{"lastDigestAt": previous, "digestFailures": failures, "digestRetryAt": retryAt}
+	update := bson.M{"$set": set}
+	if previous.IsZero() {
+		delete(set, "lastDigestAt")
+		update["$unset"] = bson.M{"lastDigestAt": ""}
+	}
+	_, err := collection.UpdateOne(context.Background(), bson.M{"_id": userID, "lastDigestAt": claimedAt}, update)
+	return err
+}
+
+// GetTopPostsByAuthors retrieves the most liked visible posts the authors
+// published since the given time
+func (db *MongoDB) GetTopPostsByAuthors(authorIDs []primitive.ObjectID, since time.Time, limit int64) ([]Post, error) {
+	collection, exists := db.GetCollection("posts")
+	if !exists {
+		return nil, errors.New("collection 'posts' does not exist")
+	}
+	if len(authorIDs) == 0 {
+		return nil, nil
+	}
+
+	match := visiblePostFilter(bson.M{
+		"author":    bson.M{"$in": authorIDs},
+		"createdAt": bson.M{"$gte": since},
+	})
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$addFields", Value: bson.M{"likeCount": bson.M{"$size": bson.M{"$ifNull": bson.A{"$likes", bson.A{}}}}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "likeCount", Value: -1}, {Key: "createdAt", Value: -1}}}},
+		{{Key: "$limit", Value: limit}},
+	}
+	cursor, err := collection.Aggregate(context.Background(), pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var posts []Post
+	if err := cursor.All(context.Background(), &posts); err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
+
+// CreateWebhook registers a webhook endpoint
+func (db *MongoDB) CreateWebhook(webhook Webhook) (*Webhook, error) {
+	collection, exists := db.GetCollection("webhooks")
+	if !exists {
+		return nil, errors.New("collection 'webhooks' does not exist")
+	}
+
+	webhook.CreatedAt = time.Now()
+	webhook.UpdatedAt = webhook.CreatedAt
+	result, err := collection.InsertOne(context.Background(), webhook)
+	if err != nil {
+		return nil, err
+	}
+	webhook.ID = result.InsertedID.(primitive.ObjectID)
+	return &webhook, nil
+}
+
+// GetWebhookByID retrieves a single webhook by ID
+func (db *MongoDB) GetWebhookByID(id primitive.ObjectID) (*Webhook, error) {
+	collection, exists := db.GetCollection("webhooks")
+	if !exists {
+		return nil, errors.New("collection 'webhooks' does not exist")
+	}
+
+	var webhook Webhook
+	if err := collection.FindOne(context.Background(), bson.M{"_id": id}).Decode(&webhook); err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+// GetWebhooksByOwner retrieves the webhooks a user registered, newest first
+func (db *MongoDB) GetWebhooksByOwner(ownerID primitive.ObjectID) ([]Webhook, error) {
+	collection, exists := db.GetCollection("webhooks")
+	if !exists {
+		return nil, errors.New("collection 'webhooks' does not exist")
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+	cursor, err := collection.Find(context.Background(), bson.M{"ownerId": ownerID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var webhooks []Webhook
+	if err := cursor.All(context.Background(), &webhooks); err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+// GetWebhooksForEvent retrieves the active webhooks that receive an event the
+// given users are involved in: theirs and those registered for all users
+func (db *MongoDB) GetWebhooksForEvent(event string, userIDs []primitive.ObjectID) ([]Webhook, error) {
+	collection, exists := db.GetCollection("webhooks")
+	if !exists {
+		return nil, errors.New("collection 'webhooks' does not exist")
+	}
+
+	filter := bson.M{
+		"active": true,
+		"events": bson.M{"$in": bson.A{event, EventAll}},
+		"$or": bson.A{
+			bson.M{"allUsers": true},
+			bson.M{"ownerId": bson.M{"$in": userIDs}},
+		},
+	}
+	cursor, err := collection.Find(context.Background(), filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var webhooks []Webhook
+	if err := cursor.All(context.Background(), &webhooks); err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+// UpdateWebhook applies an update to a webhook
+func (db *MongoDB) UpdateWebhook(id primitive.ObjectID, update interface{}) error {
+	collection, exists := db.GetCollection("webhooks")
+	if !exists {
+		return errors.New("collection 'webhooks' does not exist")
+	}
+
+	_, err := collection.UpdateOne(context.Background(), bson.M{"_id": id}, update)
+	return err
+}
+
+// DeleteWebhook removes a webhook along with its delivery log
+func (db *MongoDB) DeleteWebhook(id primitive.ObjectID) error {
+	collection, exists := db.GetCollection("webhooks")
+	if !exists {
+		return errors.New("collection 'webhooks' does not exist")
+	}
+	deliveries, exists := db.GetCollection("webhookDeliveries")
+	if !exists {
+		return errors.New("collection 'webhookDeliveries' does not exist")
+	}
+
+	if _, err := collection.DeleteOne(context.Background(), bson.M{"_id": id}); err != nil {
+		return err
+	}
+	_, err := deliveries.DeleteMany(context.Background(), bson.M{"webhookId": id})
+	return err
+}
+
+// CreateWebhookDeliveries queues deliveries for their first attempt
+func (db *MongoDB) CreateWebhookDeliveries(deliveries []WebhookDelivery) error {
+	collection, exists := db.GetCollection("webhookDeliveries")
+	if !exists {
+		return errors.New("collection 'webhookDeliveries' does not exist")
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+
+	documents := make([]interface{}, len(deliveries))
+	for i, delivery := range deliveries {
+		documents[i] = delivery
+	}
+	_, err := collection.InsertMany(context.Background(), documents)
+	return err
+}
+
+// ClaimDueWebhookDelivery atomically takes one pending delivery whose next
+// attempt is due and counts the attempt. The delivery isn't due again until
+// the lease runs out, so if the instance attempting it dies, another one
+// retries it then. Deliveries to skipWebhooks are left for later. It returns
+// nil without an error when none is due.
+func (db *MongoDB) ClaimDueWebhookDelivery(now time.Time, lease time.Duration, skipWebhooks []primitive.ObjectID) (*WebhookDelivery, error) {
+	collection, exists := db.GetCollection("webhookDeliveries")
+	if !exists {
+		return nil, errors.New("collection 'webhookDeliveries' does not exist")
+	}
+
+	filter := bson.M{"status": DeliveryPending, "nextAttemptAt": bson.M{"$lte": now}}
+	if len(skipWebhooks) > 0 {
+		filter["webhookId"] = bson.M{"$nin": skipWebhooks}
+	}
+	update := bson.M{
+		"$set": bson.M{"nextAttemptAt": now.Add(lease), "lastAttemptAt": now},
+		"$inc": bson.M{"attempts": 1},
+	}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "nextAttemptAt", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var delivery WebhookDelivery
+	err := collection.FindOneAndUpdate(context.Background(), filter, update, opts).Decode(&delivery)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// RecordDeliveryAttempt stores the outcome of an attempt at a delivery
+func (db *MongoDB) RecordDeliveryAttempt(id primitive.ObjectID, attempt DeliveryAttempt) error {
+	collection, exists := db.GetCollection("webhookDeliveries")
+	if !exists {
+		return errors.New("collection 'webhookDeliveries' does not exist")
+	}
+
+	set := bson.M{
+		"status":         attempt.Status,
+		"responseStatus": attempt.ResponseStatus,
+		"responseBody":   attempt.ResponseBody,
+		"error":          attempt.Error,
+		"durationMs":     attempt.Duration.Milliseconds(),
+	}
+	update := bson.M{"$set": set}
+	if attempt.Status == DeliveryPending {
+		set["nextAttemptAt"] = attempt.NextAttemptAt
+	} else {
+		update["$unset"] = bson.M{"nextAttemptAt": ""}
+	}
+
+	_, err := collection.UpdateOne(context.Background(), bson.M{"_id": id}, update)
+	return err
+}
+
+// GetWebhookDeliveries retrieves a page of a webhook's delivery log, newest first
+func (db *MongoDB) GetWebhookDeliveries(webhookID primitive.ObjectID, skip, limit int64) ([]WebhookDelivery, error) {
+	collection, exists := db.GetCollection("webhookDeliveries")
+	if !exists {
+		return nil, errors.New("collection 'webhookDeliveries' does not exist")
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(skip).
+		SetLimit(limit)
+	cursor, err := collection.Find(context.Background(), bson.M{"webhookId": webhookID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var deliveries []WebhookDelivery
+	if err := cursor.All(context.Background(), &deliveries); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// GetWebhookDelivery retrieves a single delivery by ID
+func (db *MongoDB) GetWebhookDelivery(id primitive.ObjectID) (*WebhookDelivery, error) {
+	collection, exists := db.GetCollection("webhookDeliveries")
+	if !exists {
+		return nil, errors.New("collection 'webhookDeliveries' does not exist")
+	}
+
+	var delivery WebhookDelivery
+	if err := collection.FindOne(context.Background(), bson.M{"_id": id}).Decode(&delivery); err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
@@ -0,0 +1,91 @@
+package db
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Notification types
+const (
+	NotificationLike          = "like"
+	NotificationComment       = "comment"
+	NotificationReply         = "reply"
+	NotificationFollow        = "follow"
+	NotificationFollowRequest = "followRequest"
+	NotificationFollowAccept  = "followAccept"
+	NotificationMention       = "mention"
+	NotificationMessage       = "message"
+)
+
+// Notification is an entry in a user's notification inbox. ActorID is the
+// user who triggered it most recently; it's serialized as userId, the name
+// realtime notifications have always used for it.
+//
+// Events of the same type on the same target (GroupKey) are aggregated into
+// one notification: ActorCount counts the distinct users behind them and
+// LatestActors keeps the most recent few for display. OpenKey is set while the
+// group is inside its aggregation window and still takes new events.
+//
+// Hidden notifications were recorded while the recipient had the inbox turned
+// off for their type. They aren't listed or counted in the inbox and only
+// serve to recognize events that aren't news, though digests still include them.
+type Notification struct {
+	ID             primitive.ObjectID   `bson:"_id,omitempty" json:"id,omitempty"`
+	RecipientID    primitive.ObjectID   `bson:"recipientId" json:"recipientId"`
+	Type           string               `bson:"type" json:"type"`
+	GroupKey       string               `bson:"groupKey,omitempty" json:"-"`
+	OpenKey        string               `bson:"openKey,omitempty" json:"-"`
+	Hidden         bool                 `bson:"hidden,omitempty" json:"-"`
+	ActorID        primitive.ObjectID   `bson:"actorId,omitempty" json:"userId,omitempty"`
+	LatestActors   []primitive.ObjectID `bson:"latestActors,omitempty" json:"latestActors,omitempty"`
+	ActorIDs       []primitive.ObjectID `bson:"actorIds,omitempty" json:"-"`
+	Withdrawn      []primitive.ObjectID `bson:"withdrawn,omitempty" json:"-"`
+	ActorCount     int                  `bson:"actorCount" json:"actorCount"`
+	EventCount     int                  `bson:"eventCount" json:"eventCount"`
+	PostID         primitive.ObjectID   `bson:"postId,omitempty" json:"postId,omitempty"`
+	CommentID      primitive.ObjectID   `bson:"commentId,omitempty" json:"commentId,omitempty"`
+	ConversationID primitive.ObjectID   `bson:"conversationId,omitempty" json:"conversationId,omitempty"`
+	MessageID      primitive.ObjectID   `bson:"messageId,omitempty" json:"messageId,omitempty"`
+	Message        string               `bson:"message" json:"message"`
+	Read           bool                 `bson:"read" json:"read"`
+	ReadAt         time.Time            `bson:"readAt,omitempty" json:"readAt,omitempty"`
+	CreatedAt      time.Time            `bson:"createdAt,omitempty" json:"createdAt,omitempty"`
+	UpdatedAt      time.Time            `bson:"updatedAt,omitempty" json:"updatedAt,omitempty"`
+}
+
+// AggregationRule controls how events of one notification type are grouped
+type AggregationRule struct {
+	// Window is how long after a group starts new events still join it.
+	// Zero disables aggregation, so every event gets its own notification.
+	Window time.Duration
+	// MaxActors is how many of the latest actors a group keeps for display
+	MaxActors int
+	// Repeats makes repeated events by the same actor count as new, as with
+	// messages. Otherwise they're treated as duplicates, e.g. a like toggled
+	// off and on again.
+	Repeats bool
+}
+
+// HeldDelivery is a notification held back by its recipient's quiet hours,
+// waiting to go out on the listed channels once they end. Held events of one
+// aggregated notification share a delivery that carries its latest state.
+type HeldDelivery struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty"`
+	RecipientID    primitive.ObjectID `bson:"recipientId"`
+	NotificationID primitive.ObjectID `bson:"notificationId,omitempty"`
+	Notification   Notification       `bson:"notification"`
+	Channels       []string           `bson:"channels"`
+	DeliverAt      time.Time          `bson:"deliverAt"`
+	CreatedAt      time.Time          `bson:"createdAt"`
+}
+
+// containsObjectID reports whether id is in ids
+func containsObjectID(ids []primitive.ObjectID, id primitive.ObjectID) bool {
+	for _, existing := range ids {
+		if existing == id {
+			return true
+		}
+	}
+	return false
+}
@@ -6,15 +6,64 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// Comment audiences a post author can restrict discussion to
+const (
+	CommentAudienceEveryone  = "everyone"
+	CommentAudienceFollowers = "followers" // users who follow the author
+	CommentAudienceFollowing = "following" // users the author follows
+)
+
+// Post lifecycle states. Posts created before drafts existed have no status
+// and are treated as published. A post is publishing while the instance that
+// claimed it links it to its author and fans it out, and purging while the
+// instance that claimed it removes it for good; if that instance dies, the
+// post is claimed again once its lease runs out.
+const (
+	PostStatusPublished  = "published"
+	PostStatusDraft      = "draft"
+	PostStatusScheduled  = "scheduled"
+	PostStatusPublishing = "publishing"
+	PostStatusPurging    = "purging"
+)
+
+// DeletedPostRetention is how long a deleted post can be restored before it is purged
+const DeletedPostRetention = 30 * 24 * time.Hour
+
+// MaxPinnedComments is the number of comments an author can pin on a post
+const MaxPinnedComments = 3
+
 // Post represents the MongoDB schema for a Post.
 
 type Post struct {
-	ID        primitive.ObjectID   `bson:"_id,omitempty" json:"id,omitempty"`
-	Caption   string               `bson:"caption,omitempty" json:"caption,omitempty"`
-	Image     string               `bson:"image" json:"image"`
-	Author    primitive.ObjectID   `bson:"author,omitempty" json:"author,omitempty"`
-	Likes     []primitive.ObjectID `bson:"likes,omitempty" json:"likes,omitempty"`
-	Comments  []primitive.ObjectID `bson:"comments,omitempty" json:"comments,omitempty"`
-	CreatedAt time.Time            `bson:"createdAt,omitempty"`
-	UpdatedAt time.Time            `bson:"updatedAt,omitempty"`
+	ID               primitive.ObjectID   `bson:"_id,omitempty" json:"id,omitempty"`
+	Caption          string               `bson:"caption,omitempty" json:"caption,omitempty"`
+	Image            string               `bson:"image" json:"image"`
+	Author           primitive.ObjectID   `bson:"author,omitempty" json:"author,omitempty"`
+	Likes            []primitive.ObjectID `bson:"likes,omitempty" json:"likes,omitempty"`
+	Comments         []primitive.ObjectID `bson:"comments,omitempty" json:"comments,omitempty"`
+	Mentions         []Mention            `bson:"mentions,omitempty" json:"mentions,omitempty"`
+	CommentsDisabled bool                 `bson:"commentsDisabled,omitempty" json:"commentsDisabled,omitempty"`
+	CommentAudience  string               `bson:"commentAudience,omitempty" json:"commentAudience,omitempty"`
+	PinnedComments   []primitive.ObjectID `bson:"pinnedComments,omitempty" json:"pinnedComments,omitempty"`
+	Status           string               `bson:"status,omitempty" json:"status,omitempty"`
+	ScheduledAt      time.Time            `bson:"scheduledAt,omitempty" json:"scheduledAt,omitempty"`
+	PublishedAt      time.Time            `bson:"publishedAt,omitempty" json:"publishedAt,omitempty"`
+	PublishLeaseEnds time.Time            `bson:"publishLeaseEnds,omitempty" json:"-"`
+	PublishLease     primitive.ObjectID   `bson:"publishLease,omitempty" json:"-"`
+	Archived         bool                 `bson:"archived,omitempty" json:"archived,omitempty"`
+	ArchivedAt       time.Time            `bson:"archivedAt,omitempty" json:"archivedAt,omitempty"`
+	DeletedAt        time.Time            `bson:"deletedAt,omitempty" json:"deletedAt,omitempty"`
+	PurgeLeaseEnds   time.Time            `bson:"purgeLeaseEnds,omitempty" json:"-"`
+	CreatedAt        time.Time            `bson:"createdAt,omitempty"`
+	UpdatedAt        time.Time            `bson:"updatedAt,omitempty"`
+}
+
+// IsPublished reports whether the post is live
+func (p *Post) IsPublished() bool {
+	return p.Status == "" || p.Status == PostStatusPublished
+}
+
+// IsDeleted reports whether the post is waiting in the recovery window to be purged
+func (p *Post) IsDeleted() bool {
+	return !p.DeletedAt.IsZero()
 }
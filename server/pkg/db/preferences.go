@@ -0,0 +1,136 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Channels a notification can be delivered on
+const (
+	ChannelInApp    = "inApp"    // the notification inbox
+	ChannelRealtime = "realtime" // live events to connected clients
+	ChannelEmail    = "email"    // the periodic email digest
+	ChannelPush     = "push"     // web push to subscribed browsers
+)
+
+// NotificationChannels lists every delivery channel
+var NotificationChannels = []string{ChannelInApp, ChannelRealtime, ChannelEmail, ChannelPush}
+
+// NotificationTypes lists every notification type
+var NotificationTypes = []string{
+	NotificationLike,
+	NotificationComment,
+	NotificationReply,
+	NotificationFollow,
+	NotificationFollowRequest,
+	NotificationFollowAccept,
+	NotificationMention,
+	NotificationMessage,
+}
+
+// How often a user who hasn't been around gets an email digest
+const (
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly" // the default
+	DigestOff    = "off"
+)
+
+// DigestIntervals is the time between two digests of each frequency
+var DigestIntervals = map[string]time.Duration{
+	DigestDaily:  24 * time.Hour,
+	DigestWeekly: 7 * 24 * time.Hour,
+}
+
+// NotificationPreferences are a user's choices about what they're notified of
+// and how. Channels holds per type overrides; every channel of every type is
+// on unless turned off there.
+type NotificationPreferences struct {
+	Channels           map[string]map[string]bool `bson:"channels,omitempty" json:"channels"`
+	MutedPosts         []primitive.ObjectID       `bson:"mutedPosts,omitempty" json:"mutedPosts"`
+	MutedConversations []primitive.ObjectID       `bson:"mutedConversations,omitempty" json:"mutedConversations"`
+	QuietHours         *QuietHours                `bson:"quietHours,omitempty" json:"quietHours"`
+	DigestFrequency    string                     `bson:"digestFrequency,omitempty" json:"digestFrequency"`
+}
+
+// Digest returns how often the user gets an email digest
+func (p *NotificationPreferences) Digest() string {
+	if p.DigestFrequency == "" {
+		return DigestWeekly
+	}
+	return p.DigestFrequency
+}
+
+// Allows reports whether notifications of a type may be delivered on a channel
+func (p *NotificationPreferences) Allows(notificationType, channel string) bool {
+	enabled, ok := p.Channels[notificationType][channel]
+	return !ok || enabled
+}
+
+// Mutes reports whether the notification is about a post or conversation the
+// user muted
+func (p *NotificationPreferences) Mutes(notification Notification) bool {
+	if !notification.PostID.IsZero() && containsObjectID(p.MutedPosts, notification.PostID) {
+		return true
+	}
+	return !notification.ConversationID.IsZero() && containsObjectID(p.MutedConversations, notification.ConversationID)
+}
+
+// QuietHours is a daily period, in the user's time zone, during which
+// non-urgent notifications are held back. Start and End are "15:04" clock
+// times; a period whose end is before its start runs past midnight.
+type QuietHours struct {
+	Start    string `bson:"start" json:"start"`
+	End      string `bson:"end" json:"end"`
+	TimeZone string `bson:"timeZone" json:"timeZone"`
+}
+
+// Validate checks that the clock times and time zone can be understood
+func (q *QuietHours) Validate() error {
+	if _, err := time.Parse("15:04", q.Start); err != nil {
+		return fmt.Errorf("invalid start time %q", q.Start)
+	}
+	if _, err := time.Parse("15:04", q.End); err != nil {
+		return fmt.Errorf("invalid end time %q", q.End)
+	}
+	if _, err := time.LoadLocation(q.TimeZone); err != nil {
+		return fmt.Errorf("invalid time zone %q", q.TimeZone)
+	}
+	return nil
+}
+
+// EndsAt returns when the quiet hours in effect at t end, or the zero time
+// when t isn't within quiet hours
+func (q *QuietHours) EndsAt(t time.Time) time.Time {
+	if q == nil || q.Validate() != nil {
+		return time.Time{}
+	}
+	location, _ := time.LoadLocation(q.TimeZone)
+	start, _ := time.Parse("15:04", q.Start)
+	end, _ := time.Parse("15:04", q.End)
+
+	local := t.In(location)
+	now := local.Hour()*60 + local.Minute()
+	from := start.Hour()*60 + start.Minute()
+	to := end.Hour()*60 + end.Minute()
+
+	var quiet bool
+	switch {
+	case from == to:
+		quiet = false
+	case from < to:
+		quiet = now >= from && now < to
+	default:
+		quiet = now >= from || now < to
+	}
+	if !quiet {
+		return time.Time{}
+	}
+
+	endsAt := time.Date(local.Year(), local.Month(), local.Day(), end.Hour(), end.Minute(), 0, 0, location)
+	if !endsAt.After(local) {
+		endsAt = endsAt.AddDate(0, 0, 1)
+	}
+	return endsAt
+}
@@ -0,0 +1,20 @@
+package db
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// PushSubscription is a browser a user registered for web push. Endpoint is
+// unique to the browser, and P256dh and Auth are its keys for encrypting
+// messages to it.
+type PushSubscription struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	UserID    primitive.ObjectID `bson:"userId" json:"userId"`
+	Endpoint  string             `bson:"endpoint" json:"endpoint"`
+	P256dh    string             `bson:"p256dh" json:"-"`
+	Auth      string             `bson:"auth" json:"-"`
+	UserAgent string             `bson:"userAgent,omitempty" json:"userAgent,omitempty"`
+	CreatedAt time.Time          `bson:"createdAt,omitempty" json:"createdAt,omitempty"`
+}
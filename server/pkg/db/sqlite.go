@@ -2,8 +2,11 @@ package db
 
 import (
 	"errors"
+	"strings"
 	"time"
+	"unicode"
 
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
@@ -11,9 +14,18 @@ import (
 
 // GORMDB implements the Database interface for both SQLite and PostgreSQL
 type GORMDB struct {
-	conn *gorm.DB
+	conn   *gorm.DB
+	dbType string
 }
 
+// The SQL backends store conversations and messages with the same signatures
+// as Database, so message search works the same on every backend
+var _ interface {
+	CreateConversation(participant1, participant2 primitive.ObjectID) (*Conversation, error)
+	CreateMessage(message Message) (*Message, error)
+	SearchMessages(userID primitive.ObjectID, query string, skip, limit int64) ([]Message, error)
+} = (*GORMDB)(nil)
+
 // User represents the user model in the database
 type UserSql struct {
 	ID             uint           `gorm:"primaryKey" json:"id,omitempty"`
@@ -41,6 +53,25 @@ type PostSql struct {
 	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updatedAt,omitempty"`
 }
 
+// ConversationParticipantSql records who takes part in a conversation. IDs
+// are stored as the hex ObjectIDs the rest of the app uses.
+type ConversationParticipantSql struct {
+	ConversationID string    `gorm:"primaryKey;size:24"`
+	UserID         string    `gorm:"primaryKey;size:24;index"`
+	CreatedAt      time.Time `gorm:"autoCreateTime"`
+}
+
+// MessageSql is a direct message, indexed for full-text search by
+// migrateMessages
+type MessageSql struct {
+	ID             string    `gorm:"primaryKey;size:24"`
+	ConversationID string    `gorm:"size:24;not null;index"`
+	SenderID       string    `gorm:"size:24;not null"`
+	Message        string    `gorm:"type:text"`
+	Unsent         bool      `gorm:"not null;default:false"`
+	CreatedAt      time.Time `gorm:"index"`
+}
+
 // NewGORMDB creates a new GORM database connection
 func NewGORMDB(dsn string, dbType string) (*GORMDB, error) {
 	var dialector gorm.Dialector
@@ -65,7 +96,47 @@ func NewGORMDB(dsn string, dbType string) (*GORMDB, error) {
 		return nil, err
 	}
 
-	return &GORMDB{conn: conn}, nil
+	db := &GORMDB{conn: conn, dbType: dbType}
+	if err := db.migrateMessages(); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// migrateMessages creates the conversation and message tables and sets up
+// full-text search over messages: an FTS4 table kept in step by triggers on
+// SQLite, and an expression index on PostgreSQL
+func (db *GORMDB) migrateMessages() error {
+	if err := db.conn.AutoMigrate(&ConversationParticipantSql{}, &MessageSql{}); err != nil {
+		return err
+	}
+
+	statements := []string{
+		`CREATE INDEX IF NOT EXISTS message_search ON message_sqls USING GIN (to_tsvector('english', message))`,
+	}
+	if db.dbType == "sqlite" {
+		statements = []string{
+			`CREATE VIRTUAL TABLE IF NOT EXISTS message_search USING fts4(content="message_sqls", message, tokenize=unicode61)`,
+			`CREATE TRIGGER IF NOT EXISTS message_search_bu BEFORE UPDATE ON message_sqls BEGIN
+				DELETE FROM message_search WHERE docid = old.rowid;
+			END`,
+			`CREATE TRIGGER IF NOT EXISTS message_search_bd BEFORE DELETE ON message_sqls BEGIN
+				DELETE FROM message_search WHERE docid = old.rowid;
+			END`,
+			`CREATE TRIGGER IF NOT EXISTS message_search_au AFTER UPDATE ON message_sqls BEGIN
+				INSERT INTO message_search(docid, message) VALUES (new.rowid, new.message);
+			END`,
+			`CREATE TRIGGER IF NOT EXISTS message_search_ai AFTER INSERT ON message_sqls BEGIN
+				INSERT INTO message_search(docid, message) VALUES (new.rowid, new.message);
+			END`,
+		}
+	}
+	for _, statement := range statements {
+		if err := db.conn.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // GetUsers retrieves all users or applies a filter (simplified for SQL-based systems)
@@ -146,3 +217,102 @@ func (db *GORMDB) FollowUser(followingUserID, targetUserID uint) error {
 func (db *GORMDB) UnfollowUser(followingUserID, targetUserID uint) error {
 	return db.FollowOrUnfollowUser(followingUserID, targetUserID, "unfollow")
 }
+
+// CreateConversation creates a direct conversation between two users
+func (db *GORMDB) CreateConversation(participant1, participant2 primitive.ObjectID) (*Conversation, error) {
+	conversation := Conversation{
+		ID:           primitive.NewObjectID(),
+		Participants: []primitive.ObjectID{participant1, participant2},
+		CreatedAt:    time.Now(),
+	}
+	conversation.UpdatedAt = conversation.CreatedAt
+
+	participants := make([]ConversationParticipantSql, 0, len(conversation.Participants))
+	for _, userID := range conversation.Participants {
+		participants = append(participants, ConversationParticipantSql{
+			ConversationID: conversation.ID.Hex(),
+			UserID:         userID.Hex(),
+		})
+	}
+	if err := db.conn.Create(&participants).Error; err != nil {
+		return nil, err
+	}
+	return &conversation, nil
+}
+
+// CreateMessage stores a message, which also adds it to the search index
+func (db *GORMDB) CreateMessage(message Message) (*Message, error) {
+	message.ID = primitive.NewObjectID()
+	message.CreatedAt = time.Now()
+
+	row := MessageSql{
+		ID:             message.ID.Hex(),
+		ConversationID: message.ConversationID.Hex(),
+		SenderID:       message.SenderID.Hex(),
+		Message:        message.Message,
+		Unsent:         message.Unsent,
+		CreatedAt:      message.CreatedAt,
+	}
+	if err := db.conn.Create(&row).Error; err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+// SearchMessages runs a full-text search over the messages of every
+// conversation the user takes part in. Like the MongoDB text search, a
+// message matches if it contains any of the words, and words match as
+// prefixes. PostgreSQL ranks the best matches first; SQLite's FTS4 has no
+// ranking, so it returns the newest matches first.
+func (db *GORMDB) SearchMessages(userID primitive.ObjectID, query string, skip, limit int64) ([]Message, error) {
+	words := strings.FieldsFunc(query, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) == 0 {
+		return nil, nil
+	}
+
+	search := db.conn.Table("message_sqls AS m").
+		Select("m.*").
+		Joins("JOIN conversation_participant_sqls AS p ON p.conversation_id = m.conversation_id AND p.user_id = ?", userID.Hex()).
+		Where("m.unsent = ?", false)
+
+	if db.dbType == "sqlite" {
+		terms := make([]string, len(words))
+		for i, word := range words {
+			terms[i] = word + "*"
+		}
+		search = search.
+			Joins("JOIN message_search AS s ON s.docid = m.rowid").
+			Where("message_search MATCH ?", strings.Join(terms, " OR ")).
+			Order("m.created_at DESC, m.rowid DESC")
+	} else {
+		terms := make([]string, len(words))
+		for i, word := range words {
+			terms[i] = word + ":*"
+		}
+		tsquery := strings.Join(terms, " | ")
+		search = search.
+			Where("to_tsvector('english', m.message) @@ to_tsquery('english', ?)", tsquery).
+			Order(gorm.Expr("ts_rank(to_tsvector('english', m.message), to_tsquery('english', ?)) DESC, m.created_at DESC", tsquery))
+	}
+
+	var rows []MessageSql
+	if err := search.Offset(int(skip)).Limit(int(limit)).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	messages := make([]Message, 0, len(rows))
+	for _, row := range rows {
+		message := Message{
+			Message:   row.Message,
+			Unsent:    row.Unsent,
+			CreatedAt: row.CreatedAt,
+		}
+		message.ID, _ = primitive.ObjectIDFromHex(row.ID)
+		message.ConversationID, _ = primitive.ObjectIDFromHex(row.ConversationID)
+		message.SenderID, _ = primitive.ObjectIDFromHex(row.SenderID)
+		messages = append(messages, message)
+	}
+	return messages, nil
+}
@@ -0,0 +1,78 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestGORMSearchMessages(t *testing.T) {
+	conn, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "search.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	database := &GORMDB{conn: conn, dbType: "sqlite"}
+	if err := database.migrateMessages(); err != nil {
+		t.Fatal(err)
+	}
+
+	alice, bob, carol := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	withBob, err := database.CreateConversation(alice, bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	withoutAlice, err := database.CreateConversation(bob, carol)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	send := func(conversation *Conversation, sender primitive.ObjectID, text string, unsent bool) primitive.ObjectID {
+		t.Helper()
+		message, err := database.CreateMessage(Message{ConversationID: conversation.ID, SenderID: sender, Message: text, Unsent: unsent})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return message.ID
+	}
+	running := send(withBob, alice, "Running late, see you at the station", false)
+	dinner := send(withBob, bob, "Dinner at eight?", false)
+	send(withBob, bob, "running out of ideas", true)
+	send(withoutAlice, carol, "Running the usual route", false)
+
+	tests := []struct {
+		query string
+		want  []primitive.ObjectID
+	}{
+		// Only alice's conversations are searched, and unsent messages are left out
+		{"running", []primitive.ObjectID{running}},
+		// Words match as prefixes
+		{"run", []primitive.ObjectID{running}},
+		// Any word matches, newest first
+		{"station dinner", []primitive.ObjectID{dinner, running}},
+		{"breakfast", nil},
+		{"?!", nil},
+	}
+	for _, tt := range tests {
+		messages, err := database.SearchMessages(alice, tt.query, 0, 20)
+		if err != nil {
+			t.Fatalf("searching %q: %v", tt.query, err)
+		}
+		var got []primitive.ObjectID
+		for _, message := range messages {
+			got = append(got, message.ID)
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("searching %q found %v, want %v", tt.query, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("searching %q found %v, want %v", tt.query, got, tt.want)
+				break
+			}
+		}
+	}
+}
@@ -19,8 +19,47 @@ type User struct {
 	Following      []primitive.ObjectID `bson:"following,omitempty" json:"following,omitempty"`
 	Posts          []primitive.ObjectID `bson:"posts,omitempty" json:"posts,omitempty"`
 	Bookmarks      []primitive.ObjectID `bson:"bookmarks,omitempty" json:"bookmarks,omitempty"`
-	CreatedAt      time.Time            `bson:"createdAt,omitempty" json:"createdAt,omitempty"`
-	UpdatedAt      time.Time            `bson:"updatedAt,omitempty" json:"updatedAt,omitempty"`
+	Blocked        []primitive.ObjectID `bson:"blocked,omitempty" json:"blocked,omitempty"`
+	MessagePrivacy string               `bson:"messagePrivacy,omitempty" json:"messagePrivacy,omitempty"`
+	IsAdmin        bool                 `bson:"isAdmin,omitempty" json:"isAdmin,omitempty"`
+	IsPrivate      bool                 `bson:"isPrivate,omitempty" json:"isPrivate,omitempty"`
+	// Pending follow requests are only shown to the account owner
+	FollowRequests []primitive.ObjectID `bson:"followRequests,omitempty" json:"-"`
+	// Notification settings are private, so they're only served by their own endpoint
+	NotificationPreferences NotificationPreferences `bson:"notificationPreferences,omitempty" json:"-"`
+	LastSeen                time.Time               `bson:"lastSeen,omitempty" json:"lastSeen,omitempty"`
+	LastDigestAt            time.Time               `bson:"lastDigestAt,omitempty" json:"-"`
+	CreatedAt               time.Time               `bson:"createdAt,omitempty" json:"createdAt,omitempty"`
+	UpdatedAt               time.Time               `bson:"updatedAt,omitempty" json:"updatedAt,omitempty"`
+	// Digests that failed to send are retried with backoff
+	DigestFailures int       `bson:"digestFailures,omitempty" json:"-"`
+	DigestRetryAt  time.Time `bson:"digestRetryAt,omitempty" json:"-"`
+}
+
+// Who may start a conversation with a user. People the user follows can always
+// message them; everyone else lands in the message requests folder.
+const (
+	MessagePrivacyEveryone  = "everyone"  // anyone may send a request
+	MessagePrivacyFollowers = "followers" // only the user's followers may send a request
+	MessagePrivacyNobody    = "nobody"    // no requests, only people the user follows
+)
+
+// AllowsMessageRequestFrom reports whether the sender may send this user a
+// message request under their privacy setting. Follows are only recorded on
+// the follower's side, so it's the sender's following list that's checked.
+func (u *User) AllowsMessageRequestFrom(sender *User) bool {
+	switch u.MessagePrivacy {
+	case MessagePrivacyNobody:
+		return false
+	case MessagePrivacyFollowers:
+		for _, followed := range sender.Following {
+			if followed == u.ID {
+				return true
+			}
+		}
+		return false
+	}
+	return true
 }
 
 // SeedUsers seeds the user table with initial data
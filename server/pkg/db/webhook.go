@@ -0,0 +1,76 @@
+package db
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Webhook event types
+const (
+	EventPostCreated  = "post.created"
+	EventPostLiked    = "post.liked"
+	EventCommentAdded = "comment.added"
+	EventUserFollowed = "user.followed"
+	EventMessageSent  = "message.sent"
+
+	// EventAll subscribes a webhook to every event type
+	EventAll = "*"
+)
+
+// WebhookEvents lists every event type a webhook can subscribe to
+var WebhookEvents = []string{EventPostCreated, EventPostLiked, EventCommentAdded, EventUserFollowed, EventMessageSent}
+
+// Webhook is an endpoint that receives events. A user's webhook receives the
+// events they're involved in; a webhook an admin registers for all users
+// receives every event in the app.
+type Webhook struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	OwnerID     primitive.ObjectID `bson:"ownerId" json:"ownerId"`
+	URL         string             `bson:"url" json:"url"`
+	Secret      string             `bson:"secret" json:"-"`
+	Events      []string           `bson:"events" json:"events"`
+	AllUsers    bool               `bson:"allUsers,omitempty" json:"allUsers"`
+	Active      bool               `bson:"active" json:"active"`
+	Description string             `bson:"description,omitempty" json:"description,omitempty"`
+	CreatedAt   time.Time          `bson:"createdAt,omitempty" json:"createdAt,omitempty"`
+	UpdatedAt   time.Time          `bson:"updatedAt,omitempty" json:"updatedAt,omitempty"`
+}
+
+// Webhook delivery statuses
+const (
+	DeliveryPending   = "pending"   // waiting for its first attempt or a retry
+	DeliverySucceeded = "succeeded" // the receiver answered with a 2xx status
+	DeliveryFailed    = "failed"    // every attempt failed
+)
+
+// WebhookDelivery is one event sent, or to be sent, to one webhook, along with
+// the outcome of its latest attempt. Redelivering an event creates a new
+// delivery with the same EventID.
+type WebhookDelivery struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	WebhookID      primitive.ObjectID `bson:"webhookId" json:"webhookId"`
+	EventID        string             `bson:"eventId" json:"eventId"`
+	Event          string             `bson:"event" json:"event"`
+	Payload        string             `bson:"payload" json:"payload"`
+	Status         string             `bson:"status" json:"status"`
+	Attempts       int                `bson:"attempts" json:"attempts"`
+	NextAttemptAt  time.Time          `bson:"nextAttemptAt,omitempty" json:"nextAttemptAt,omitempty"`
+	LastAttemptAt  time.Time          `bson:"lastAttemptAt,omitempty" json:"lastAttemptAt,omitempty"`
+	ResponseStatus int                `bson:"responseStatus,omitempty" json:"responseStatus,omitempty"`
+	ResponseBody   string             `bson:"responseBody,omitempty" json:"responseBody,omitempty"`
+	Error          string             `bson:"error,omitempty" json:"error,omitempty"`
+	DurationMs     int64              `bson:"durationMs,omitempty" json:"durationMs,omitempty"`
+	Redelivery     bool               `bson:"redelivery,omitempty" json:"redelivery,omitempty"`
+	CreatedAt      time.Time          `bson:"createdAt" json:"createdAt"`
+}
+
+// DeliveryAttempt is the outcome of one attempt at a delivery
+type DeliveryAttempt struct {
+	Status         string
+	NextAttemptAt  time.Time
+	ResponseStatus int
+	ResponseBody   string
+	Error          string
+	Duration       time.Duration
+}
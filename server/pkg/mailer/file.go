@@ -0,0 +1,38 @@
+package mailer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// FileMailer writes each message to its own .eml file in a directory instead
+// of sending it, for local development and tests. The files open in any mail
+// client.
+type FileMailer struct {
+	dir   string
+	from  string
+	count atomic.Int64
+}
+
+// NewFileMailer creates a mailer writing to dir, creating it if needed
+func NewFileMailer(dir, from string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileMailer{dir: dir, from: from}, nil
+}
+
+func (m *FileMailer) Send(msg Message) error {
+	data, err := build(m.from, msg)
+	if err != nil {
+		return err
+	}
+
+	recipient := strings.NewReplacer("@", "_at_", "/", "_", "\\", "_", "<", "", ">", "", " ", "_").Replace(msg.To)
+	name := fmt.Sprintf("%s-%d-%s.eml", time.Now().Format("20060102T150405"), m.count.Add(1), recipient)
+	return os.WriteFile(filepath.Join(m.dir, name), data, 0o644)
+}
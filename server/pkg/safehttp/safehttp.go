@@ -0,0 +1,49 @@
+// Package safehttp builds HTTP clients for sending requests to URLs that users
+// supplied, such as webhook endpoints and push subscriptions, which mustn't be
+// a way into the server's own network.
+package safehttp
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// ErrPrivateAddress is returned for URLs that resolve to a loopback, private
+// or link-local address
+var ErrPrivateAddress = errors.New("URL resolves to a private address")
+
+// NewClient creates a client with the given timeout that doesn't follow
+// redirects. Unless allowPrivate is set, it refuses to connect to private
+// addresses, checked when connecting so DNS can't be used to slip past it.
+func NewClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+				ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() {
+				return ErrPrivateAddress
+			}
+			return nil
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.Proxy = nil
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		// Requests only go where the user told us to send them
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
@@ -0,0 +1,148 @@
+// Package webhook delivers events to endpoints registered by integrations.
+// Each request carries an HMAC-SHA256 signature of its timestamp and body made
+// with the endpoint's secret, so receivers can check that it came from us and
+// wasn't replayed.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"instacloneapp/server/pkg/safehttp"
+	"io"
+	"math"
+	mathrand "math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Headers of a delivery request
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// maxResponseBody is how much of a receiver's response is kept for the log
+const maxResponseBody = 2048
+
+// ErrPrivateAddress is returned for endpoints that resolve to a loopback,
+// private or link-local address, which integrations have no business reaching
+var ErrPrivateAddress = safehttp.ErrPrivateAddress
+
+// GenerateSecret creates a random signing secret for a new endpoint
+func GenerateSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(secret), nil
+}
+
+// Sign computes the signature header of a delivery: the hex encoded
+// HMAC-SHA256 of "<timestamp>.<body>" under the endpoint's secret
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a signature header the way receivers should, in constant time
+// and rejecting timestamps further than tolerance from now
+func Verify(secret, signature string, timestamp int64, body []byte, tolerance time.Duration) bool {
+	age := time.Since(time.Unix(timestamp, 0))
+	if age > tolerance || age < -tolerance {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(Sign(secret, timestamp, body)))
+}
+
+// ValidateURL checks that an endpoint is an absolute http or https URL
+func ValidateURL(endpoint string) error {
+	target, err := url.Parse(endpoint)
+	if err != nil {
+		return err
+	}
+	if target.Scheme != "http" && target.Scheme != "https" {
+		return fmt.Errorf("webhook URL must use http or https")
+	}
+	if target.Host == "" {
+		return fmt.Errorf("webhook URL has no host")
+	}
+	return nil
+}
+
+// Backoff returns how long to wait before retrying a delivery that failed the
+// given number of times: base doubled after each attempt, capped at max, with
+// up to a fifth of random jitter so failed deliveries don't retry in lockstep
+func Backoff(attempts int, base, max time.Duration) time.Duration {
+	delay := max
+	if exponent := float64(attempts - 1); exponent < 62 {
+		if scaled := float64(base) * math.Pow(2, exponent); scaled < float64(max) {
+			delay = time.Duration(scaled)
+		}
+	}
+	return delay + time.Duration(mathrand.Int63n(int64(delay)/5+1))
+}
+
+// Result is the outcome of one delivery attempt
+type Result struct {
+	StatusCode int
+	Body       string
+	Duration   time.Duration
+}
+
+// Succeeded reports whether the receiver accepted the delivery
+func (r Result) Succeeded() bool {
+	return r.StatusCode >= 200 && r.StatusCode < 300
+}
+
+// Client sends deliveries
+type Client struct {
+	http *http.Client
+}
+
+// NewClient creates a client that gives receivers the timeout to answer. Unless
+// allowPrivate is set, it refuses to connect to private addresses.
+func NewClient(timeout time.Duration, allowPrivate bool) *Client {
+	return &Client{http: safehttp.NewClient(timeout, allowPrivate)}
+}
+
+// Deliver posts a signed event to an endpoint. An error means no response was
+// received; a response of any status is returned as the result.
+func (c *Client) Deliver(ctx context.Context, endpoint, secret, event, deliveryID string, body []byte) (Result, error) {
+	timestamp := time.Now().Unix()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return Result{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Instaclone-Webhooks/1.0")
+	req.Header.Set(HeaderEvent, event)
+	req.Header.Set(HeaderDelivery, deliveryID)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(secret, timestamp, body))
+
+	started := time.Now()
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return Result{Duration: time.Since(started)}, err
+	}
+	defer resp.Body.Close()
+	response, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+
+	return Result{
+		StatusCode: resp.StatusCode,
+		Body:       string(response),
+		Duration:   time.Since(started),
+	}, nil
+}
@@ -0,0 +1,157 @@
+package webpush
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	// recordSize is the aes128gcm record size. Payloads go out as a single
+	// record, and push services only have to accept 4096 bytes of it.
+	recordSize = 4096
+
+	// headerSize is the salt, record size, key ID length and 65 byte key ID
+	// that precede the record
+	headerSize = 16 + 4 + 1 + 65
+
+	// MaxPayloadSize is the largest payload that fits in a push message once
+	// the header, padding delimiter and authentication tag are added
+	MaxPayloadSize = recordSize - headerSize - 1 - 16
+)
+
+// ErrPayloadTooLarge is returned for payloads over MaxPayloadSize
+var ErrPayloadTooLarge = errors.New("push payload too large")
+
+// encrypt encrypts a payload for a subscription as described in RFC 8291,
+// using the aes128gcm content coding from RFC 8188
+func encrypt(keys Keys, payload []byte) ([]byte, error) {
+	if len(payload) > MaxPayloadSize {
+		return nil, ErrPayloadTooLarge
+	}
+
+	// A fresh key pair and salt for every message
+	asPrivate, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return encryptWith(keys, payload, asPrivate, salt)
+}
+
+// encryptWith encrypts a payload with the given application server key pair
+// and salt, which must never be used for another message
+func encryptWith(keys Keys, payload []byte, asPrivate *ecdh.PrivateKey, salt []byte) ([]byte, error) {
+	uaPublic, authSecret, err := keys.decode()
+	if err != nil {
+		return nil, err
+	}
+
+	ecdhSecret, err := asPrivate.ECDH(uaPublic)
+	if err != nil {
+		return nil, err
+	}
+	asPublic := asPrivate.PublicKey().Bytes()
+	cek, nonce := deriveContentKeys(ecdhSecret, authSecret, uaPublic.Bytes(), asPublic, salt)
+
+	gcm, err := newGCM(cek)
+	if err != nil {
+		return nil, err
+	}
+	// The 0x02 delimiter marks the last, and only, record
+	plaintext := append(append([]byte{}, payload...), 0x02)
+	ciphertext := gcm.Seal(nil, nonce, plaintext, nil)
+
+	body := bytes.NewBuffer(make([]byte, 0, headerSize+len(ciphertext)))
+	body.Write(salt)
+	binary.Write(body, binary.BigEndian, uint32(recordSize))
+	body.WriteByte(byte(len(asPublic)))
+	body.Write(asPublic)
+	body.Write(ciphertext)
+	return body.Bytes(), nil
+}
+
+// Decrypt reverses encrypt for the holder of a subscription's private key and
+// auth secret. It's what a user agent does on receiving a push message, and
+// lets a mock push service check what the server sent.
+func Decrypt(body []byte, uaPrivate *ecdh.PrivateKey, authSecret []byte) ([]byte, error) {
+	if len(body) < headerSize {
+		return nil, fmt.Errorf("push message too short")
+	}
+	salt := body[:16]
+	keyIDLength := int(body[20])
+	if keyIDLength != 65 || len(body) < 21+keyIDLength {
+		return nil, fmt.Errorf("unexpected key ID length %d", keyIDLength)
+	}
+	asPublicBytes := body[21 : 21+keyIDLength]
+	ciphertext := body[21+keyIDLength:]
+
+	asPublic, err := ecdh.P256().NewPublicKey(asPublicBytes)
+	if err != nil {
+		return nil, err
+	}
+	ecdhSecret, err := uaPrivate.ECDH(asPublic)
+	if err != nil {
+		return nil, err
+	}
+	cek, nonce := deriveContentKeys(ecdhSecret, authSecret, uaPrivate.PublicKey().Bytes(), asPublicBytes, salt)
+
+	gcm, err := newGCM(cek)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Strip the zero padding and the delimiter before it
+	plaintext = bytes.TrimRight(plaintext, "\x00")
+	if len(plaintext) == 0 || plaintext[len(plaintext)-1] != 0x02 {
+		return nil, fmt.Errorf("invalid padding")
+	}
+	return plaintext[:len(plaintext)-1], nil
+}
+
+// deriveContentKeys derives the content encryption key and nonce of a message
+// from the shared ECDH secret, the subscription's auth secret and the salt
+func deriveContentKeys(ecdhSecret, authSecret, uaPublic, asPublic, salt []byte) (cek, nonce []byte) {
+	keyInfo := append([]byte("WebPush: info\x00"), uaPublic...)
+	keyInfo = append(keyInfo, asPublic...)
+	ikm := hkdf(authSecret, ecdhSecret, keyInfo, 32)
+
+	cek = hkdf(salt, ikm, []byte("Content-Encoding: aes128gcm\x00"), 16)
+	nonce = hkdf(salt, ikm, []byte("Content-Encoding: nonce\x00"), 12)
+	return cek, nonce
+}
+
+// hkdf is HKDF-SHA-256 (RFC 5869) for outputs of at most one hash length,
+// which is all web push needs
+func hkdf(salt, secret, info []byte, length int) []byte {
+	extract := hmac.New(sha256.New, salt)
+	extract.Write(secret)
+	prk := extract.Sum(nil)
+
+	expand := hmac.New(sha256.New, prk)
+	expand.Write(info)
+	expand.Write([]byte{0x01})
+	return expand.Sum(nil)[:length]
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,151 @@
+package webpush
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// MockPushService stands in for a browser's push service and the browser
+// behind it, for trying the sender locally or in tests. Serve it with
+// httptest.NewServer and send to Subscription(server.URL) with a sender that
+// may reach private addresses; it checks each request's VAPID signature,
+// decrypts the payload and keeps it.
+type MockPushService struct {
+	privateKey *ecdh.PrivateKey
+	authSecret []byte
+
+	mu       sync.Mutex
+	status   int
+	received []MockMessage
+}
+
+// MockMessage is a push message as the mock service received it
+type MockMessage struct {
+	Payload []byte
+	Header  http.Header
+}
+
+// NewMockPushService creates a mock push service with a fresh subscription key
+// pair. It accepts messages with 201 Created until told otherwise.
+func NewMockPushService() (*MockPushService, error) {
+	privateKey, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	authSecret := make([]byte, 16)
+	if _, err := rand.Read(authSecret); err != nil {
+		return nil, err
+	}
+	return &MockPushService{privateKey: privateKey, authSecret: authSecret, status: http.StatusCreated}, nil
+}
+
+// Subscription returns the subscription of the mock browser at the endpoint
+func (m *MockPushService) Subscription(endpoint string) Subscription {
+	return Subscription{
+		Endpoint: endpoint,
+		Keys: Keys{
+			P256dh: base64.RawURLEncoding.EncodeToString(m.privateKey.PublicKey().Bytes()),
+			Auth:   base64.RawURLEncoding.EncodeToString(m.authSecret),
+		},
+	}
+}
+
+// RespondWith sets the status valid messages are answered with, e.g.
+// http.StatusGone to act as if the subscription expired
+func (m *MockPushService) RespondWith(status int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.status = status
+}
+
+// Received returns the messages received so far
+func (m *MockPushService) Received() []MockMessage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]MockMessage(nil), m.received...)
+}
+
+func (m *MockPushService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := verifyVAPID(r.Header.Get("Authorization")); err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if r.Header.Get("Content-Encoding") != "aes128gcm" || r.Header.Get("TTL") == "" {
+		http.Error(w, "missing Content-Encoding or TTL", http.StatusBadRequest)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	payload, err := Decrypt(body, m.privateKey, m.authSecret)
+	if err != nil {
+		http.Error(w, "decryption failed: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	m.mu.Lock()
+	status := m.status
+	if status >= 200 && status < 300 {
+		m.received = append(m.received, MockMessage{Payload: payload, Header: r.Header.Clone()})
+	}
+	m.mu.Unlock()
+	w.WriteHeader(status)
+}
+
+// verifyVAPID checks a "vapid t=<jwt>, k=<key>" header was signed with the
+// key it carries
+func verifyVAPID(header string) error {
+	params, ok := strings.CutPrefix(header, "vapid ")
+	if !ok {
+		return fmt.Errorf("missing vapid authorization")
+	}
+
+	var token, key string
+	for _, param := range strings.Split(params, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+		switch name {
+		case "t":
+			token = value
+		case "k":
+			key = value
+		}
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return fmt.Errorf("malformed vapid token")
+	}
+	rawKey, err := decodeBase64(key)
+	if err != nil {
+		return fmt.Errorf("malformed vapid key")
+	}
+	x, y := elliptic.Unmarshal(elliptic.P256(), rawKey)
+	if x == nil {
+		return fmt.Errorf("malformed vapid key")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || len(signature) != 64 {
+		return fmt.Errorf("malformed vapid signature")
+	}
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	r := new(big.Int).SetBytes(signature[:32])
+	s := new(big.Int).SetBytes(signature[32:])
+	if !ecdsa.Verify(&ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, digest[:], r, s) {
+		return fmt.Errorf("invalid vapid signature")
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package webpush
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/url"
+	"time"
+)
+
+// VAPIDKeys is the application server's key pair that push services use to
+// check push requests come from the server a subscription was created for
+// (RFC 8292)
+type VAPIDKeys struct {
+	private *ecdsa.PrivateKey
+	public  []byte // uncompressed P-256 point
+}
+
+// GenerateVAPIDKeys creates a new VAPID key pair
+func GenerateVAPIDKeys() (*VAPIDKeys, error) {
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return vapidKeysFromECDH(key)
+}
+
+// ParseVAPIDPrivateKey loads a key pair from its private key, the raw 32 byte
+// P-256 scalar in unpadded base64url as most push libraries print it
+func ParseVAPIDPrivateKey(encoded string) (*VAPIDKeys, error) {
+	raw, err := decodeBase64(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID private key encoding: %w", err)
+	}
+	key, err := ecdh.P256().NewPrivateKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID private key: %w", err)
+	}
+	return vapidKeysFromECDH(key)
+}
+
+func vapidKeysFromECDH(key *ecdh.PrivateKey) (*VAPIDKeys, error) {
+	public := key.PublicKey().Bytes()
+	x, y := elliptic.Unmarshal(elliptic.P256(), public)
+	if x == nil {
+		return nil, fmt.Errorf("invalid VAPID public key")
+	}
+
+	return &VAPIDKeys{
+		private: &ecdsa.PrivateKey{
+			PublicKey: ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y},
+			D:         new(big.Int).SetBytes(key.Bytes()),
+		},
+		public: public,
+	}, nil
+}
+
+// PublicKey returns the public key in unpadded base64url, the form browsers
+// take as applicationServerKey when subscribing
+func (k *VAPIDKeys) PublicKey() string {
+	return base64.RawURLEncoding.EncodeToString(k.public)
+}
+
+// PrivateKey returns the private key in the form ParseVAPIDPrivateKey reads
+func (k *VAPIDKeys) PrivateKey() string {
+	return base64.RawURLEncoding.EncodeToString(k.private.D.FillBytes(make([]byte, 32)))
+}
+
+// authorization builds the Authorization header of a push request to the
+// given endpoint: a JWT signed with ES256 for the push service's origin,
+// along with the public key to check it with
+func (k *VAPIDKeys) authorization(endpoint, subject string, expiry time.Duration) (string, error) {
+	target, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+
+	header, err := json.Marshal(map[string]string{"typ": "JWT", "alg": "ES256"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]interface{}{
+		"aud": target.Scheme + "://" + target.Host,
+		"exp": time.Now().Add(expiry).Unix(),
+		"sub": subject,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	r, s, err := ecdsa.Sign(rand.Reader, k.private, digest[:])
+	if err != nil {
+		return "", err
+	}
+
+	// JWS wants the signature as the two fixed size integers back to back
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+
+	token := unsigned + "." + base64.RawURLEncoding.EncodeToString(signature)
+	return fmt.Sprintf("vapid t=%s, k=%s", token, k.PublicKey()), nil
+}
+
+// decodeBase64 decodes base64url with or without padding, as subscription
+// keys come both ways depending on the browser
+func decodeBase64(encoded string) ([]byte, error) {
+	if decoded, err := base64.RawURLEncoding.DecodeString(encoded); err == nil {
+		return decoded, nil
+	}
+	return base64.URLEncoding.DecodeString(encoded)
+}
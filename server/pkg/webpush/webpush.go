@@ -0,0 +1,182 @@
+// Package webpush sends notifications to browsers through their push service,
+// so users get them even with the app closed. Messages are signed with VAPID
+// (RFC 8292) and encrypted end to end as described in RFC 8291.
+package webpush
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"errors"
+	"fmt"
+	"instacloneapp/server/pkg/safehttp"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+// ErrSubscriptionGone is returned when the push service reports that a
+// subscription expired or was unsubscribed; it should be forgotten
+var ErrSubscriptionGone = errors.New("push subscription no longer exists")
+
+// Subscription is where and how to reach one browser, as returned by
+// PushManager.subscribe()
+type Subscription struct {
+	Endpoint string `json:"endpoint"`
+	Keys     Keys   `json:"keys"`
+}
+
+// Keys are the subscription's keys for encrypting messages to it, in
+// base64url
+type Keys struct {
+	P256dh string `json:"p256dh"`
+	Auth   string `json:"auth"`
+}
+
+// ValidateEndpoint checks that a subscription's endpoint is an absolute https
+// URL, which is all push services hand out
+func ValidateEndpoint(endpoint string) error {
+	target, err := url.Parse(endpoint)
+	if err != nil {
+		return err
+	}
+	if target.Scheme != "https" {
+		return fmt.Errorf("push endpoint must use https")
+	}
+	if target.Host == "" {
+		return fmt.Errorf("push endpoint has no host")
+	}
+	return nil
+}
+
+// Validate checks that the keys can be used to encrypt messages
+func (k Keys) Validate() error {
+	_, _, err := k.decode()
+	return err
+}
+
+func (k Keys) decode() (*ecdh.PublicKey, []byte, error) {
+	raw, err := decodeBase64(k.P256dh)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid p256dh key encoding: %w", err)
+	}
+	public, err := ecdh.P256().NewPublicKey(raw)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid p256dh key: %w", err)
+	}
+	auth, err := decodeBase64(k.Auth)
+	if err != nil || len(auth) != 16 {
+		return nil, nil, fmt.Errorf("invalid auth secret")
+	}
+	return public, auth, nil
+}
+
+// Urgency tells the push service how soon a message has to reach a device
+// that's saving battery
+type Urgency string
+
+const (
+	UrgencyLow    Urgency = "low"
+	UrgencyNormal Urgency = "normal"
+	UrgencyHigh   Urgency = "high"
+)
+
+// Options are the delivery options of one push message
+type Options struct {
+	// TTL is how long the push service keeps the message for a device that's
+	// offline. Zero means it's dropped unless it can be delivered right away.
+	TTL time.Duration
+	// Urgency defaults to normal when empty
+	Urgency Urgency
+	// Topic, if set, replaces a message with the same topic that the push
+	// service still holds. At most 32 base64url characters.
+	Topic string
+}
+
+// Sender sends push messages on behalf of the application server
+type Sender struct {
+	keys    *VAPIDKeys
+	subject string
+	client  *http.Client
+}
+
+// NewSender creates a sender signing with the given keys. subject is a
+// mailto: or https: URL push services can contact the operator at. Endpoints
+// come from browsers, so unless allowPrivate is set the sender refuses to
+// connect to private addresses.
+func NewSender(keys *VAPIDKeys, subject string, allowPrivate bool) *Sender {
+	return &Sender{keys: keys, subject: subject, client: safehttp.NewClient(30*time.Second, allowPrivate)}
+}
+
+// NewSenderFromEnv creates a sender from VAPID_PRIVATE_KEY and VAPID_SUBJECT.
+// It returns nil without an error when no key is configured, which leaves web
+// push disabled. PUSH_ALLOW_PRIVATE_NETWORKS=true lets it reach push services
+// on private networks, e.g. a mock one during development.
+func NewSenderFromEnv() (*Sender, error) {
+	privateKey := os.Getenv("VAPID_PRIVATE_KEY")
+	if privateKey == "" {
+		return nil, nil
+	}
+	keys, err := ParseVAPIDPrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	subject := os.Getenv("VAPID_SUBJECT")
+	if subject == "" {
+		return nil, fmt.Errorf("VAPID_SUBJECT is not set")
+	}
+	return NewSender(keys, subject, os.Getenv("PUSH_ALLOW_PRIVATE_NETWORKS") == "true"), nil
+}
+
+// PublicKey returns the VAPID public key clients subscribe with
+func (s *Sender) PublicKey() string {
+	return s.keys.PublicKey()
+}
+
+// Send encrypts a payload for the subscription and hands it to its push
+// service
+func (s *Sender) Send(ctx context.Context, subscription Subscription, payload []byte, opts Options) error {
+	body, err := encrypt(subscription.Keys, payload)
+	if err != nil {
+		return err
+	}
+	authorization, err := s.keys.authorization(subscription.Endpoint, s.subject, 12*time.Hour)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", authorization)
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("TTL", strconv.Itoa(int(opts.TTL.Seconds())))
+	if opts.Urgency != "" {
+		req.Header.Set("Urgency", string(opts.Urgency))
+	}
+	if opts.Topic != "" {
+		req.Header.Set("Topic", opts.Topic)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusGone || resp.StatusCode == http.StatusNotFound:
+		return ErrSubscriptionGone
+	default:
+		return fmt.Errorf("push service responded %s: %s", resp.Status, bytes.TrimSpace(detail))
+	}
+}
@@ -0,0 +1,184 @@
+package webpush
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"encoding/base64"
+	"errors"
+	"instacloneapp/server/pkg/safehttp"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// The example from RFC 8291 section 5
+const (
+	rfcPlaintext  = "When I grow up, I want to be a watermelon"
+	rfcASPrivate  = "yfWPiYE-n46HLnH0KqZOF1fJJU3MYrct3AELtAQ-oRw"
+	rfcUAPrivate  = "q1dXpw3UpT5VOmu_cf_v6ih07Aems3njxI-JWgLcM94"
+	rfcUAPublic   = "BCVxsr7N_eNgVRqvHtD0zTZsEc6-VV-JvLexhqUzORcxaOzi6-AYWXvTBHm4bjyPjs7Vd8pZGH6SRpkNtoIAiw4"
+	rfcAuthSecret = "BTBZMqHH6r4Tts7J_aSIgg"
+	rfcSalt       = "DGv6ra1nlYgDCS1FRnbzlw"
+	rfcBody       = "DGv6ra1nlYgDCS1FRnbzlwAAEABBBP4z9KsN6nGRTbVYI_c7VJSPQTBtkgcy27mlmlMoZIIgDll6e3vCYLocInmYWAmS6TlzAC8wEqKK6PBru3jl7A_yl95bQpu6cVPTpK4Mqgkf1CXztLVBSt2Ks3oZwbuwXPXLWyouBWLVWGNWQexSgSxsj_Qulcy4a-fN"
+)
+
+func mustDecode(t *testing.T, encoded string) []byte {
+	t.Helper()
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func TestEncryptMatchesRFC8291Example(t *testing.T) {
+	asPrivate, err := ecdh.P256().NewPrivateKey(mustDecode(t, rfcASPrivate))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := Keys{P256dh: rfcUAPublic, Auth: rfcAuthSecret}
+
+	body, err := encryptWith(keys, []byte(rfcPlaintext), asPrivate, mustDecode(t, rfcSalt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := base64.RawURLEncoding.EncodeToString(body); got != rfcBody {
+		t.Errorf("encrypted body = %s, want %s", got, rfcBody)
+	}
+}
+
+func TestDecryptRFC8291Example(t *testing.T) {
+	uaPrivate, err := ecdh.P256().NewPrivateKey(mustDecode(t, rfcUAPrivate))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload, err := Decrypt(mustDecode(t, rfcBody), uaPrivate, mustDecode(t, rfcAuthSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(payload) != rfcPlaintext {
+		t.Errorf("decrypted %q, want %q", payload, rfcPlaintext)
+	}
+}
+
+func TestEncryptRejectsLargePayloads(t *testing.T) {
+	mock, err := NewMockPushService()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := mock.Subscription("https://push.example.com/x").Keys
+
+	if _, err := encrypt(keys, make([]byte, MaxPayloadSize)); err != nil {
+		t.Errorf("encrypting %d bytes: %v", MaxPayloadSize, err)
+	}
+	if _, err := encrypt(keys, make([]byte, MaxPayloadSize+1)); !errors.Is(err, ErrPayloadTooLarge) {
+		t.Errorf("encrypting %d bytes = %v, want ErrPayloadTooLarge", MaxPayloadSize+1, err)
+	}
+}
+
+// newTestSender returns a sender with fresh keys and a mock push service it
+// can reach on loopback
+func newTestSender(t *testing.T) (*Sender, *MockPushService, Subscription) {
+	t.Helper()
+	keys, err := GenerateVAPIDKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock, err := NewMockPushService()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(mock)
+	t.Cleanup(server.Close)
+
+	return NewSender(keys, "mailto:admin@example.com", true), mock, mock.Subscription(server.URL + "/push/abc")
+}
+
+func TestSendDeliversToPushService(t *testing.T) {
+	sender, mock, subscription := newTestSender(t)
+
+	payload := []byte(`{"type":"like","body":"alice liked your post"}`)
+	err := sender.Send(context.Background(), subscription, payload, Options{
+		TTL:     time.Hour,
+		Urgency: UrgencyHigh,
+		Topic:   "post-liked",
+	})
+	if err != nil {
+		t.Fatalf("sending: %v", err)
+	}
+
+	received := mock.Received()
+	if len(received) != 1 {
+		t.Fatalf("push service received %d messages, want 1", len(received))
+	}
+	message := received[0]
+	if !bytes.Equal(message.Payload, payload) {
+		t.Errorf("payload = %s, want %s", message.Payload, payload)
+	}
+	for header, want := range map[string]string{"TTL": "3600", "Urgency": "high", "Topic": "post-liked"} {
+		if got := message.Header.Get(header); got != want {
+			t.Errorf("%s header = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestSendReportsGoneSubscriptions(t *testing.T) {
+	sender, mock, subscription := newTestSender(t)
+
+	for _, status := range []int{http.StatusGone, http.StatusNotFound} {
+		mock.RespondWith(status)
+		err := sender.Send(context.Background(), subscription, []byte("{}"), Options{})
+		if !errors.Is(err, ErrSubscriptionGone) {
+			t.Errorf("push service responding %d: got %v, want ErrSubscriptionGone", status, err)
+		}
+	}
+
+	mock.RespondWith(http.StatusTooManyRequests)
+	err := sender.Send(context.Background(), subscription, []byte("{}"), Options{})
+	if err == nil || errors.Is(err, ErrSubscriptionGone) {
+		t.Errorf("push service responding 429: got %v, want a retryable error", err)
+	}
+}
+
+func TestSendRefusesPrivateAddresses(t *testing.T) {
+	keys, err := GenerateVAPIDKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock, err := NewMockPushService()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(mock)
+	defer server.Close()
+
+	sender := NewSender(keys, "mailto:admin@example.com", false)
+	err = sender.Send(context.Background(), mock.Subscription(server.URL), []byte("{}"), Options{})
+	if !errors.Is(err, safehttp.ErrPrivateAddress) {
+		t.Errorf("sending to %s: got %v, want ErrPrivateAddress", server.URL, err)
+	}
+	if received := mock.Received(); len(received) != 0 {
+		t.Errorf("push service received %d messages, want none", len(received))
+	}
+}
+
+func TestValidateEndpoint(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		valid    bool
+	}{
+		{"https://fcm.googleapis.com/fcm/send/abc", true},
+		{"http://fcm.googleapis.com/fcm/send/abc", false},
+		{"https:///no-host", false},
+		{"ftp://push.example.com/abc", false},
+		{"not a url", false},
+	}
+	for _, tt := range tests {
+		if err := ValidateEndpoint(tt.endpoint); (err == nil) != tt.valid {
+			t.Errorf("ValidateEndpoint(%q) = %v, want valid %v", tt.endpoint, err, tt.valid)
+		}
+	}
+}
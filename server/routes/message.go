@@ -21,5 +21,68 @@ func SetupMessageRoutes(router *gin.Engine, database db.Database, cloudinaryClie
 
 		// Route to get messages
 		messageRoutes.GET("/all/:id", middleware.IsAuthenticated(), controller.GetMessages())
+
+		// Route to edit a message
+		messageRoutes.PUT("/edit/:id", middleware.IsAuthenticated(), controller.EditMessage())
+
+		// Route to unsend a message for everyone
+		messageRoutes.DELETE("/unsend/:id", middleware.IsAuthenticated(), controller.UnsendMessage())
+
+		// Route to react to a message
+		messageRoutes.POST("/react/:id", middleware.IsAuthenticated(), controller.ReactToMessage())
+
+		// Route to remove a reaction from a message
+		messageRoutes.DELETE("/react/:id", middleware.IsAuthenticated(), controller.RemoveReaction())
+
+		// Route to search the caller's message history
+		messageRoutes.GET("/search", middleware.IsAuthenticated(), controller.SearchMessages())
+
+		// Route to list message requests from people the caller doesn't follow
+		messageRoutes.GET("/requests", middleware.IsAuthenticated(), controller.GetMessageRequests())
+
+		// Route to accept a message request
+		messageRoutes.POST("/requests/:id/accept", middleware.IsAuthenticated(), controller.AcceptMessageRequest())
+
+		// Route to delete a message request
+		messageRoutes.DELETE("/requests/:id", middleware.IsAuthenticated(), controller.DeleteMessageRequest())
+
+		// Route to block the sender of a message request
+		messageRoutes.POST("/requests/:id/block", middleware.IsAuthenticated(), controller.BlockMessageRequest())
+
+		// Route to choose who may send the caller message requests
+		messageRoutes.PUT("/settings", middleware.IsAuthenticated(), controller.UpdateMessageSettings())
+
+		// Route to list the caller's conversations
+		messageRoutes.GET("/conversations", middleware.IsAuthenticated(), controller.GetConversations())
+
+		// Route to mark a conversation read up to a message
+		messageRoutes.POST("/conversations/:id/read", middleware.IsAuthenticated(), controller.MarkConversationRead())
+
+		// Route to create a group conversation
+		messageRoutes.POST("/group", middleware.IsAuthenticated(), controller.CreateGroup())
+
+		// Route to get a group conversation
+		messageRoutes.GET("/group/:id", middleware.IsAuthenticated(), controller.GetGroup())
+
+		// Route to rename a group
+		messageRoutes.PUT("/group/:id/rename", middleware.IsAuthenticated(), controller.RenameGroup())
+
+		// Route to add members to a group
+		messageRoutes.POST("/group/:id/members", middleware.IsAuthenticated(), controller.AddGroupMembers())
+
+		// Route to remove a member from a group
+		messageRoutes.DELETE("/group/:id/members/:user_id", middleware.IsAuthenticated(), controller.RemoveGroupMember())
+
+		// Route to promote or demote a group admin
+		messageRoutes.PUT("/group/:id/admins/:user_id", middleware.IsAuthenticated(), controller.SetGroupAdmin())
+
+		// Route to leave a group
+		messageRoutes.POST("/group/:id/leave", middleware.IsAuthenticated(), controller.LeaveGroup())
+
+		// Route to send a message to a group
+		messageRoutes.POST("/group/:id/send", middleware.IsAuthenticated(), controller.SendGroupMessage())
+
+		// Route to get the messages of a group
+		messageRoutes.GET("/group/:id/messages", middleware.IsAuthenticated(), controller.GetGroupMessages())
 	}
 }
@@ -0,0 +1,53 @@
+package routes
+
+import (
+	"instacloneapp/server/controller"
+	"instacloneapp/server/middleware"
+	"instacloneapp/server/pkg/db"
+
+	"github.com/cloudinary/cloudinary-go"
+	"github.com/gin-gonic/gin"
+)
+
+// SetupNotificationRoutes sets up the routes for the notification inbox
+func SetupNotificationRoutes(router *gin.Engine, database db.Database, cloudinaryClient *cloudinary.Cloudinary) {
+
+	controller.InitUser(database, cloudinaryClient)
+	notificationRoutes := router.Group("/api/v1/notifications")
+	{
+		// Route to list the caller's notifications
+		notificationRoutes.GET("", middleware.IsAuthenticated(), controller.GetNotifications())
+
+		// Route to get the unread notification count for the badge
+		notificationRoutes.GET("/unread-count", middleware.IsAuthenticated(), controller.GetUnreadNotificationCount())
+
+		// Route to mark every notification as read
+		notificationRoutes.POST("/read-all", middleware.IsAuthenticated(), controller.MarkAllNotificationsRead())
+
+		// Route to mark a notification as read
+		notificationRoutes.POST("/:id/read", middleware.IsAuthenticated(), controller.MarkNotificationRead())
+
+		// Routes to read and change which notifications the caller gets and how
+		notificationRoutes.GET("/preferences", middleware.IsAuthenticated(), controller.GetNotificationPreferences())
+		notificationRoutes.PUT("/preferences", middleware.IsAuthenticated(), controller.UpdateNotificationPreferences())
+
+		// Routes to mute and unmute notifications about a post
+		notificationRoutes.POST("/mute/posts/:id", middleware.IsAuthenticated(), controller.MutePost())
+		notificationRoutes.DELETE("/mute/posts/:id", middleware.IsAuthenticated(), controller.UnmutePost())
+
+		// Routes to mute and unmute notifications about a conversation
+		notificationRoutes.POST("/mute/conversations/:id", middleware.IsAuthenticated(), controller.MuteConversation())
+		notificationRoutes.DELETE("/mute/conversations/:id", middleware.IsAuthenticated(), controller.UnmuteConversation())
+
+		// Route to get the key browsers subscribe to web push with
+		notificationRoutes.GET("/push/public-key", controller.GetPushPublicKey())
+
+		// Routes to register and unregister a browser for web push
+		notificationRoutes.POST("/push/subscriptions", middleware.IsAuthenticated(), controller.SubscribePush())
+		notificationRoutes.DELETE("/push/subscriptions", middleware.IsAuthenticated(), controller.UnsubscribePush())
+
+		// Routes behind the signed unsubscribe links in email digests
+		notificationRoutes.GET("/unsubscribe", controller.ShowUnsubscribe())
+		notificationRoutes.POST("/unsubscribe", controller.Unsubscribe())
+	}
+}
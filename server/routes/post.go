@@ -18,6 +18,27 @@ func SetupPostRoutes(router *gin.Engine, database db.Database, cloudinaryClient
 		// Route to add a new post
 		postRoutes.POST("/addpost", middleware.IsAuthenticated(), controller.AddNewPost())
 
+		// Route to list the user's drafts and scheduled posts
+		postRoutes.GET("/drafts", middleware.IsAuthenticated(), controller.GetDrafts())
+
+		// Route to edit a draft or scheduled post
+		postRoutes.PUT("/:id/draft", middleware.IsAuthenticated(), controller.EditDraft())
+
+		// Route to publish a draft or scheduled post immediately
+		postRoutes.POST("/:id/publish", middleware.IsAuthenticated(), controller.PublishDraft())
+
+		// Route to list the user's archived posts
+		postRoutes.GET("/archived", middleware.IsAuthenticated(), controller.GetArchivedPosts())
+
+		// Route to list the user's recently deleted posts
+		postRoutes.GET("/deleted", middleware.IsAuthenticated(), controller.GetDeletedPosts())
+
+		// Route to archive a post
+		postRoutes.POST("/:id/archive", middleware.IsAuthenticated(), controller.ArchivePost())
+
+		// Route to restore an archived or recently deleted post
+		postRoutes.POST("/:id/restore", middleware.IsAuthenticated(), controller.RestorePost())
+
 		// Route to get all posts
 		postRoutes.GET("/all", middleware.IsAuthenticated(), controller.GetAllPosts())
 
@@ -36,6 +57,27 @@ func SetupPostRoutes(router *gin.Engine, database db.Database, cloudinaryClient
 		// Route to get all comments for a post
 		postRoutes.POST("/:id/comment/all", middleware.IsAuthenticated(), controller.GetCommentsOfPost())
 
+		// Route to get a page of replies to a comment
+		postRoutes.GET("/comment/:comment_id/replies", middleware.IsAuthenticated(), controller.GetCommentReplies())
+
+		// Route to like a comment
+		postRoutes.GET("/comment/:comment_id/like", middleware.IsAuthenticated(), controller.LikeComment())
+
+		// Route to dislike a comment
+		postRoutes.GET("/comment/:comment_id/dislike", middleware.IsAuthenticated(), controller.DislikeComment())
+
+		// Route to edit a comment
+		postRoutes.PUT("/comment/:comment_id/edit", middleware.IsAuthenticated(), controller.EditComment())
+
+		// Route to delete a comment
+		postRoutes.DELETE("/comment/:comment_id/delete", middleware.IsAuthenticated(), controller.DeleteComment())
+
+		// Route to pin or unpin a comment
+		postRoutes.GET("/comment/:comment_id/pin", middleware.IsAuthenticated(), controller.PinComment())
+
+		// Route to update who can comment on a post
+		postRoutes.PUT("/:id/comment/settings", middleware.IsAuthenticated(), controller.UpdateCommentSettings())
+
 		// Route to delete a post
 		postRoutes.DELETE("/delete/:id", middleware.IsAuthenticated(), controller.DeletePost())
 
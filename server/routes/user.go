@@ -2,6 +2,7 @@ package routes
 
 import (
 	"instacloneapp/server/controller"
+	"instacloneapp/server/middleware"
 	"instacloneapp/server/pkg/db"
 
 	"github.com/cloudinary/cloudinary-go"
@@ -15,7 +16,7 @@ func SetupRoutes(router *gin.Engine, database db.Database, cloudinaryClient *clo
 	// Create a new group for user-related routes
 	userRoutes := router.Group("/api/v1/user")
 	{
-		userRoutes.GET("", controller.GetUsers())
+		userRoutes.GET("", middleware.OptionalAuthentication(), controller.GetUsers())
 
 		// Route for user registration
 		userRoutes.POST("/register", controller.Register())
@@ -27,7 +28,7 @@ func SetupRoutes(router *gin.Engine, database db.Database, cloudinaryClient *clo
 		userRoutes.POST("/logout", controller.Logout())
 
 		// Route to get a user's profile by ID
-		userRoutes.GET("/:id/profile", controller.GetProfile())
+		userRoutes.GET("/:id/profile", middleware.OptionalAuthentication(), controller.GetProfile())
 
 		// Route to edit a user's profile (e.g., username, bio, etc.)
 		userRoutes.PUT("/profile/edit", controller.EditProfile())
@@ -36,7 +37,18 @@ func SetupRoutes(router *gin.Engine, database db.Database, cloudinaryClient *clo
 		userRoutes.GET("/suggested", controller.GetSuggestedUsers())
 
 		// Route to  unfollow a user based on their ID
-		userRoutes.POST("/followorunfollow/:id", controller.FollowOrUnfollowUser())
+		userRoutes.POST("/followorunfollow/:id", middleware.IsAuthenticated(), controller.FollowOrUnfollowUser())
+
+		// Route to make the caller's account private or public
+		userRoutes.PUT("/privacy", middleware.IsAuthenticated(), controller.UpdateAccountPrivacy())
+
+		// Routes to list, accept and decline requests to follow the caller's private account
+		userRoutes.GET("/followrequests", middleware.IsAuthenticated(), controller.GetFollowRequests())
+		userRoutes.POST("/followrequests/:id/accept", middleware.IsAuthenticated(), controller.AcceptFollowRequest())
+		userRoutes.POST("/followrequests/:id/decline", middleware.IsAuthenticated(), controller.DeclineFollowRequest())
+
+		// Route to get a short-lived ticket for opening a websocket connection
+		userRoutes.POST("/socket-ticket", middleware.IsAuthenticated(), controller.GetSocketTicket())
 
 	}
 
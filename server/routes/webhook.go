@@ -0,0 +1,35 @@
+package routes
+
+import (
+	"instacloneapp/server/controller"
+	"instacloneapp/server/middleware"
+	"instacloneapp/server/pkg/db"
+
+	"github.com/cloudinary/cloudinary-go"
+	"github.com/gin-gonic/gin"
+)
+
+// SetupWebhookRoutes sets up the routes for managing outgoing webhooks
+func SetupWebhookRoutes(router *gin.Engine, database db.Database, cloudinaryClient *cloudinary.Cloudinary) {
+
+	controller.InitUser(database, cloudinaryClient)
+	webhookRoutes := router.Group("/api/v1/webhooks")
+	{
+		// Routes to list and register the caller's webhooks
+		webhookRoutes.GET("", middleware.IsAuthenticated(), controller.GetWebhooks())
+		webhookRoutes.POST("", middleware.IsAuthenticated(), controller.CreateWebhook())
+
+		// Routes to change and remove a webhook
+		webhookRoutes.PUT("/:id", middleware.IsAuthenticated(), controller.UpdateWebhook())
+		webhookRoutes.DELETE("/:id", middleware.IsAuthenticated(), controller.DeleteWebhook())
+
+		// Route to replace a webhook's signing secret
+		webhookRoutes.POST("/:id/rotate-secret", middleware.IsAuthenticated(), controller.RotateWebhookSecret())
+
+		// Route to read a webhook's delivery log
+		webhookRoutes.GET("/:id/deliveries", middleware.IsAuthenticated(), controller.GetWebhookDeliveries())
+
+		// Route to send a logged delivery again
+		webhookRoutes.POST("/:id/deliveries/:deliveryId/redeliver", middleware.IsAuthenticated(), controller.RedeliverWebhookDelivery())
+	}
+}
@@ -0,0 +1,257 @@
+package socket
+
+import (
+	"fmt"
+	"instacloneapp/server/utils"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// Broker carries realtime events between server instances. Every instance
+// subscribes and delivers the events it receives to its own connections, so
+// a user is reached whichever instance they're connected to. The broker also
+// tracks which users are connected anywhere.
+type Broker interface {
+	// Publish sends an encoded event to every connection of the user on every
+	// instance. seq is the event's sequence number, or 0 if it has none.
+	Publish(userID string, seq int64, data []byte) error
+
+	// PublishAll sends an encoded frame to every connection on every instance
+	PublishAll(data []byte) error
+
+	// Subscribe starts handing published events to deliver. userID is empty
+	// for frames meant for everyone.
+	Subscribe(deliver func(userID string, seq int64, data []byte)) error
+
+	// PublishSequenced gives an encoded event the user's next sequence
+	// number, keeps it in their bounded replay log and publishes it, all as
+	// one step so concurrent publishers can't log or deliver events out of
+	// order. Sequence numbers increase monotonically per user, starting at 1.
+	PublishSequenced(userID string, data []byte) (int64, error)
+
+	// Replay returns the logged events after the given sequence number. ok is
+	// false when some of them already dropped out of the log, or the client
+	// is ahead of the server, and it has to resync from scratch.
+	Replay(userID string, afterSeq int64) (events []SequencedEvent, ok bool, err error)
+
+	// Connected and Disconnected record that the user's first connection to
+	// this instance opened or its last one closed
+	Connected(userID string) error
+	Disconnected(userID string) error
+
+	// IsOnline reports whether the user is connected to any instance
+	IsOnline(userID string) (bool, error)
+
+	// OnlineUsers lists the users connected to any instance
+	OnlineUsers() ([]string, error)
+
+	Close() error
+}
+
+// SequencedEvent is an encoded event along with its sequence number
+type SequencedEvent struct {
+	Seq  int64
+	Data []byte
+}
+
+// replayLogSize is how many recent events are kept per user for replay,
+// unless REALTIME_REPLAY_SIZE overrides it
+const replayLogSize = 200
+
+// eventLog is a user's sequence counter and their most recent events
+type eventLog struct {
+	seq    int64
+	events []SequencedEvent
+}
+
+// localBroker delivers events within a single process
+type localBroker struct {
+	mu      sync.RWMutex
+	deliver func(userID string, seq int64, data []byte)
+	online  map[string]bool
+	logs    map[string]*eventLog
+	logSize int
+}
+
+// NewLocalBroker creates a broker for a single server instance
+func NewLocalBroker() Broker {
+	return &localBroker{
+		online:  make(map[string]bool),
+		logs:    make(map[string]*eventLog),
+		logSize: int(utils.GetEnvInt64("REALTIME_REPLAY_SIZE", replayLogSize)),
+	}
+}
+
+func (b *localBroker) Publish(userID string, seq int64, data []byte) error {
+	b.mu.RLock()
+	deliver := b.deliver
+	b.mu.RUnlock()
+
+	if deliver != nil {
+		deliver(userID, seq, data)
+	}
+	return nil
+}
+
+func (b *localBroker) PublishAll(data []byte) error {
+	return b.Publish("", 0, data)
+}
+
+func (b *localBroker) Subscribe(deliver func(userID string, seq int64, data []byte)) error {
+	b.mu.Lock()
+	b.deliver = deliver
+	b.mu.Unlock()
+	return nil
+}
+
+func (b *localBroker) PublishSequenced(userID string, data []byte) (int64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	log := b.logFor(userID)
+	log.seq++
+	data = withSequence(data, log.seq)
+	log.events = append(log.events, SequencedEvent{Seq: log.seq, Data: data})
+	if len(log.events) > b.logSize {
+		log.events = append([]SequencedEvent(nil), log.events[len(log.events)-b.logSize:]...)
+	}
+
+	// Delivering under the lock keeps deliveries in sequence order
+	if b.deliver != nil {
+		b.deliver(userID, log.seq, data)
+	}
+	return log.seq, nil
+}
+
+func (b *localBroker) Replay(userID string, afterSeq int64) ([]SequencedEvent, bool, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	log, ok := b.logs[userID]
+	if !ok {
+		// Nothing was sent since this instance started
+		return nil, afterSeq == 0, nil
+	}
+	return replayFrom(log.events, log.seq, afterSeq)
+}
+
+// logFor returns the user's event log, creating it if needed. b.mu must be held.
+func (b *localBroker) logFor(userID string) *eventLog {
+	log, ok := b.logs[userID]
+	if !ok {
+		log = &eventLog{}
+		b.logs[userID] = log
+	}
+	return log
+}
+
+func (b *localBroker) Connected(userID string) error {
+	b.mu.Lock()
+	b.online[userID] = true
+	b.mu.Unlock()
+	return nil
+}
+
+func (b *localBroker) Disconnected(userID string) error {
+	b.mu.Lock()
+	delete(b.online, userID)
+	b.mu.Unlock()
+	return nil
+}
+
+func (b *localBroker) IsOnline(userID string) (bool, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.online[userID], nil
+}
+
+func (b *localBroker) OnlineUsers() ([]string, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	users := make([]string, 0, len(b.online))
+	for userID := range b.online {
+		users = append(users, userID)
+	}
+	return users, nil
+}
+
+func (b *localBroker) Close() error {
+	return nil
+}
+
+// withSequence adds a sequence number to an event encoded by encodeEvent
+// without one. The number goes last, where encoding it along with the rest
+// would have put it, so the Redis broker can add it the same way in a script.
+func withSequence(data []byte, seq int64) []byte {
+	sequenced := make([]byte, 0, len(data)+24)
+	sequenced = append(sequenced, data[:len(data)-1]...)
+	sequenced = append(sequenced, `,"seq":`...)
+	sequenced = strconv.AppendInt(sequenced, seq, 10)
+	return append(sequenced, '}')
+}
+
+// replayFrom picks the events after afterSeq out of a log ordered by sequence
+// number, where latest is the last sequence number handed out
+func replayFrom(events []SequencedEvent, latest, afterSeq int64) ([]SequencedEvent, bool, error) {
+	if afterSeq > latest {
+		return nil, false, nil
+	}
+	if afterSeq == latest {
+		return nil, true, nil
+	}
+	// Events between afterSeq and the oldest logged one are gone
+	if len(events) == 0 || events[0].Seq > afterSeq+1 {
+		return nil, false, nil
+	}
+
+	var missed []SequencedEvent
+	for _, event := range events {
+		if event.Seq > afterSeq {
+			missed = append(missed, event)
+		}
+	}
+	return missed, true, nil
+}
+
+// NewBrokerFromEnv creates the broker selected by REALTIME_BROKER: "memory"
+// (the default) for a single instance, or "redis" to fan out through the
+// server at REDIS_URL
+func NewBrokerFromEnv() (Broker, error) {
+	switch kind := os.Getenv("REALTIME_BROKER"); kind {
+	case "", "memory":
+		return NewLocalBroker(), nil
+	case "redis":
+		url := os.Getenv("REDIS_URL")
+		if url == "" {
+			return nil, fmt.Errorf("REDIS_URL is not set")
+		}
+		return NewRedisBroker(url)
+	default:
+		return nil, fmt.Errorf("unsupported realtime broker: %s", kind)
+	}
+}
+
+var broker Broker
+
+func init() {
+	useBroker(NewLocalBroker())
+}
+
+// useBroker switches the broker events are published through
+func useBroker(b Broker) {
+	if err := b.Subscribe(deliverLocal); err != nil {
+		fmt.Printf("Error subscribing to realtime broker: %v\n", err)
+	}
+	broker = b
+}
+
+// deliverLocal hands a published event to this instance's connections
+func deliverLocal(userID string, seq int64, data []byte) {
+	if userID == "" {
+		connections.sendToAll(frame{data: data})
+		return
+	}
+	connections.sendToUser(userID, frame{seq: seq, data: data})
+}
@@ -0,0 +1,275 @@
+package socket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"instacloneapp/server/utils"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// redisEventsChannel carries every event between instances
+	redisEventsChannel = "realtime:events"
+
+	// redisOnlineKey is a sorted set of connected users scored by when their
+	// presence expires unless an instance refreshes it
+	redisOnlineKey = "realtime:online"
+
+	// presenceTTL is how long presence outlives an instance that stops
+	// refreshing it, e.g. because it crashed
+	presenceTTL = 90 * time.Second
+
+	// presenceRefresh is how often an instance refreshes its users' presence
+	presenceRefresh = 30 * time.Second
+
+	// replayLogTTL is how long a user's replay log is kept after their last
+	// event, unless REALTIME_REPLAY_TTL overrides it
+	replayLogTTL = 24 * time.Hour
+)
+
+// redisEnvelope is an event as published on the Redis channel
+type redisEnvelope struct {
+	UserID string          `json:"userId,omitempty"`
+	Seq    int64           `json:"seq,omitempty"`
+	Data   json.RawMessage `json:"data"`
+}
+
+// redisBroker fans events out through Redis pub/sub. Presence is kept per
+// user in a sorted set of the instances they're connected to, so a user stays
+// online while any instance holds a connection.
+type redisBroker struct {
+	client     *redis.Client
+	instanceID string
+	ctx        context.Context
+	cancel     context.CancelFunc
+
+	logSize int64
+	logTTL  time.Duration
+
+	mu    sync.Mutex
+	local map[string]bool // users connected to this instance
+}
+
+// NewRedisBroker connects to the Redis server at url, e.g. redis://localhost:6379/0
+func NewRedisBroker(url string) (Broker, error) {
+	options, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+
+	client := redis.NewClient(options)
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := client.Ping(ctx).Err(); err != nil {
+		cancel()
+		client.Close()
+		return nil, fmt.Errorf("connecting to Redis: %v", err)
+	}
+
+	b := &redisBroker{
+		client:     client,
+		instanceID: primitive.NewObjectID().Hex(),
+		ctx:        ctx,
+		cancel:     cancel,
+		logSize:    utils.GetEnvInt64("REALTIME_REPLAY_SIZE", replayLogSize),
+		logTTL:     utils.GetEnvDuration("REALTIME_REPLAY_TTL", replayLogTTL),
+		local:      make(map[string]bool),
+	}
+	go b.refreshPresence()
+	return b, nil
+}
+
+func (b *redisBroker) Publish(userID string, seq int64, data []byte) error {
+	payload, err := json.Marshal(redisEnvelope{UserID: userID, Seq: seq, Data: data})
+	if err != nil {
+		return err
+	}
+	return b.client.Publish(b.ctx, redisEventsChannel, payload).Err()
+}
+
+func (b *redisBroker) PublishAll(data []byte) error {
+	return b.Publish("", 0, data)
+}
+
+func (b *redisBroker) Subscribe(deliver func(userID string, seq int64, data []byte)) error {
+	pubsub := b.client.Subscribe(b.ctx, redisEventsChannel)
+	// Wait for the subscription so nothing published afterwards is missed
+	if _, err := pubsub.Receive(b.ctx); err != nil {
+		pubsub.Close()
+		return err
+	}
+
+	go func() {
+		defer pubsub.Close()
+		for msg := range pubsub.Channel() {
+			var envelope redisEnvelope
+			if err := json.Unmarshal([]byte(msg.Payload), &envelope); err != nil {
+				fmt.Printf("Ignoring malformed realtime event: %v\n", err)
+				continue
+			}
+			deliver(envelope.UserID, envelope.Seq, envelope.Data)
+		}
+	}()
+	return nil
+}
+
+// publishSequencedScript sequences, logs and publishes an event in one atomic
+// step. It adds the sequence number to the event the way withSequence does and
+// wraps it in a redisEnvelope.
+//
+// KEYS: sequence key, log key. ARGV: user ID, event, log size, log TTL in seconds.
+var publishSequencedScript = redis.NewScript(`
+local seq = redis.call("INCR", KEYS[1])
+local data = string.sub(ARGV[2], 1, -2) .. ',"seq":' .. seq .. '}'
+redis.call("ZADD", KEYS[2], seq, data)
+redis.call("ZREMRANGEBYRANK", KEYS[2], 0, -tonumber(ARGV[3]) - 1)
+redis.call("EXPIRE", KEYS[2], ARGV[4])
+redis.call("PUBLISH", "` + redisEventsChannel + `",
+	'{"userId":' .. cjson.encode(ARGV[1]) .. ',"seq":' .. seq .. ',"data":' .. data .. '}')
+return seq
+`)
+
+func (b *redisBroker) PublishSequenced(userID string, data []byte) (int64, error) {
+	keys := []string{sequenceKey(userID), logKey(userID)}
+	return publishSequencedScript.Run(b.ctx, b.client, keys,
+		userID, data, b.logSize, int64(b.logTTL/time.Second)).Int64()
+}
+
+func (b *redisBroker) Replay(userID string, afterSeq int64) ([]SequencedEvent, bool, error) {
+	// Read the counter and the log together so they agree with each other
+	pipe := b.client.TxPipeline()
+	latestCmd := pipe.Get(b.ctx, sequenceKey(userID))
+	entriesCmd := pipe.ZRangeByScoreWithScores(b.ctx, logKey(userID), &redis.ZRangeBy{
+		Min: "-inf",
+		Max: "+inf",
+	})
+	if _, err := pipe.Exec(b.ctx); err != nil && err != redis.Nil {
+		return nil, false, err
+	}
+
+	latest, err := latestCmd.Int64()
+	if err == redis.Nil {
+		return nil, afterSeq == 0, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	entries, err := entriesCmd.Result()
+	if err != nil {
+		return nil, false, err
+	}
+
+	events := make([]SequencedEvent, 0, len(entries))
+	for _, entry := range entries {
+		data, _ := entry.Member.(string)
+		events = append(events, SequencedEvent{Seq: int64(entry.Score), Data: []byte(data)})
+	}
+	return replayFrom(events, latest, afterSeq)
+}
+
+func (b *redisBroker) Connected(userID string) error {
+	b.mu.Lock()
+	b.local[userID] = true
+	b.mu.Unlock()
+
+	expires := float64(time.Now().Add(presenceTTL).Unix())
+	pipe := b.client.TxPipeline()
+	pipe.ZAdd(b.ctx, presenceKey(userID), redis.Z{Score: expires, Member: b.instanceID})
+	pipe.Expire(b.ctx, presenceKey(userID), presenceTTL)
+	pipe.ZAdd(b.ctx, redisOnlineKey, redis.Z{Score: expires, Member: userID})
+	_, err := pipe.Exec(b.ctx)
+	return err
+}
+
+func (b *redisBroker) Disconnected(userID string) error {
+	b.mu.Lock()
+	delete(b.local, userID)
+	b.mu.Unlock()
+
+	key := presenceKey(userID)
+	if err := b.client.ZRem(b.ctx, key, b.instanceID).Err(); err != nil {
+		return err
+	}
+
+	// Drop the user from the online set unless another instance still holds them
+	online, err := b.IsOnline(userID)
+	if err != nil || online {
+		return err
+	}
+	return b.client.ZRem(b.ctx, redisOnlineKey, userID).Err()
+}
+
+func (b *redisBroker) IsOnline(userID string) (bool, error) {
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	count, err := b.client.ZCount(b.ctx, presenceKey(userID), now, "+inf").Result()
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (b *redisBroker) OnlineUsers() ([]string, error) {
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	return b.client.ZRangeByScore(b.ctx, redisOnlineKey, &redis.ZRangeBy{Min: now, Max: "+inf"}).Result()
+}
+
+func (b *redisBroker) Close() error {
+	b.cancel()
+	return b.client.Close()
+}
+
+// refreshPresence keeps the presence of this instance's users from expiring
+// and clears entries left behind by instances that went away
+func (b *redisBroker) refreshPresence() {
+	ticker := time.NewTicker(presenceRefresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		b.mu.Lock()
+		users := make([]string, 0, len(b.local))
+		for userID := range b.local {
+			users = append(users, userID)
+		}
+		b.mu.Unlock()
+
+		now := time.Now()
+		expires := float64(now.Add(presenceTTL).Unix())
+		pipe := b.client.Pipeline()
+		for _, userID := range users {
+			pipe.ZAdd(b.ctx, presenceKey(userID), redis.Z{Score: expires, Member: b.instanceID})
+			pipe.Expire(b.ctx, presenceKey(userID), presenceTTL)
+			pipe.ZAdd(b.ctx, redisOnlineKey, redis.Z{Score: expires, Member: userID})
+		}
+		pipe.ZRemRangeByScore(b.ctx, redisOnlineKey, "-inf", strconv.FormatInt(now.Unix(), 10))
+		if _, err := pipe.Exec(b.ctx); err != nil && b.ctx.Err() == nil {
+			fmt.Printf("Error refreshing presence: %v\n", err)
+		}
+	}
+}
+
+// sequenceKey holds the last sequence number handed out to a user
+func sequenceKey(userID string) string {
+	return "realtime:seq:" + userID
+}
+
+// logKey is the sorted set of a user's recent events scored by sequence number
+func logKey(userID string) string {
+	return "realtime:log:" + userID
+}
+
+// presenceKey is the sorted set of instances a user is connected to
+func presenceKey(userID string) string {
+	return "realtime:presence:" + userID
+}
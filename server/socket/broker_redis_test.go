@@ -0,0 +1,226 @@
+package socket
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// These tests run against the Redis server at REDIS_URL and are skipped when
+// it isn't set, e.g. REDIS_URL=redis://localhost:6379/15 go test ./server/socket
+
+type publishedEvent struct {
+	userID string
+	seq    int64
+	data   string
+}
+
+// newTestRedisBroker connects a broker as if it were another server instance
+func newTestRedisBroker(t *testing.T) *redisBroker {
+	t.Helper()
+	url := os.Getenv("REDIS_URL")
+	if url == "" {
+		t.Skip("REDIS_URL is not set")
+	}
+
+	b, err := NewRedisBroker(url)
+	if err != nil {
+		t.Fatalf("connecting to Redis: %v", err)
+	}
+	t.Cleanup(func() { b.Close() })
+	return b.(*redisBroker)
+}
+
+// newTestUser returns a user ID no other test run uses, and removes its keys afterwards
+func newTestUser(t *testing.T, b *redisBroker) string {
+	userID := primitive.NewObjectID().Hex()
+	t.Cleanup(func() {
+		b.client.Del(b.ctx, sequenceKey(userID), logKey(userID), presenceKey(userID))
+		b.client.ZRem(b.ctx, redisOnlineKey, userID)
+	})
+	return userID
+}
+
+// subscribe collects the events a broker receives for the user
+func subscribe(t *testing.T, b *redisBroker, userID string) <-chan publishedEvent {
+	t.Helper()
+	events := make(chan publishedEvent, 16)
+	err := b.Subscribe(func(to string, seq int64, data []byte) {
+		if to == userID {
+			events <- publishedEvent{userID: to, seq: seq, data: string(data)}
+		}
+	})
+	if err != nil {
+		t.Fatalf("subscribing: %v", err)
+	}
+	return events
+}
+
+func receive(t *testing.T, events <-chan publishedEvent) publishedEvent {
+	t.Helper()
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the event")
+		return publishedEvent{}
+	}
+}
+
+func encodeTestEvent(t *testing.T, message string) []byte {
+	t.Helper()
+	data, err := encodeEvent("newMessage", message, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestRedisBrokerPublishesAcrossInstances(t *testing.T) {
+	sender, receiver := newTestRedisBroker(t), newTestRedisBroker(t)
+	userID := newTestUser(t, sender)
+	events := subscribe(t, receiver, userID)
+
+	data := encodeTestEvent(t, "typing")
+	if err := sender.Publish(userID, 0, data); err != nil {
+		t.Fatalf("publishing: %v", err)
+	}
+	if event := receive(t, events); event.seq != 0 || event.data != string(data) {
+		t.Errorf("received %+v, want the unsequenced event %s", event, data)
+	}
+
+	for want := int64(1); want <= 2; want++ {
+		seq, err := sender.PublishSequenced(userID, encodeTestEvent(t, "hello"))
+		if err != nil {
+			t.Fatalf("publishing sequenced event: %v", err)
+		}
+		if seq != want {
+			t.Errorf("got sequence number %d, want %d", seq, want)
+		}
+
+		event := receive(t, events)
+		expected, _ := encodeEvent("newMessage", "hello", want)
+		if event.seq != want || event.data != string(expected) {
+			t.Errorf("received %+v, want sequence %d with %s", event, want, expected)
+		}
+	}
+}
+
+func TestRedisBrokerCountsPresenceAcrossInstances(t *testing.T) {
+	first, second := newTestRedisBroker(t), newTestRedisBroker(t)
+	userID := newTestUser(t, first)
+
+	assertOnline := func(b *redisBroker, want bool) {
+		t.Helper()
+		online, err := b.IsOnline(userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if online != want {
+			t.Errorf("IsOnline = %v, want %v", online, want)
+		}
+		users, err := b.OnlineUsers()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if listed := containsUser(users, userID); listed != want {
+			t.Errorf("listed in OnlineUsers = %v, want %v", listed, want)
+		}
+	}
+
+	assertOnline(first, false)
+	if err := first.Connected(userID); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.Connected(userID); err != nil {
+		t.Fatal(err)
+	}
+	assertOnline(second, true)
+
+	// Still connected to the second instance
+	if err := first.Disconnected(userID); err != nil {
+		t.Fatal(err)
+	}
+	assertOnline(first, true)
+
+	if err := second.Disconnected(userID); err != nil {
+		t.Fatal(err)
+	}
+	assertOnline(first, false)
+}
+
+func TestRedisBrokerReplaysMissedEvents(t *testing.T) {
+	b := newTestRedisBroker(t)
+	b.logSize = 3
+	userID := newTestUser(t, b)
+
+	if _, ok, err := b.Replay(userID, 0); err != nil || !ok {
+		t.Fatalf("Replay before any event = ok %v, err %v; want ok", ok, err)
+	}
+
+	for i := 0; i < 4; i++ {
+		if _, err := b.PublishSequenced(userID, encodeTestEvent(t, "hello")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		afterSeq int64
+		ok       bool
+		want     []int64
+	}{
+		{afterSeq: 1, ok: true, want: []int64{2, 3, 4}},
+		{afterSeq: 3, ok: true, want: []int64{4}},
+		{afterSeq: 4, ok: true, want: nil},
+		// The first event dropped out of the log
+		{afterSeq: 0, ok: false},
+		// The client is ahead of the server
+		{afterSeq: 9, ok: false},
+	}
+	for _, tt := range tests {
+		events, ok, err := b.Replay(userID, tt.afterSeq)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != tt.ok {
+			t.Errorf("Replay(%d) ok = %v, want %v", tt.afterSeq, ok, tt.ok)
+			continue
+		}
+
+		var got []int64
+		for _, event := range events {
+			got = append(got, event.Seq)
+			if !strings.HasSuffix(string(event.Data), `"seq":`+strconv.FormatInt(event.Seq, 10)+`}`) {
+				t.Errorf("logged event %s doesn't carry its sequence number", event.Data)
+			}
+		}
+		if !equalSeqs(got, tt.want) {
+			t.Errorf("Replay(%d) = %v, want %v", tt.afterSeq, got, tt.want)
+		}
+	}
+}
+
+func containsUser(users []string, userID string) bool {
+	for _, user := range users {
+		if user == userID {
+			return true
+		}
+	}
+	return false
+}
+
+func equalSeqs(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
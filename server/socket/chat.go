@@ -1,104 +1,196 @@
 package socket
 
 import (
+	"encoding/json"
 	"fmt"
+	"instacloneapp/server/middleware"
+	"instacloneapp/server/utils"
 	"net/http"
-	"sync"
+	"os"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 )
 
 var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		return true
-	},
+	CheckOrigin: checkOrigin,
 }
 
-var userSocketMap = make(map[string]*websocket.Conn) // Stores WebSocket connections corresponding to user IDs
-var mu sync.Mutex                                    // Mutex for synchronizing access to userSocketMap
+// checkOrigin accepts upgrades from the origins listed in WS_ALLOWED_ORIGINS,
+// defaulting to the frontend URL the CORS policy allows. "*" allows any origin.
+// Requests without an Origin header don't come from a browser and are still
+// authenticated like any other.
+func checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
 
-// GetReceiverSocketID retrieves the WebSocket ID for a given user ID
-func GetReceiverSocketID(userID string) string {
-	mu.Lock()
-	defer mu.Unlock()
-	conn, ok := userSocketMap[userID]
-	if ok {
-		return conn.RemoteAddr().String() // This might not be an ideal unique identifier
+	for _, allowed := range utils.GetEnvList("WS_ALLOWED_ORIGINS", []string{os.Getenv("URL")}) {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
 	}
-	return ""
+	return false
+}
+
+// IsOnline reports whether the user has at least one open connection on any instance
+func IsOnline(userID string) bool {
+	online, err := broker.IsOnline(userID)
+	if err != nil {
+		fmt.Printf("Error checking presence of %s: %v\n", userID, err)
+		return connections.isOnline(userID)
+	}
+	return online
+}
+
+// EventResync tells a resuming client that the events it missed are no longer
+// available and it has to reload its state
+const EventResync = "resync"
+
+// ephemeralEvents only matter while they happen, so they aren't sequenced or
+// replayed to clients that reconnect later
+var ephemeralEvents = map[string]bool{
+	"typing":   true,
+	"presence": true,
 }
 
-// BroadcastMessageToUser sends a message to a specific user
+// BroadcastMessageToUser sends a message to every connection of a specific
+// user, whichever instance they're connected to. Events other than ephemeral
+// ones get the user's next sequence number and are kept for replay.
 func BroadcastMessageToUser(userID, event string, message interface{}) {
-	mu.Lock()
-	defer mu.Unlock()
-	conn, ok := userSocketMap[userID]
-	if ok {
-		err := conn.WriteJSON(map[string]interface{}{
-			"event":   event,
-			"message": message,
-		})
-		if err != nil {
-			fmt.Printf("Error writing message to user %s: %v\n", userID, err)
-			conn.Close()
-			delete(userSocketMap, userID)
+	data, err := encodeEvent(event, message, 0)
+	if err != nil {
+		fmt.Printf("Error encoding %s event for user %s: %v\n", event, userID, err)
+		return
+	}
+
+	if !ephemeralEvents[event] {
+		if _, err := broker.PublishSequenced(userID, data); err != nil {
+			fmt.Printf("Error publishing %s event for user %s: %v\n", event, userID, err)
 		}
+		return
+	}
+	if err := broker.Publish(userID, 0, data); err != nil {
+		fmt.Printf("Error publishing %s event for user %s: %v\n", event, userID, err)
 	}
 }
 
-// HandleConnection handles WebSocket connections
+// HandleConnection handles WebSocket connections. The user is identified by
+// the session cookie or a socket ticket, never by the client's word. A client
+// reconnecting with the "lastSeq" query parameter first receives the events it
+// missed, or a resync event when they're gone.
 func HandleConnection(c *gin.Context) {
+	userID, lastSeq, resuming, ok := authenticateStream(c, c.Query("lastSeq"))
+	if !ok {
+		return
+	}
+
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upgrade connection"})
+		// The upgrader has already written the error response
+		fmt.Printf("Error upgrading connection for %s: %v\n", userID, err)
 		return
 	}
-	defer conn.Close()
 
-	userID := c.Query("userId")
-	if userID != "" {
-		mu.Lock()
-		userSocketMap[userID] = conn
-		mu.Unlock()
+	client := newClient(userID, conn)
+	go client.writePump()
+	connect(client, resuming, lastSeq)
+	client.readPump()
+	disconnect(client)
+}
+
+// authenticateStream identifies the user opening a websocket or event stream
+// and parses the sequence number they want to resume after, if any. It writes
+// the error response itself and returns false when the request should stop.
+func authenticateStream(c *gin.Context, lastSeqParam string) (userID string, lastSeq int64, resuming bool, ok bool) {
+	userID, err := middleware.AuthenticateSocket(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"message": "User not authenticated or invalid token",
+			"success": false,
+		})
+		return "", 0, false, false
 	}
 
-	// Broadcast online users
-	broadcastOnlineUsers()
+	if lastSeqParam == "" {
+		return userID, 0, false, true
+	}
+	lastSeq, err = strconv.ParseInt(lastSeqParam, 10, 64)
+	if err != nil || lastSeq < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid lastSeq"})
+		return "", 0, false, false
+	}
+	return userID, lastSeq, true, true
+}
 
-	for {
-		messageType, msg, err := conn.ReadMessage()
-		if err != nil {
-			fmt.Printf("Error reading message: %v\n", err)
-			break
-		}
-		if messageType == websocket.TextMessage {
-			fmt.Printf("Received message from %s: %s\n", userID, msg)
+// connect registers a client whose writer is running, replays what it missed
+// when resuming and announces the user if they just came online
+func connect(client *client, resuming bool, lastSeq int64) {
+	client.replaying = resuming
+	wasOnline := IsOnline(client.userID)
+	if connections.register(client) {
+		if err := broker.Connected(client.userID); err != nil {
+			fmt.Printf("Error recording presence of %s: %v\n", client.userID, err)
 		}
 	}
+	if resuming {
+		client.resume(lastSeq)
+	}
 
-	// Clean up on disconnect
-	mu.Lock()
-	delete(userSocketMap, userID)
-	mu.Unlock()
-	broadcastOnlineUsers()
+	if wasOnline {
+		sendOnlineContacts(client.userID)
+		return
+	}
+	broadcastOnlineUsers(client.userID)
+	userOnline(client.userID)
 }
 
-// broadcastOnlineUsers broadcasts the list of online users to all connected clients
-func broadcastOnlineUsers() {
-	mu.Lock()
-	defer mu.Unlock()
+// disconnect cleans up after a client goes away. Presence and typing only
+// change once the user's last tab or device on any instance is gone.
+func disconnect(client *client) {
+	client.close()
+	if connections.unregister(client) {
+		if err := broker.Disconnected(client.userID); err != nil {
+			fmt.Printf("Error recording presence of %s: %v\n", client.userID, err)
+		}
+	}
+	if !IsOnline(client.userID) {
+		broadcastOnlineUsers(client.userID)
+		clearTypingForUser(client.userID)
+		userOffline(client.userID)
+	}
+}
 
-	onlineUsers := make([]string, 0, len(userSocketMap))
-	for userID := range userSocketMap {
-		onlineUsers = append(onlineUsers, userID)
+// broadcastOnlineUsers refreshes the online users list of a user who came
+// online or went offline and of their contacts who are online
+func broadcastOnlineUsers(userID string) {
+	sendOnlineContacts(userID)
+	for _, contact := range presenceContacts(userID) {
+		if IsOnline(contact) {
+			sendOnlineContacts(contact)
+		}
 	}
+}
 
-	for userID, conn := range userSocketMap {
-		err := conn.WriteJSON(onlineUsers)
-		if err != nil {
-			fmt.Printf("Error broadcasting online users to %s: %v\n", userID, err)
-			conn.Close()
+// sendOnlineContacts sends a user the list of online users. Like presence
+// events, it only covers people they share an accepted conversation with.
+func sendOnlineContacts(userID string) {
+	online := []string{}
+	for _, contact := range presenceContacts(userID) {
+		if IsOnline(contact) {
+			online = append(online, contact)
 		}
 	}
+
+	data, err := json.Marshal(online)
+	if err != nil {
+		fmt.Printf("Error encoding online users: %v\n", err)
+		return
+	}
+	if err := broker.Publish(userID, 0, data); err != nil {
+		fmt.Printf("Error publishing online users: %v\n", err)
+	}
 }
@@ -0,0 +1,89 @@
+package socket
+
+import (
+	"encoding/json"
+	"fmt"
+	"instacloneapp/server/pkg/db"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Client-to-server event types accepted on the websocket connection
+const (
+	EventTypingStart = "typing.start"
+	EventTypingStop  = "typing.stop"
+)
+
+// ClientEvent is a frame sent by a client over the websocket connection
+type ClientEvent struct {
+	Type           string `json:"type"`
+	ConversationID string `json:"conversationId,omitempty"`
+}
+
+var dbInstance db.Database
+
+// Init gives the socket package access to the database, which it needs to
+// check conversation membership and persist presence, and to the broker
+// events are fanned out through
+func Init(database db.Database, b Broker) {
+	dbInstance = database
+	if b != nil {
+		useBroker(b)
+	}
+}
+
+// handleClientEvent decodes and dispatches a frame received from a user
+func handleClientEvent(userID string, raw []byte) {
+	var event ClientEvent
+	if err := json.Unmarshal(raw, &event); err != nil {
+		fmt.Printf("Ignoring malformed event from %s: %v\n", userID, err)
+		return
+	}
+
+	switch event.Type {
+	case EventTypingStart, EventTypingStop:
+		conversation, err := conversationForMember(event.ConversationID, userID)
+		if err != nil {
+			fmt.Printf("Ignoring %s from %s: %v\n", event.Type, userID, err)
+			return
+		}
+		// Typing in a request the user hasn't accepted would tell the sender they're reading it
+		if memberID, _ := primitive.ObjectIDFromHex(userID); conversation.IsPendingFor(memberID) {
+			return
+		}
+		if event.Type == EventTypingStart {
+			startTyping(conversation, userID)
+		} else {
+			stopTyping(conversation, userID)
+		}
+	default:
+		fmt.Printf("Ignoring unknown event type %q from %s\n", event.Type, userID)
+	}
+}
+
+// conversationForMember loads a conversation and checks the user takes part in it
+func conversationForMember(conversationID, userID string) (*db.Conversation, error) {
+	if dbInstance == nil {
+		return nil, fmt.Errorf("socket database not initialized")
+	}
+
+	id, err := primitive.ObjectIDFromHex(conversationID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid conversation ID")
+	}
+	memberID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID")
+	}
+
+	conversation, err := dbInstance.GetConversationByID(id)
+	if err != nil {
+		return nil, err
+	}
+	for _, participant := range conversation.Participants {
+		if participant == memberID {
+			return conversation, nil
+		}
+	}
+	return nil, fmt.Errorf("not a participant")
+}
@@ -0,0 +1,319 @@
+package socket
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// writeWait is how long a single write to a client may take
+	writeWait = 10 * time.Second
+
+	// pongWait is how long a client may stay silent before it's considered gone
+	pongWait = 60 * time.Second
+
+	// pingPeriod must be shorter than pongWait so pongs arrive in time
+	pingPeriod = pongWait * 9 / 10
+
+	// maxMessageSize caps frames sent by clients, which only carry small events
+	maxMessageSize = 4096
+
+	// sendBufferSize is how many outgoing frames a client may fall behind by
+	// before it's evicted as a slow consumer
+	sendBufferSize = 64
+)
+
+// frame is an encoded event queued for a client. seq is 0 for events that
+// aren't sequenced.
+type frame struct {
+	seq  int64
+	data []byte
+}
+
+// client is one websocket connection. A user has a client per open tab or device.
+type client struct {
+	userID    string
+	conn      *websocket.Conn
+	send      chan frame
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	// While missed events are being replayed, live events wait in backlog so
+	// they can't overtake the replay
+	mu        sync.Mutex
+	replaying bool
+	backlog   []frame
+}
+
+// hub tracks the connected clients of every user
+type hub struct {
+	mu      sync.RWMutex
+	clients map[string]map[*client]struct{}
+}
+
+var connections = &hub{clients: make(map[string]map[*client]struct{})}
+
+func newClient(userID string, conn *websocket.Conn) *client {
+	return &client{
+		userID: userID,
+		conn:   conn,
+		send:   make(chan frame, sendBufferSize),
+		closed: make(chan struct{}),
+	}
+}
+
+// register adds a client and reports whether it's the user's first connection
+func (h *hub) register(c *client) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	userClients, ok := h.clients[c.userID]
+	if !ok {
+		userClients = make(map[*client]struct{})
+		h.clients[c.userID] = userClients
+	}
+	userClients[c] = struct{}{}
+	return len(userClients) == 1
+}
+
+// unregister removes a client and reports whether it was the user's last connection
+func (h *hub) unregister(c *client) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	userClients, ok := h.clients[c.userID]
+	if !ok {
+		return false
+	}
+	if _, registered := userClients[c]; !registered {
+		return false
+	}
+	delete(userClients, c)
+	if len(userClients) == 0 {
+		delete(h.clients, c.userID)
+		return true
+	}
+	return false
+}
+
+// sendToUser queues a frame on every connection of the user
+func (h *hub) sendToUser(userID string, f frame) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for c := range h.clients[userID] {
+		c.enqueue(f)
+	}
+}
+
+// sendToAll queues a frame on every connection
+func (h *hub) sendToAll(f frame) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for _, userClients := range h.clients {
+		for c := range userClients {
+			c.enqueue(f)
+		}
+	}
+}
+
+// isOnline reports whether the user has at least one connection
+func (h *hub) isOnline(userID string) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.clients[userID]) > 0
+}
+
+// onlineUsers lists every connected user
+func (h *hub) onlineUsers() []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	users := make([]string, 0, len(h.clients))
+	for userID := range h.clients {
+		users = append(users, userID)
+	}
+	return users
+}
+
+// enqueue queues a live frame, holding it back while a replay is in progress
+func (c *client) enqueue(f frame) {
+	c.mu.Lock()
+	if c.replaying {
+		if len(c.backlog) >= sendBufferSize {
+			c.mu.Unlock()
+			c.evict()
+			return
+		}
+		c.backlog = append(c.backlog, f)
+		c.mu.Unlock()
+		return
+	}
+	c.mu.Unlock()
+
+	c.push(f)
+}
+
+// push queues a frame without blocking. A client whose buffer is full is
+// evicted rather than allowed to hold up everyone else.
+func (c *client) push(f frame) {
+	select {
+	case <-c.closed:
+	case c.send <- f:
+	default:
+		c.evict()
+	}
+}
+
+// evict drops a client that can't keep up
+func (c *client) evict() {
+	fmt.Printf("Evicting slow client of user %s\n", c.userID)
+	c.close()
+}
+
+// resume replays the events the client missed after lastSeq, or tells it to
+// resync when they're no longer available, then releases the live events
+// held back in the meantime. The client must have been created with
+// replaying set so nothing slips through before the replay, and its writer
+// must be running since a replay can be longer than the send queue.
+func (c *client) resume(lastSeq int64) {
+	events, ok, err := broker.Replay(c.userID, lastSeq)
+	if err != nil {
+		fmt.Printf("Error replaying events for %s: %v\n", c.userID, err)
+		ok = false
+	}
+
+	replayed := lastSeq
+	if ok {
+		for _, event := range events {
+			if !c.pushWait(frame{seq: event.Seq, data: event.Data}) {
+				return
+			}
+			replayed = event.Seq
+		}
+	} else if data, err := encodeEvent(EventResync, map[string]string{"reason": "missed events are no longer available"}, 0); err == nil {
+		if !c.pushWait(frame{data: data}) {
+			return
+		}
+	}
+
+	for {
+		c.mu.Lock()
+		backlog := c.backlog
+		c.backlog = nil
+		if len(backlog) == 0 {
+			c.replaying = false
+			c.mu.Unlock()
+			return
+		}
+		c.mu.Unlock()
+
+		for _, f := range backlog {
+			// Live events already covered by the replay would arrive twice
+			if ok && f.seq != 0 && f.seq <= replayed {
+				continue
+			}
+			if !c.pushWait(f) {
+				return
+			}
+		}
+	}
+}
+
+// pushWait queues a frame, waiting up to writeWait for room. It reports
+// false if the client is gone or was evicted for not keeping up.
+func (c *client) pushWait(f frame) bool {
+	timer := time.NewTimer(writeWait)
+	defer timer.Stop()
+
+	select {
+	case <-c.closed:
+		return false
+	case c.send <- f:
+		return true
+	case <-timer.C:
+		c.evict()
+		return false
+	}
+}
+
+// close stops the client's writer, which closes the connection. For a
+// websocket the read pump then fails and unregisters the client.
+func (c *client) close() {
+	c.closeOnce.Do(func() { close(c.closed) })
+}
+
+// writePump is the only goroutine that writes to the connection. It drains
+// the send queue and pings the client to keep the connection alive.
+func (c *client) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case f := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.TextMessage, f.data); err != nil {
+				fmt.Printf("Error writing message to user %s: %v\n", c.userID, err)
+				c.close()
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				c.close()
+				return
+			}
+		case <-c.closed:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, ""))
+			return
+		}
+	}
+}
+
+// readPump reads frames from the client until the connection fails or the
+// client stops answering pings
+func (c *client) readPump() {
+	defer c.close()
+
+	c.conn.SetReadLimit(maxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		messageType, msg, err := c.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				fmt.Printf("Error reading message: %v\n", err)
+			}
+			return
+		}
+		if messageType == websocket.TextMessage {
+			handleClientEvent(c.userID, msg)
+		}
+	}
+}
+
+// encodeEvent builds the frame sent to clients for an event. Sequenced
+// events carry their sequence number so clients can resume after it.
+func encodeEvent(event string, message interface{}, seq int64) ([]byte, error) {
+	envelope := map[string]interface{}{
+		"event":   event,
+		"message": message,
+	}
+	if seq != 0 {
+		envelope["seq"] = seq
+	}
+	return json.Marshal(envelope)
+}
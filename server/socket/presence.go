@@ -0,0 +1,79 @@
+package socket
+
+import (
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// userOnline announces that a user connected
+func userOnline(userID string) {
+	broadcastPresence(map[string]interface{}{
+		"userId": userID,
+		"online": true,
+	})
+}
+
+// userOffline persists the user's last-seen time and announces that they left
+func userOffline(userID string) {
+	lastSeen := time.Now()
+	persistLastSeen(userID, lastSeen)
+
+	broadcastPresence(map[string]interface{}{
+		"userId":   userID,
+		"online":   false,
+		"lastSeen": lastSeen,
+	})
+}
+
+// persistLastSeen stores when the user was last connected
+func persistLastSeen(userID string, lastSeen time.Time) {
+	if dbInstance == nil {
+		return
+	}
+
+	id, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return
+	}
+	if err := dbInstance.UpdateUser(id, bson.M{"$set": bson.M{"lastSeen": lastSeen}}); err != nil {
+		fmt.Printf("Error saving last seen for %s: %v\n", userID, err)
+	}
+}
+
+// broadcastPresence sends a presence event to the connected users its subject
+// shares an accepted conversation with, so pending message requests don't
+// reveal whether the recipient is around
+func broadcastPresence(presence map[string]interface{}) {
+	userID, _ := presence["userId"].(string)
+	contacts := presenceContacts(userID)
+
+	for _, contact := range contacts {
+		BroadcastMessageToUser(contact, "presence", presence)
+	}
+}
+
+// presenceContacts lists the users allowed to see the user's presence
+func presenceContacts(userID string) []string {
+	if dbInstance == nil {
+		return nil
+	}
+
+	id, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil
+	}
+	contacts, err := dbInstance.GetConversationContacts(id)
+	if err != nil {
+		fmt.Printf("Error loading contacts of %s: %v\n", userID, err)
+		return nil
+	}
+
+	ids := make([]string, 0, len(contacts))
+	for _, contact := range contacts {
+		ids = append(ids, contact.Hex())
+	}
+	return ids
+}
@@ -0,0 +1,96 @@
+package socket
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sseHeartbeat is how often an idle event stream gets a comment line, which
+// keeps proxies from timing the connection out
+const sseHeartbeat = 15 * time.Second
+
+// sseRetry is the reconnect delay suggested to EventSource clients
+const sseRetry = 3 * time.Second
+
+// HandleEvents streams the same events as the websocket over Server-Sent
+// Events, for networks that block websocket upgrades. Authentication is the
+// same as for the websocket. Sequenced events carry their sequence number as
+// the event ID, so a reconnecting EventSource resumes through Last-Event-ID;
+// the "lastEventId" query parameter does the same for clients that can't set
+// the header.
+func HandleEvents(c *gin.Context) {
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("lastEventId")
+	}
+
+	userID, lastSeq, resuming, ok := authenticateStream(c, lastEventID)
+	if !ok {
+		return
+	}
+
+	flusher, ok := c.Writer.(http.Flusher)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Streaming unsupported"})
+		return
+	}
+
+	header := c.Writer.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	fmt.Fprintf(c.Writer, "retry: %d\n\n", sseRetry.Milliseconds())
+	flusher.Flush()
+
+	client := newClient(userID, nil)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		client.streamEvents(c.Writer, flusher)
+	}()
+
+	connect(client, resuming, lastSeq)
+
+	select {
+	case <-c.Request.Context().Done():
+	case <-client.closed:
+	}
+	disconnect(client)
+	<-done
+}
+
+// streamEvents is the event stream counterpart of writePump: it writes queued
+// frames as SSE messages until the client is closed or a write fails
+func (c *client) streamEvents(w http.ResponseWriter, flusher http.Flusher) {
+	ticker := time.NewTicker(sseHeartbeat)
+	defer ticker.Stop()
+
+	for {
+		var err error
+		select {
+		case f := <-c.send:
+			if f.seq != 0 {
+				_, err = fmt.Fprintf(w, "id: %d\n", f.seq)
+			}
+			if err == nil {
+				_, err = fmt.Fprintf(w, "data: %s\n\n", f.data)
+			}
+		case <-ticker.C:
+			_, err = fmt.Fprint(w, ": heartbeat\n\n")
+		case <-c.closed:
+			return
+		}
+
+		if err != nil {
+			fmt.Printf("Error streaming events to user %s: %v\n", c.userID, err)
+			c.close()
+			return
+		}
+		flusher.Flush()
+	}
+}
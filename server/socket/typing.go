@@ -0,0 +1,124 @@
+package socket
+
+import (
+	"instacloneapp/server/pkg/db"
+	"sync"
+	"time"
+)
+
+// TypingTimeout is how long a typing indicator lasts without being refreshed
+// by another typing.start from the client
+const TypingTimeout = 6 * time.Second
+
+type typingKey struct {
+	conversationID string
+	userID         string
+}
+
+type typingState struct {
+	timer        *time.Timer
+	participants []string
+}
+
+var (
+	typingStates = make(map[typingKey]*typingState)
+	typingMu     sync.Mutex
+)
+
+// startTyping relays a typing indicator to the other participants and arms the
+// timer that clears it if the client goes quiet
+func startTyping(conversation *db.Conversation, userID string) {
+	key := typingKey{conversationID: conversation.ID.Hex(), userID: userID}
+	participants := participantIDs(conversation)
+
+	typingMu.Lock()
+	state, exists := typingStates[key]
+	if exists {
+		state.timer.Reset(TypingTimeout)
+		state.participants = participants
+	} else {
+		typingStates[key] = &typingState{
+			participants: participants,
+			timer:        time.AfterFunc(TypingTimeout, func() { expireTyping(key) }),
+		}
+	}
+	typingMu.Unlock()
+
+	// Refreshes don't need to be relayed again
+	if !exists {
+		relayTyping(key, participants, true)
+	}
+}
+
+// stopTyping clears a typing indicator on request from the client
+func stopTyping(conversation *db.Conversation, userID string) {
+	key := typingKey{conversationID: conversation.ID.Hex(), userID: userID}
+
+	typingMu.Lock()
+	state, exists := typingStates[key]
+	if exists {
+		state.timer.Stop()
+		delete(typingStates, key)
+	}
+	typingMu.Unlock()
+
+	if exists {
+		relayTyping(key, state.participants, false)
+	}
+}
+
+// expireTyping clears a typing indicator that wasn't refreshed in time
+func expireTyping(key typingKey) {
+	typingMu.Lock()
+	state, exists := typingStates[key]
+	if exists {
+		delete(typingStates, key)
+	}
+	typingMu.Unlock()
+
+	if exists {
+		relayTyping(key, state.participants, false)
+	}
+}
+
+// clearTypingForUser stops every typing indicator of a user who disconnected
+func clearTypingForUser(userID string) {
+	typingMu.Lock()
+	var cleared []typingKey
+	var states []*typingState
+	for key, state := range typingStates {
+		if key.userID == userID {
+			state.timer.Stop()
+			delete(typingStates, key)
+			cleared = append(cleared, key)
+			states = append(states, state)
+		}
+	}
+	typingMu.Unlock()
+
+	for i, key := range cleared {
+		relayTyping(key, states[i].participants, false)
+	}
+}
+
+// relayTyping sends the typing event to everyone in the conversation except the typist
+func relayTyping(key typingKey, participants []string, typing bool) {
+	payload := map[string]interface{}{
+		"conversationId": key.conversationID,
+		"userId":         key.userID,
+		"typing":         typing,
+	}
+	for _, participant := range participants {
+		if participant != key.userID {
+			BroadcastMessageToUser(participant, "typing", payload)
+		}
+	}
+}
+
+func participantIDs(conversation *db.Conversation) []string {
+	ids := make([]string, 0, len(conversation.Participants))
+	for _, participant := range conversation.Participants {
+		ids = append(ids, participant.Hex())
+	}
+	return ids
+}
@@ -8,6 +8,9 @@ import (
 	"log"
 	"mime/multipart"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/cloudinary/cloudinary-go"
 	"github.com/cloudinary/cloudinary-go/api/uploader"
@@ -55,3 +58,69 @@ func UploadImageToCloudinary(cloudinaryClient *cloudinary.Cloudinary, image mult
 	// Return the secure URL from Cloudinary
 	return resp.SecureURL, nil
 }
+
+// UploadMediaToCloudinary uploads an image, video or audio file and returns its
+// secure URL. resourceType is Cloudinary's asset type: "image", or "video" for
+// both video and audio.
+func UploadMediaToCloudinary(cloudinaryClient *cloudinary.Cloudinary, media multipart.File, folder, resourceType string) (string, error) {
+	buf := bytes.NewBuffer(nil)
+	if _, err := buf.ReadFrom(media); err != nil {
+		return "", fmt.Errorf("failed to read media: %v", err)
+	}
+
+	uploadParams := uploader.UploadParams{Folder: folder, ResourceType: resourceType}
+	resp, err := cloudinaryClient.Upload.Upload(context.TODO(), buf, uploadParams)
+	if err != nil {
+		return "", fmt.Errorf("failed to upload media to Cloudinary: %v", err)
+	}
+
+	return resp.SecureURL, nil
+}
+
+// DeleteImageFromCloudinary removes an uploaded image given the secure URL
+// returned by UploadImageToCloudinary
+func DeleteImageFromCloudinary(cloudinaryClient *cloudinary.Cloudinary, imageURL string) error {
+	publicID := publicIDFromURL(imageURL)
+	if publicID == "" {
+		return fmt.Errorf("could not determine public ID from %q", imageURL)
+	}
+
+	_, err := cloudinaryClient.Upload.Destroy(context.TODO(), uploader.DestroyParams{PublicID: publicID})
+	if err != nil {
+		return fmt.Errorf("failed to delete image from Cloudinary: %v", err)
+	}
+	return nil
+}
+
+// DeleteMediaFromCloudinary removes a file uploaded with UploadMediaToCloudinary,
+// given its secure URL and the resourceType it was uploaded as
+func DeleteMediaFromCloudinary(cloudinaryClient *cloudinary.Cloudinary, mediaURL, resourceType string) error {
+	publicID := publicIDFromURL(mediaURL)
+	if publicID == "" {
+		return fmt.Errorf("could not determine public ID from %q", mediaURL)
+	}
+
+	_, err := cloudinaryClient.Upload.Destroy(context.TODO(), uploader.DestroyParams{PublicID: publicID, ResourceType: resourceType})
+	if err != nil {
+		return fmt.Errorf("failed to delete media from Cloudinary: %v", err)
+	}
+	return nil
+}
+
+// publicIDFromURL extracts the public ID ("folder/name") from a Cloudinary delivery URL
+// such as https://res.cloudinary.com/demo/image/upload/v1712345678/posts/abc.jpg
+func publicIDFromURL(imageURL string) string {
+	_, path, found := strings.Cut(imageURL, "/upload/")
+	if !found {
+		return ""
+	}
+
+	// Skip the optional version segment
+	if segment, rest, ok := strings.Cut(path, "/"); ok && strings.HasPrefix(segment, "v") {
+		if _, err := strconv.Atoi(segment[1:]); err == nil {
+			path = rest
+		}
+	}
+
+	return strings.TrimSuffix(path, filepath.Ext(path))
+}
@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GetEnvDuration reads a duration such as "15m" from the environment, falling
+// back to def when the variable is unset or invalid
+func GetEnvDuration(key string, def time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Invalid duration for %s: %v, using %s", key, err, def)
+		return def
+	}
+	return duration
+}
+
+// GetEnvInt64 reads an integer from the environment, falling back to def when
+// the variable is unset or invalid
+func GetEnvInt64(key string, def int64) int64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+
+	number, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		log.Printf("Invalid number for %s: %v, using %d", key, err, def)
+		return def
+	}
+	return number
+}
+
+// GetEnvList reads a comma separated list from the environment, falling back
+// to def when the variable is unset
+func GetEnvList(key string, def []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -0,0 +1,87 @@
+package utils
+
+import (
+	"sort"
+	"unicode"
+)
+
+// TextRange is a span of a string in runes
+type TextRange struct {
+	Offset int `json:"offset"`
+	Length int `json:"length"`
+}
+
+// Highlight cuts a snippet of at most about 2*radius runes out of text around
+// the first occurrence of any search term and reports where the terms occur in
+// the snippet. Terms match case-insensitively at the start of a word, so "run"
+// also highlights "running".
+func Highlight(text string, terms []string, radius int) (string, []TextRange) {
+	runes := []rune(text)
+	lower := toLowerRunes(text)
+
+	var matches []TextRange
+	for _, term := range terms {
+		termRunes := toLowerRunes(term)
+		if len(termRunes) == 0 {
+			continue
+		}
+		for i := 0; i+len(termRunes) <= len(lower); i++ {
+			if (i == 0 || !isWordRune(lower[i-1])) && string(lower[i:i+len(termRunes)]) == string(termRunes) {
+				matches = append(matches, TextRange{Offset: i, Length: len(termRunes)})
+			}
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Offset < matches[j].Offset })
+
+	start, end := 0, len(runes)
+	if len(runes) > 2*radius {
+		center := 0
+		if len(matches) > 0 {
+			center = matches[0].Offset
+		}
+		start = center - radius
+		if start < 0 {
+			start = 0
+		}
+		end = start + 2*radius
+		if end > len(runes) {
+			end = len(runes)
+			start = end - 2*radius
+		}
+	}
+
+	prefix, suffix := "", ""
+	if start > 0 {
+		prefix = "…"
+	}
+	if end < len(runes) {
+		suffix = "…"
+	}
+	shift := len([]rune(prefix)) - start
+
+	var ranges []TextRange
+	lastEnd := -1
+	for _, match := range matches {
+		// Skip overlaps and matches cut off by the snippet
+		if match.Offset < lastEnd || match.Offset < start || match.Offset+match.Length > end {
+			continue
+		}
+		ranges = append(ranges, TextRange{Offset: match.Offset + shift, Length: match.Length})
+		lastEnd = match.Offset + match.Length
+	}
+
+	return prefix + string(runes[start:end]) + suffix, ranges
+}
+
+// toLowerRunes lowercases rune by rune so offsets line up with the original text
+func toLowerRunes(s string) []rune {
+	runes := []rune(s)
+	for i, r := range runes {
+		runes[i] = unicode.ToLower(r)
+	}
+	return runes
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+)
+
+var mentionPattern = regexp.MustCompile(`(^|[^A-Za-z0-9_.@])@([A-Za-z0-9_.]{1,30})`)
+
+// MentionMatch is a raw @username occurrence found in a piece of text
+type MentionMatch struct {
+	Username string
+	Offset   int // offset of the '@' in UTF-16 code units
+	Length   int // length in UTF-16 code units, including the '@'
+}
+
+// ParseMentions extracts every @username occurrence from text. Offsets are
+// counted in UTF-16 code units, the way JavaScript indexes strings, so an
+// emoji before a mention counts as two.
+func ParseMentions(text string) []MentionMatch {
+	var matches []MentionMatch
+	for _, loc := range mentionPattern.FindAllStringSubmatchIndex(text, -1) {
+		// loc[4]:loc[5] is the username, the '@' sits right before it.
+		// A trailing dot is sentence punctuation rather than part of the name.
+		start := loc[4] - 1
+		username := strings.TrimRight(text[loc[4]:loc[5]], ".")
+		if username == "" {
+			continue
+		}
+		matches = append(matches, MentionMatch{
+			Username: username,
+			Offset:   utf16Len(text[:start]),
+			Length:   utf16Len(username) + 1,
+		})
+	}
+	return matches
+}
+
+// utf16Len returns the length of s in UTF-16 code units
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		// Runes outside the Basic Multilingual Plane take a surrogate pair
+		if r >= 0x10000 {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return n
+}
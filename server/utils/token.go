@@ -42,3 +42,48 @@ func GenerateToken(userID string) (string, error) {
 
 	return signedToken, nil
 }
+
+// SocketTicketTTL is how long a socket ticket can be used to open a connection
+const SocketTicketTTL = time.Minute
+
+// SocketTicketPurpose marks a token as a socket ticket so it can't be used as a session
+const SocketTicketPurpose = "socket"
+
+// GenerateSocketTicket creates a short-lived token that lets a client open a
+// websocket connection as the user when it can't send the session cookie
+func GenerateSocketTicket(userID string) (string, error) {
+	jwtSecret := os.Getenv("SECRET_KEY")
+	if jwtSecret == "" {
+		return "", fmt.Errorf("SECRET_KEY not set in .env file")
+	}
+
+	claims := jwt.MapClaims{
+		"userID":  userID,
+		"purpose": SocketTicketPurpose,
+		"exp":     time.Now().Add(SocketTicketTTL).Unix(),
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(jwtSecret))
+}
+
+// UnsubscribePurpose marks a token as an email unsubscribe link, which can
+// only turn off the user's email digest
+const UnsubscribePurpose = "unsubscribe"
+
+// GenerateUnsubscribeToken creates the signed token of a user's unsubscribe
+// link. It doesn't expire, so links in old emails keep working.
+func GenerateUnsubscribeToken(userID string) (string, error) {
+	jwtSecret := os.Getenv("SECRET_KEY")
+	if jwtSecret == "" {
+		return "", fmt.Errorf("SECRET_KEY not set in .env file")
+	}
+
+	claims := jwt.MapClaims{
+		"userID":  userID,
+		"purpose": UnsubscribePurpose,
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(jwtSecret))
+}